@@ -0,0 +1,48 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+)
+
+// InsertTransactionAcceptances stores transaction acceptances.
+// Acceptances already stored are kept as they are.
+func (db *Database) InsertTransactionAcceptances(databaseTransaction *pg.Tx, acceptances []*model.TransactionAcceptance) error {
+	return insertRows(databaseTransaction, acceptances, "DO NOTHING", "transaction acceptances")
+}
+
+// DeleteTransactionAcceptances deletes the transaction acceptances of the
+// chain blocks `acceptingBlockIDs`
+func (db *Database) DeleteTransactionAcceptances(databaseTransaction *pg.Tx, acceptingBlockIDs []uint64) error {
+	if len(acceptingBlockIDs) == 0 {
+		return nil
+	}
+	_, err := databaseTransaction.Exec("DELETE FROM transaction_acceptances WHERE accepting_block_id IN (?)", pg.In(acceptingBlockIDs))
+	return err
+}
+
+// GetTransactionAcceptances returns the transaction acceptances of the chain
+// block `acceptingBlockID`, ordered by merged block id and transaction index
+func (db *Database) GetTransactionAcceptances(databaseTransaction *pg.Tx, acceptingBlockID uint64) ([]*model.TransactionAcceptance, error) {
+	var results []*model.TransactionAcceptance
+	_, err := databaseTransaction.Query(&results, "SELECT * FROM transaction_acceptances "+
+		"WHERE accepting_block_id = ? ORDER BY block_id, transaction_index", acceptingBlockID)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// TransactionAcceptancesByTransactionID returns the acceptances of the
+// transaction `transactionID` by the chain blocks merging it
+func (db *Database) TransactionAcceptancesByTransactionID(databaseTransaction *pg.Tx,
+	transactionID string) ([]*model.TransactionAcceptance, error) {
+
+	var results []*model.TransactionAcceptance
+	_, err := databaseTransaction.Query(&results, "SELECT * FROM transaction_acceptances "+
+		"WHERE transaction_id = ? ORDER BY accepting_block_id, block_id", transactionID)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,392 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/tools"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// bulkInsertRowCount is the maximum number of rows written by a single
+// multi-row insert
+const bulkInsertRowCount = 1000
+
+// insertRows writes `rows` with multi-row inserts of at most
+// bulkInsertRowCount rows. `onConflict` is the ON CONFLICT clause of the
+// inserts, if any, and `rowsName` names the rows in errors.
+func insertRows[T any](databaseTransaction *pg.Tx, rows []T, onConflict string, rowsName string) error {
+	for start := 0; start < len(rows); start += bulkInsertRowCount {
+		chunk := rows[start:tools.Min(start+bulkInsertRowCount, len(rows))]
+		query := databaseTransaction.Model(&chunk)
+		if onConflict != "" {
+			query = query.OnConflict(onConflict)
+		}
+		_, err := query.Insert()
+		if err != nil {
+			return errors.Wrapf(err, "Could not insert %d %s", len(chunk), rowsName)
+		}
+	}
+	return nil
+}
+
+// BulkBlock is a block with its verbose data, as inserted by InsertBlocks
+type BulkBlock struct {
+	Hash               *externalapi.DomainHash
+	ParentHashes       []*externalapi.DomainHash
+	Timestamp          int64
+	DAAScore           uint64
+	BlueScore          uint64
+	BlueWork           string
+	IsHeaderOnly       bool
+	SelectedParentHash *externalapi.DomainHash
+	MergeSetRedHashes  []*externalapi.DomainHash
+	MergeSetBlueHashes []*externalapi.DomainHash
+	// ReceivedAt is the arrival time in milliseconds of the notification of
+	// the block, nil if it was not notified
+	ReceivedAt *int64
+}
+
+// bulkBlockBase is a block of a bulk run, either already stored or new
+type bulkBlockBase struct {
+	ID               uint64
+	Height           uint64
+	HeightGroupIndex uint32
+	isStored         bool
+}
+
+// InsertBlocks inserts `blocks`, ordered so that a parent always precedes its
+// children, with their edges and height groups. Heights, height group indexes
+// and edges are computed in memory and written with multi-row inserts.
+// Blocks already stored only get their selected parent and merge sets updated.
+func (db *Database) InsertBlocks(databaseTransaction *pg.Tx, blocks []*BulkBlock) error {
+	bases := make(map[externalapi.DomainHash]*bulkBlockBase)
+	storedParentIDs := make([]uint64, 0)
+	newBlocks := make([]*BulkBlock, 0, len(blocks))
+	existingBlocks := make([]*BulkBlock, 0)
+	incompleteBlocks := make(map[externalapi.DomainHash]bool)
+	seen := make(map[externalapi.DomainHash]bool)
+
+	// Resolve the parents and compute the heights of the new blocks
+	for _, block := range blocks {
+		if seen[*block.Hash] {
+			continue
+		}
+		seen[*block.Hash] = true
+		blockExists, err := db.DoesBlockExist(databaseTransaction, block.Hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not check if block %s does exist in database", block.Hash)
+		}
+		if blockExists {
+			existingBlocks = append(existingBlocks, block)
+			continue
+		}
+
+		height := uint64(0)
+		for _, parentHash := range block.ParentHashes {
+			parent, err := db.bulkBlockBase(databaseTransaction, bases, parentHash)
+			if err != nil {
+				return errors.Wrapf(err, "Could not check if parent %s for block %s does exist in database", parentHash, block.Hash)
+			}
+			if parent == nil {
+				log.Warnf("Parent %s for block %s does not exist in the database", parentHash, block.Hash)
+				incompleteBlocks[*block.Hash] = true
+				continue
+			}
+			if parent.isStored {
+				storedParentIDs = append(storedParentIDs, parent.ID)
+			}
+			if parent.Height+1 > height {
+				height = parent.Height + 1
+			}
+		}
+		bases[*block.Hash] = &bulkBlockBase{Height: height}
+		newBlocks = append(newBlocks, block)
+	}
+	if len(newBlocks) > 0 {
+		err := db.insertNewBlocks(databaseTransaction, bases, storedParentIDs, newBlocks, incompleteBlocks)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Blocks already stored only get their selected parent and merge sets updated
+	for _, block := range existingBlocks {
+		log.Debugf("Block %s already exists in database; not processed", block.Hash)
+		if block.IsHeaderOnly {
+			continue
+		}
+		blockID, err := db.BlockIDByHash(databaseTransaction, block.Hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for block %s", block.Hash)
+		}
+		if block.SelectedParentHash != nil {
+			selectedParentID, err := db.BlockIDByHash(databaseTransaction, block.SelectedParentHash)
+			if err == nil {
+				err = db.UpdateBlockSelectedParent(databaseTransaction, blockID, selectedParentID)
+				if err != nil {
+					return errors.Wrapf(err, "Could not update selected parent for block %s", block.Hash)
+				}
+			}
+		}
+		mergeSetRedIDs, mergeSetBlueIDs, err := db.bulkMergeSetIDs(databaseTransaction, bases, block)
+		if err != nil {
+			return err
+		}
+		err = db.UpdateBlockMergeSet(databaseTransaction, blockID, mergeSetRedIDs, mergeSetBlueIDs)
+		if err != nil {
+			return errors.Wrapf(err, "Could not update merge sets colors for block %s", block.Hash)
+		}
+	}
+	return nil
+}
+
+func (db *Database) insertNewBlocks(databaseTransaction *pg.Tx, bases map[externalapi.DomainHash]*bulkBlockBase,
+	storedParentIDs []uint64, newBlocks []*BulkBlock, incompleteBlocks map[externalapi.DomainHash]bool) error {
+
+	// The ids are reserved in block order, as the incremental inserts would allocate them
+	var ids []uint64
+	_, err := databaseTransaction.Query(&ids,
+		"SELECT nextval(pg_get_serial_sequence('block_nodes', 'id')) FROM generate_series(1, ?) ORDER BY 1", len(newBlocks))
+	if err != nil {
+		return errors.Wrapf(err, "Could not reserve ids for %d blocks", len(newBlocks))
+	}
+	if len(ids) != len(newBlocks) {
+		return errors.Errorf("Reserved %d ids for %d blocks", len(ids), len(newBlocks))
+	}
+
+	storedHeightGroupIndexes := make(map[uint64]uint32)
+	if len(storedParentIDs) > 0 {
+		var results []struct {
+			ID               uint64
+			HeightGroupIndex uint32
+		}
+		_, err = databaseTransaction.Query(&results, "SELECT id, height_group_index FROM block_nodes WHERE id IN (?)", pg.In(storedParentIDs))
+		if err != nil {
+			return errors.Wrapf(err, "Could not get height group indexes of %d parents", len(storedParentIDs))
+		}
+		for _, result := range results {
+			storedHeightGroupIndexes[result.ID] = result.HeightGroupIndex
+		}
+	}
+
+	heights := make([]uint64, 0, len(newBlocks))
+	heightGroupSizes := make(map[uint64]uint32)
+	for _, block := range newBlocks {
+		height := bases[*block.Hash].Height
+		if _, ok := heightGroupSizes[height]; !ok {
+			heightGroupSizes[height] = 0
+			heights = append(heights, height)
+		}
+	}
+	var storedHeightGroups []*model.HeightGroup
+	_, err = databaseTransaction.Query(&storedHeightGroups, "SELECT height, size FROM height_groups WHERE height IN (?)", pg.In(heights))
+	if err != nil {
+		return errors.Wrapf(err, "Could not get the height groups of %d heights", len(heights))
+	}
+	for _, heightGroup := range storedHeightGroups {
+		heightGroupSizes[heightGroup.Height] = heightGroup.Size
+	}
+
+	databaseBlocks := make([]*model.Block, len(newBlocks))
+	edges := make([]*model.Edge, 0, len(newBlocks))
+	missingParents := make([]*model.MissingParent, 0)
+	mergeSets := make([]*model.BlockMergeSet, 0)
+	for i, block := range newBlocks {
+		base := bases[*block.Hash]
+		base.ID = ids[i]
+		base.HeightGroupIndex = heightGroupSizes[base.Height]
+		heightGroupSizes[base.Height]++
+
+		for parentIndex, parentHash := range block.ParentHashes {
+			parent, ok := bases[*parentHash]
+			if !ok {
+				missingParents = append(missingParents, &model.MissingParent{
+					BlockID:     base.ID,
+					ParentHash:  parentHash.String(),
+					ParentIndex: uint32(parentIndex),
+				})
+				continue
+			}
+			if parent.isStored {
+				parent.HeightGroupIndex = storedHeightGroupIndexes[parent.ID]
+			}
+			edges = append(edges, &model.Edge{
+				FromBlockID:          base.ID,
+				ToBlockID:            parent.ID,
+				FromHeight:           base.Height,
+				ToHeight:             parent.Height,
+				FromHeightGroupIndex: base.HeightGroupIndex,
+				ToHeightGroupIndex:   parent.HeightGroupIndex,
+				ParentIndex:          uint32(parentIndex),
+			})
+		}
+
+		databaseBlock := &model.Block{
+			ID:                             base.ID,
+			BlockHash:                      block.Hash.String(),
+			Timestamp:                      block.Timestamp,
+			Height:                         base.Height,
+			HeightGroupIndex:               base.HeightGroupIndex,
+			SelectedParentID:               nil,
+			Color:                          model.ColorGray,
+			IsInVirtualSelectedParentChain: false,
+			DAAScore:                       block.DAAScore,
+			BlueScore:                      block.BlueScore,
+			BlueWork:                       block.BlueWork,
+			ReceivedAt:                     block.ReceivedAt,
+		}
+		if !block.IsHeaderOnly && !incompleteBlocks[*block.Hash] {
+			blockMergeSets, err := db.resolveBulkVerboseData(databaseTransaction, bases, block, databaseBlock)
+			if err != nil {
+				return err
+			}
+			mergeSets = append(mergeSets, blockMergeSets...)
+		}
+		databaseBlocks[i] = databaseBlock
+	}
+
+	heightGroups := make([]*model.HeightGroup, len(heights))
+	for i, height := range heights {
+		heightGroups[i] = &model.HeightGroup{
+			Height: height,
+			Size:   heightGroupSizes[height],
+		}
+	}
+
+	err = db.ensureHeightPartitions(databaseTransaction, heights...)
+	if err != nil {
+		return errors.Wrapf(err, "Could not create the partitions of %d heights", len(heights))
+	}
+	err = insertRows(databaseTransaction, databaseBlocks, "", "blocks")
+	if err != nil {
+		return err
+	}
+	err = db.insertBlockHashes(databaseTransaction, databaseBlocks)
+	if err != nil {
+		return err
+	}
+	err = insertRows(databaseTransaction, heightGroups, "(height) DO UPDATE SET size = EXCLUDED.size", "height groups")
+	if err != nil {
+		return err
+	}
+	err = insertRows(databaseTransaction, edges, "", "edges")
+	if err != nil {
+		return err
+	}
+	err = insertRows(databaseTransaction, missingParents, "", "missing parents")
+	if err != nil {
+		return err
+	}
+	err = db.insertLateEdges(databaseTransaction, databaseBlocks)
+	if err != nil {
+		return err
+	}
+	err = db.insertBlockMergeSets(databaseTransaction, mergeSets)
+	if err != nil {
+		return err
+	}
+
+	for i, block := range newBlocks {
+		db.blockBaseCache.Add(block.Hash, &blockBase{
+			ID:     databaseBlocks[i].ID,
+			Height: databaseBlocks[i].Height,
+		})
+	}
+	return nil
+}
+
+// resolveBulkVerboseData sets the selected parent of `databaseBlock` and
+// returns its merge set relations. A selected parent missing from the
+// database is ignored.
+func (db *Database) resolveBulkVerboseData(databaseTransaction *pg.Tx, bases map[externalapi.DomainHash]*bulkBlockBase,
+	block *BulkBlock, databaseBlock *model.Block) ([]*model.BlockMergeSet, error) {
+
+	if block.SelectedParentHash != nil {
+		selectedParent, err := db.bulkBlockBase(databaseTransaction, bases, block.SelectedParentHash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not get selected parent for block %s", block.Hash)
+		}
+		if selectedParent != nil {
+			selectedParentID := selectedParent.ID
+			databaseBlock.SelectedParentID = &selectedParentID
+		}
+	}
+
+	mergeSetRedIDs, mergeSetBlueIDs, err := db.bulkMergeSetIDs(databaseTransaction, bases, block)
+	if err != nil {
+		return nil, err
+	}
+	return mergeSetRows(databaseBlock.ID, mergeSetRedIDs, mergeSetBlueIDs), nil
+}
+
+// bulkBlockBase returns the block identified by `blockHash`, looking first in
+// the bulk run and then in the database. Returns nil if the block is unknown.
+func (db *Database) bulkBlockBase(databaseTransaction *pg.Tx, bases map[externalapi.DomainHash]*bulkBlockBase,
+	blockHash *externalapi.DomainHash) (*bulkBlockBase, error) {
+
+	if base, ok := bases[*blockHash]; ok {
+		return base, nil
+	}
+	blockExists, err := db.DoesBlockExist(databaseTransaction, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if !blockExists {
+		return nil, nil
+	}
+	bb, err := db.blockBaseByHash(databaseTransaction, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	base := &bulkBlockBase{
+		ID:       bb.ID,
+		Height:   bb.Height,
+		isStored: true,
+	}
+	bases[*blockHash] = base
+	return base, nil
+}
+
+// bulkMergeSetIDs returns the ids of the merge set reds and blues of `block`.
+// Merge set blocks missing from the database are logged and left out.
+func (db *Database) bulkMergeSetIDs(databaseTransaction *pg.Tx, bases map[externalapi.DomainHash]*bulkBlockBase,
+	block *BulkBlock) (mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64, err error) {
+
+	mergeSetRedIDs, missingReds, err := db.bulkBlockIDs(databaseTransaction, bases, block.MergeSetRedHashes)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Could not get ids of merge set reds for block %s", block.Hash)
+	}
+	if len(missingReds) > 0 {
+		log.Errorf("Could not get ids of merge set reds for block %s: %s", block.Hash, missingReds)
+	}
+	mergeSetBlueIDs, missingBlues, err := db.bulkBlockIDs(databaseTransaction, bases, block.MergeSetBlueHashes)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Could not get ids of merge set blues for block %s", block.Hash)
+	}
+	if len(missingBlues) > 0 {
+		log.Errorf("Could not get ids of merge set blues for block %s: %s", block.Hash, missingBlues)
+	}
+	return mergeSetRedIDs, mergeSetBlueIDs, nil
+}
+
+// bulkBlockIDs returns the ids of the blocks of `blockHashes` known to the
+// bulk run or the database, and the hashes of the unknown ones
+func (db *Database) bulkBlockIDs(databaseTransaction *pg.Tx, bases map[externalapi.DomainHash]*bulkBlockBase,
+	blockHashes []*externalapi.DomainHash) ([]uint64, []*externalapi.DomainHash, error) {
+
+	blockIDs := make([]uint64, 0, len(blockHashes))
+	missingHashes := make([]*externalapi.DomainHash, 0)
+	for _, blockHash := range blockHashes {
+		base, err := db.bulkBlockBase(databaseTransaction, bases, blockHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if base == nil {
+			missingHashes = append(missingHashes, blockHash)
+			continue
+		}
+		blockIDs = append(blockIDs, base.ID)
+	}
+	return blockIDs, missingHashes, nil
+}
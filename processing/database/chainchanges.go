@@ -0,0 +1,81 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/pkg/errors"
+)
+
+// blockHashAndColor is the hash and the stored color of a block
+type blockHashAndColor struct {
+	ID        uint64 `pg:"id"`
+	BlockHash string `pg:"block_hash"`
+	Color     string `pg:"color"`
+}
+
+// ColorChanges returns the color flips that applying `blockIDsToColors`
+// would cause. Blocks keeping their color are omitted.
+func (db *Database) ColorChanges(databaseTransaction *pg.Tx, blockIDsToColors map[uint64]string) ([]*model.ColorChange, error) {
+	if len(blockIDsToColors) == 0 {
+		return []*model.ColorChange{}, nil
+	}
+	blockIDs := make([]uint64, 0, len(blockIDsToColors))
+	for blockID := range blockIDsToColors {
+		blockIDs = append(blockIDs, blockID)
+	}
+	var stored []*blockHashAndColor
+	_, err := databaseTransaction.Query(&stored, "SELECT id, block_hash, color FROM block_nodes WHERE id IN (?) ORDER BY id", pg.In(blockIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]*model.ColorChange, 0, len(stored))
+	for _, block := range stored {
+		color := blockIDsToColors[block.ID]
+		if color == block.Color {
+			continue
+		}
+		changes = append(changes, &model.ColorChange{
+			BlockHash: block.BlockHash,
+			From:      block.Color,
+			To:        color,
+		})
+	}
+	return changes, nil
+}
+
+// InsertChainChange records `chainChange` in the chain changes log.
+// The log refers to blocks by hash and is kept when the database is cleared.
+func (db *Database) InsertChainChange(databaseTransaction *pg.Tx, chainChange *model.ChainChange) error {
+	_, err := databaseTransaction.Model(chainChange).Insert()
+	if err != nil {
+		return errors.Wrapf(err, "Could not insert chain change")
+	}
+	return nil
+}
+
+// ChainChangesSince returns the chain changes recorded from `timestamp` on,
+// oldest first
+func (db *Database) ChainChangesSince(databaseTransaction *pg.Tx, timestamp int64) ([]*model.ChainChange, error) {
+	var results []*model.ChainChange
+	_, err := databaseTransaction.Query(&results, "SELECT * FROM chain_changes WHERE timestamp >= ? ORDER BY id", timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ChainChangeStatsSince summarizes the chain changes recorded from
+// `timestamp` on. A reorg is a chain change removing chain blocks.
+func (db *Database) ChainChangeStatsSince(databaseTransaction *pg.Tx, timestamp int64) (*model.ChainChangeStats, error) {
+	result := new(model.ChainChangeStats)
+	_, err := databaseTransaction.QueryOne(result, "SELECT COUNT(*) AS change_count, "+
+		"COUNT(*) FILTER (WHERE reorg_depth > 0) AS reorg_count, "+
+		"COALESCE(MAX(reorg_depth), 0) AS max_reorg_depth, "+
+		"COALESCE(AVG(reorg_depth) FILTER (WHERE reorg_depth > 0), 0) AS mean_reorg_depth "+
+		"FROM chain_changes WHERE timestamp >= ?", timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -51,6 +51,11 @@ func Connect(connectionString string) (*Database, error) {
 		return nil, errors.Wrapf(err, "could not validate database timezone")
 	}
 
+	err = verifySchema(pgDB)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not verify the database schema")
+	}
+
 	return New(pgDB), nil
 }
 
@@ -14,9 +14,30 @@ import (
 type Database struct {
 	database       *pg.DB
 	blockBaseCache *lrucache.LRUCache[blockBase]
+
+	// heightPartitions are the indexes of the height partitions known to exist
+	heightPartitions map[uint64]bool
+
+	// ctx is the context of the transactions, cancelled by Interrupt
+	ctx       context.Context
+	interrupt context.CancelFunc
+
 	sync.Mutex
 }
 
+// blockDataTables are the tables holding data of a block, keyed by its id
+var blockDataTables = []string{
+	"block_headers",
+	"block_ghostdag_data",
+	"difficulty_series",
+	"transaction_acceptances",
+	"tips",
+	"missing_parents",
+	"block_transaction_summaries",
+	"block_transaction_ids",
+	"block_miners",
+}
+
 // The cache capacity is set to embed ~1.5x the blocks provided
 // by the node between the prunning point and the selected tip
 const blockbaseCacheCapacity = 400000
@@ -34,9 +55,12 @@ func (bb *blockBase) Clone() *blockBase {
 }
 
 func New(pgDatabase *pg.DB) *Database {
+	ctx, interrupt := context.WithCancel(context.Background())
 	database := &Database{
 		database:       pgDatabase,
 		blockBaseCache: lrucache.New[blockBase](blockbaseCacheCapacity, true),
+		ctx:            ctx,
+		interrupt:      interrupt,
 	}
 	return database
 }
@@ -45,7 +69,12 @@ func (db *Database) RunInTransaction(transactionFunction func(*pg.Tx) error) err
 	db.Lock()
 	defer db.Unlock()
 
-	return db.database.RunInTransaction(context.Background(), transactionFunction)
+	err := db.database.RunInTransaction(db.ctx, transactionFunction)
+	if err != nil {
+		// The partitions created by the rolled back transaction are gone
+		db.heightPartitions = nil
+	}
+	return err
 }
 
 // Load block infos into the memory cache for all blocks having a height geater or equal to minHeight
@@ -55,7 +84,7 @@ func (db *Database) LoadCache(databaseTransaction *pg.Tx, minHeight uint64) erro
 		BlockHash string
 		Height    uint64
 	}
-	_, err := databaseTransaction.Query(&results, "SELECT id, block_hash, height FROM blocks WHERE height >= ?", minHeight)
+	_, err := databaseTransaction.Query(&results, "SELECT id, block_hash, height FROM block_nodes WHERE height >= ?", minHeight)
 	if err != nil {
 		return err
 	}
@@ -88,7 +117,7 @@ func (db *Database) DoesBlockExist(databaseTransaction *pg.Tx, blockHash *extern
 	// Search database
 	var results []blockBase
 
-	_, err := databaseTransaction.Query(&results, "SELECT id, height FROM blocks WHERE block_hash = ?", blockHash.String())
+	_, err := databaseTransaction.Query(&results, "SELECT id, height FROM block_hashes WHERE block_hash = ?", blockHash.String())
 	if err != nil {
 		return false, err
 	}
@@ -100,26 +129,25 @@ func (db *Database) DoesBlockExist(databaseTransaction *pg.Tx, blockHash *extern
 	return true, nil
 }
 
-func (db *Database) InsertBlock(databaseTransaction *pg.Tx, blockHash *externalapi.DomainHash, block *model.Block) error {
-	_, err := databaseTransaction.Model(block).Insert()
-	if err != nil {
-		return err
-	}
-
-	bb := &blockBase{
-		ID:     block.ID,
-		Height: block.Height,
+// insertBlockHashes maps the hashes of the newly inserted `blocks` to their
+// ids and heights. Fails if a hash or an id is already stored, at any height.
+func (db *Database) insertBlockHashes(databaseTransaction *pg.Tx, blocks []*model.Block) error {
+	rows := make([]*model.BlockHash, len(blocks))
+	for i, block := range blocks {
+		rows[i] = &model.BlockHash{
+			BlockHash: block.BlockHash,
+			ID:        block.ID,
+			Height:    block.Height,
+		}
 	}
-	db.blockBaseCache.Add(blockHash, bb)
-
-	return nil
+	return insertRows(databaseTransaction, rows, "", "block hashes")
 }
 
 // GetBlock returns a block identified by `id`.
 // Returns an error if the block `id` does not exist
 func (db *Database) GetBlock(databaseTransaction *pg.Tx, id uint64) (*model.Block, error) {
 	result := new(model.Block)
-	_, err := databaseTransaction.QueryOne(result, "SELECT * FROM blocks WHERE id = ?", id)
+	_, err := databaseTransaction.QueryOne(result, "SELECT * FROM block_nodes WHERE id = ?", id)
 	if err != nil {
 		return nil, err
 	}
@@ -127,15 +155,7 @@ func (db *Database) GetBlock(databaseTransaction *pg.Tx, id uint64) (*model.Bloc
 }
 
 func (db *Database) UpdateBlockSelectedParent(databaseTransaction *pg.Tx, blockID uint64, selectedParentID uint64) error {
-	_, err := databaseTransaction.Exec("UPDATE blocks SET selected_parent_id = ? WHERE id = ?", selectedParentID, blockID)
-	return err
-}
-
-func (db *Database) UpdateBlockMergeSet(
-	databaseTransaction *pg.Tx, blockID uint64, mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64) error {
-
-	_, err := databaseTransaction.Exec("UPDATE blocks SET merge_set_red_ids = ?, merge_set_blue_ids = ? WHERE id = ?",
-		mergeSetRedIDs, mergeSetBlueIDs, blockID)
+	_, err := databaseTransaction.Exec("UPDATE block_nodes SET selected_parent_id = ? WHERE id = ?", selectedParentID, blockID)
 	return err
 }
 
@@ -143,7 +163,7 @@ func (db *Database) UpdateBlockIsInVirtualSelectedParentChain(
 	databaseTransaction *pg.Tx, blockIDsToIsInVirtualSelectedParentChain map[uint64]bool) error {
 
 	for blockID, isInVirtualSelectedParentChain := range blockIDsToIsInVirtualSelectedParentChain {
-		_, err := databaseTransaction.Exec("UPDATE blocks SET is_in_virtual_selected_parent_chain = ? WHERE id = ?",
+		_, err := databaseTransaction.Exec("UPDATE block_nodes SET is_in_virtual_selected_parent_chain = ? WHERE id = ?",
 			isInVirtualSelectedParentChain, blockID)
 		if err != nil {
 			return err
@@ -154,7 +174,7 @@ func (db *Database) UpdateBlockIsInVirtualSelectedParentChain(
 
 func (db *Database) UpdateBlockColors(databaseTransaction *pg.Tx, blockIDsToColors map[uint64]string) error {
 	for blockID, color := range blockIDsToColors {
-		_, err := databaseTransaction.Exec("UPDATE blocks SET color = ? WHERE id = ?", color, blockID)
+		_, err := databaseTransaction.Exec("UPDATE block_nodes SET color = ? WHERE id = ?", color, blockID)
 		if err != nil {
 			return err
 		}
@@ -165,7 +185,28 @@ func (db *Database) UpdateBlockColors(databaseTransaction *pg.Tx, blockIDsToColo
 // UpdateBlockDAAScores updates DAA Scores of block ids
 func (db *Database) UpdateBlockDAAScores(databaseTransaction *pg.Tx, blockIDsToDAAScores map[uint64]uint64) error {
 	for blockID, daaScore := range blockIDsToDAAScores {
-		_, err := databaseTransaction.Exec("UPDATE blocks SET daa_score = ? WHERE id = ?", daaScore, blockID)
+		_, err := databaseTransaction.Exec("UPDATE block_nodes SET daa_score = ? WHERE id = ?", daaScore, blockID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BlueScoreAndWork is the GHOSTDAG blue score and blue work of a block.
+// The blue work is a decimal string.
+type BlueScoreAndWork struct {
+	BlueScore uint64
+	BlueWork  string
+}
+
+// UpdateBlockBlueScoresAndWorks updates blue scores and blue works of block ids
+func (db *Database) UpdateBlockBlueScoresAndWorks(databaseTransaction *pg.Tx,
+	blockIDsToBlueScoresAndWorks map[uint64]*BlueScoreAndWork) error {
+
+	for blockID, blueScoreAndWork := range blockIDsToBlueScoresAndWorks {
+		_, err := databaseTransaction.Exec("UPDATE block_nodes SET blue_score = ?, blue_work = ? WHERE id = ?",
+			blueScoreAndWork.BlueScore, blueScoreAndWork.BlueWork, blockID)
 		if err != nil {
 			return err
 		}
@@ -203,7 +244,7 @@ func (db *Database) blockBaseByHash(databaseTransaction *pg.Tx, blockHash *exter
 
 	// Search database
 	var result blockBase
-	_, err := databaseTransaction.QueryOne(&result, "SELECT id, height FROM blocks WHERE block_hash = ?", blockHash.String())
+	_, err := databaseTransaction.QueryOne(&result, "SELECT id, height FROM block_hashes WHERE block_hash = ?", blockHash.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "block hash %s not found in blocks table", blockHash.String())
 	}
@@ -212,36 +253,6 @@ func (db *Database) blockBaseByHash(databaseTransaction *pg.Tx, blockHash *exter
 	return &result, nil
 }
 
-// BlockIDsByHashes returns an arrays of ids for `blockHashes` hashes.
-// Returns an error if any hash in `blockHash` does not exist in the database
-func (db *Database) BlockIDsByHashes(databaseTransaction *pg.Tx, blockHashes []*externalapi.DomainHash) ([]uint64, error) {
-	blockIDs := make([]uint64, len(blockHashes))
-	for i, blockHash := range blockHashes {
-		blockID, err := db.BlockIDByHash(databaseTransaction, blockHash)
-		if err != nil {
-			return nil, err
-		}
-		blockIDs[i] = blockID
-	}
-	return blockIDs, nil
-}
-
-// BlockIDsAndHeightsByHashes returns two arrays, one of ids and one of heights
-// for `blockHashes` hashes
-func (db *Database) BlockIDsAndHeightsByHashes(databaseTransaction *pg.Tx, blockHashes []*externalapi.DomainHash) ([]uint64, []uint64, error) {
-	blockIDs := make([]uint64, len(blockHashes))
-	blockHeights := make([]uint64, len(blockHashes))
-	for i, blockHash := range blockHashes {
-		bb, err := db.blockBaseByHash(databaseTransaction, blockHash)
-		if err != nil {
-			return nil, nil, err
-		}
-		blockIDs[i] = bb.ID
-		blockHeights[i] = bb.Height
-	}
-	return blockIDs, blockHeights, nil
-}
-
 // FindLatestStoredBlockIndex returns the index in a DAG ordered block hash
 // array `blockHashes` of the latest block hash that is stored in the
 // database
@@ -268,14 +279,35 @@ func (db *Database) FindLatestStoredBlockIndex(databaseTransaction *pg.Tx, block
 // BlockIDByDAAScore returns the block ID of one block having the closest DAA
 // score to `blockDAAScore`
 func (db *Database) BlockIDByDAAScore(databaseTransaction *pg.Tx, blockDAAScore uint64) (uint64, error) {
-	var result struct {
-		ID uint64
+	// The closest blocks above and below are found with the DAA score index
+	var results []struct {
+		ID       uint64
+		DAAScore uint64
 	}
-	_, err := databaseTransaction.QueryOne(&result, "SELECT id FROM blocks ORDER BY ABS(daa_score-(?)) LIMIT 1", blockDAAScore)
+	_, err := databaseTransaction.Query(&results,
+		"(SELECT id, daa_score FROM block_nodes WHERE daa_score >= ? ORDER BY daa_score LIMIT 1) UNION ALL "+
+			"(SELECT id, daa_score FROM block_nodes WHERE daa_score < ? ORDER BY daa_score DESC LIMIT 1)",
+		blockDAAScore, blockDAAScore)
 	if err != nil {
 		return 0, err
 	}
-	return result.ID, nil
+	if len(results) == 0 {
+		return 0, pg.ErrNoRows
+	}
+	closest := results[0]
+	for _, result := range results[1:] {
+		if absoluteDifference(result.DAAScore, blockDAAScore) < absoluteDifference(closest.DAAScore, blockDAAScore) {
+			closest = result
+		}
+	}
+	return closest.ID, nil
+}
+
+func absoluteDifference(a, b uint64) uint64 {
+	if a < b {
+		return b - a
+	}
+	return a - b
 }
 
 // BlockCountAtDAAScore returns the number of blocks having a DAA Score of `blockDAAScore`
@@ -283,7 +315,19 @@ func (db *Database) BlockCountAtDAAScore(databaseTransaction *pg.Tx, blockDAASco
 	var result struct {
 		N uint32
 	}
-	_, err := databaseTransaction.Query(&result, "SELECT COUNT(*) AS N FROM blocks WHERE daa_score = (?)", blockDAAScore)
+	_, err := databaseTransaction.Query(&result, "SELECT COUNT(*) AS N FROM block_nodes WHERE daa_score = (?)", blockDAAScore)
+	if err != nil {
+		return 0, err
+	}
+	return result.N, nil
+}
+
+// BlockCountWithoutBlueWork returns the number of blocks having a blue work of zero
+func (db *Database) BlockCountWithoutBlueWork(databaseTransaction *pg.Tx) (uint32, error) {
+	var result struct {
+		N uint32
+	}
+	_, err := databaseTransaction.Query(&result, "SELECT COUNT(*) AS N FROM block_nodes WHERE blue_work = 0")
 	if err != nil {
 		return 0, err
 	}
@@ -294,7 +338,7 @@ func (db *Database) HighestBlockHeight(databaseTransaction *pg.Tx, blockIDs []ui
 	var result struct {
 		Highest uint64
 	}
-	_, err := databaseTransaction.Query(&result, "SELECT MAX(height) AS highest FROM blocks WHERE id IN (?)", pg.In(blockIDs))
+	_, err := databaseTransaction.Query(&result, "SELECT MAX(height) AS highest FROM block_nodes WHERE id IN (?)", pg.In(blockIDs))
 	if err != nil {
 		return 0, err
 	}
@@ -303,60 +347,137 @@ func (db *Database) HighestBlockHeight(databaseTransaction *pg.Tx, blockIDs []ui
 
 func (db *Database) HighestBlockInVirtualSelectedParentChain(databaseTransaction *pg.Tx) (*model.Block, error) {
 	result := new(model.Block)
-	_, err := databaseTransaction.Query(result, "select * from blocks where is_in_virtual_selected_parent_chain = ? order by height desc limit 1", true)
+	_, err := databaseTransaction.Query(result, "select * from block_nodes where is_in_virtual_selected_parent_chain = ? order by height desc limit 1", true)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (db *Database) HeightGroupSize(databaseTransaction *pg.Tx, height uint64) (uint32, error) {
+// MaxBlockHeight returns the highest height of the stored blocks
+func (db *Database) MaxBlockHeight(databaseTransaction *pg.Tx) (uint64, error) {
 	var result struct {
-		Size uint32
+		Highest uint64
 	}
-	_, err := databaseTransaction.Query(&result, "SELECT size FROM height_groups WHERE height = ?", height)
+	_, err := databaseTransaction.QueryOne(&result, "SELECT COALESCE(MAX(height), 0) AS highest FROM block_nodes")
 	if err != nil {
 		return 0, err
 	}
-	return result.Size, nil
+	return result.Highest, nil
 }
 
-func (db *Database) BlockHeight(databaseTransaction *pg.Tx, blockID uint64) (uint64, error) {
+// LowestBlockHeightSince returns the lowest height of the blocks having a
+// timestamp of at least `timestamp` milliseconds.
+// Returns false if no such block exists.
+func (db *Database) LowestBlockHeightSince(databaseTransaction *pg.Tx, timestamp int64) (uint64, bool, error) {
 	var result struct {
-		Height uint64
+		Lowest *uint64
 	}
-	_, err := databaseTransaction.QueryOne(&result, "SELECT height FROM blocks WHERE id = ?", blockID)
+	_, err := databaseTransaction.QueryOne(&result, "SELECT MIN(height) AS lowest FROM block_nodes WHERE timestamp >= ?", timestamp)
 	if err != nil {
-		return 0, err
+		return 0, false, err
+	}
+	if result.Lowest == nil {
+		return 0, false, nil
 	}
-	return result.Height, nil
+	return *result.Lowest, true, nil
 }
 
-func (db *Database) BlockHeightGroupIndex(databaseTransaction *pg.Tx, blockID uint64) (uint32, error) {
-	var result struct {
-		HeightGroupIndex uint32
+// DeleteBlocksBelowHeight deletes the blocks having a height lower than
+// `height` along with their edges, height groups and block data, and evicts
+// them from the cache. Returns the number of deleted blocks.
+func (db *Database) DeleteBlocksBelowHeight(databaseTransaction *pg.Tx, height uint64) (int, error) {
+	_, err := databaseTransaction.Exec("DELETE FROM edges WHERE from_height < ?", height)
+	if err != nil {
+		return 0, err
+	}
+	err = db.deleteBlockDataBelowHeight(databaseTransaction, height)
+	if err != nil {
+		return 0, err
+	}
+	var blockHashes []string
+	_, err = databaseTransaction.Query(&blockHashes, "DELETE FROM block_nodes WHERE height < ? RETURNING block_hash", height)
+	if err != nil {
+		return 0, err
 	}
-	_, err := databaseTransaction.QueryOne(&result, "SELECT height_group_index FROM blocks WHERE id = ?", blockID)
+	_, err = databaseTransaction.Exec("DELETE FROM block_hashes WHERE height < ?", height)
 	if err != nil {
 		return 0, err
 	}
-	return result.HeightGroupIndex, nil
+	for _, blockHashString := range blockHashes {
+		blockHash, err := externalapi.NewDomainHashFromString(blockHashString)
+		if err != nil {
+			return 0, err
+		}
+		db.blockBaseCache.Remove(blockHash)
+	}
+	return len(blockHashes), nil
 }
 
-func (db *Database) InsertEdge(databaseTransaction *pg.Tx, edge *model.Edge) error {
-	_, err := databaseTransaction.Model(edge).Insert()
+// deleteBlockDataBelowHeight deletes the data of the blocks having a height
+// lower than `height`, their height groups and the edges pointing to them,
+// but neither the blocks nor their own edges
+func (db *Database) deleteBlockDataBelowHeight(databaseTransaction *pg.Tx, height uint64) error {
+	_, err := databaseTransaction.Exec("DELETE FROM edges WHERE to_height < ?", height)
 	if err != nil {
 		return err
 	}
-	return nil
+	for _, table := range blockDataTables {
+		_, err = databaseTransaction.Exec("DELETE FROM ? WHERE block_id IN (SELECT id FROM block_nodes WHERE height < ?)", pg.Ident(table), height)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = databaseTransaction.Exec("DELETE FROM block_merge_sets WHERE "+
+		"chain_block_id IN (SELECT id FROM block_nodes WHERE height < ?) OR "+
+		"merged_block_id IN (SELECT id FROM block_nodes WHERE height < ?)", height, height)
+	if err != nil {
+		return err
+	}
+	_, err = databaseTransaction.Exec("DELETE FROM height_groups WHERE height < ?", height)
+	return err
 }
 
-func (db *Database) InsertOrUpdateHeightGroup(databaseTransaction *pg.Tx, heightGroup *model.HeightGroup) error {
-	_, err := databaseTransaction.Model(heightGroup).OnConflict("(height) DO UPDATE SET size = EXCLUDED.size").Insert()
+// insertLateEdges adds the edges from the stored children of the newly
+// inserted `blocks`, recorded as their missing parents, and removes these
+// records
+func (db *Database) insertLateEdges(databaseTransaction *pg.Tx, blocks []*model.Block) error {
+	blocksByHash := make(map[string]*model.Block, len(blocks))
+	blockHashes := make([]string, len(blocks))
+	for i, block := range blocks {
+		blocksByHash[block.BlockHash] = block
+		blockHashes[i] = block.BlockHash
+	}
+	var children []struct {
+		BlockID          uint64
+		ParentHash       string
+		ParentIndex      uint32
+		Height           uint64
+		HeightGroupIndex uint32
+	}
+	_, err := databaseTransaction.Query(&children, "DELETE FROM missing_parents USING block_nodes "+
+		"WHERE missing_parents.parent_hash IN (?) AND block_nodes.id = missing_parents.block_id "+
+		"RETURNING missing_parents.block_id, missing_parents.parent_hash, missing_parents.parent_index, "+
+		"block_nodes.height, block_nodes.height_group_index",
+		pg.In(blockHashes))
 	if err != nil {
-		return err
+		return errors.Wrapf(err, "Could not get the stored children of %d blocks", len(blocks))
+	}
+
+	edges := make([]*model.Edge, len(children))
+	for i, child := range children {
+		parent := blocksByHash[child.ParentHash]
+		edges[i] = &model.Edge{
+			FromBlockID:          child.BlockID,
+			ToBlockID:            parent.ID,
+			FromHeight:           child.Height,
+			ToHeight:             parent.Height,
+			FromHeightGroupIndex: child.HeightGroupIndex,
+			ToHeightGroupIndex:   parent.HeightGroupIndex,
+			ParentIndex:          child.ParentIndex,
+		}
 	}
-	return nil
+	return insertRows(databaseTransaction, edges, "", "late edges")
 }
 
 // GetAppConfig returns the stored app config.
@@ -382,9 +503,38 @@ func (db *Database) StoreAppConfig(databaseTransaction *pg.Tx, appConfig *model.
 	return nil
 }
 
+// GetResyncCheckpoint returns the stored resync checkpoint.
+// Returns nil if no checkpoint does exist in the database.
+func (db *Database) GetResyncCheckpoint(databaseTransaction *pg.Tx) (*model.ResyncCheckpoint, error) {
+	result := new(model.ResyncCheckpoint)
+	_, err := databaseTransaction.QueryOne(result, "SELECT * FROM resync_checkpoint")
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StoreResyncCheckpoint stores a ResyncCheckpoint in the database.
+// ID is forced to true so that the database stores at most one checkpoint.
+func (db *Database) StoreResyncCheckpoint(databaseTransaction *pg.Tx, checkpoint *model.ResyncCheckpoint) error {
+	checkpoint.ID = true
+	_, err := databaseTransaction.Model(checkpoint).OnConflict("(id) DO UPDATE SET pruning_point_hash = EXCLUDED.pruning_point_hash, last_committed_index = EXCLUDED.last_committed_index, last_committed_hash = EXCLUDED.last_committed_hash, phase = EXCLUDED.phase").Insert()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (db *Database) Clear(databaseTransaction *pg.Tx) error {
 	db.clearCache()
-	_, err := databaseTransaction.Exec("TRUNCATE TABLE blocks")
+	_, err := databaseTransaction.Exec("TRUNCATE TABLE block_nodes")
+	if err != nil {
+		return err
+	}
+	_, err = databaseTransaction.Exec("TRUNCATE TABLE block_hashes")
 	if err != nil {
 		return err
 	}
@@ -393,9 +543,29 @@ func (db *Database) Clear(databaseTransaction *pg.Tx) error {
 		return err
 	}
 	_, err = databaseTransaction.Exec("TRUNCATE TABLE height_groups")
+	if err != nil {
+		return err
+	}
+	_, err = databaseTransaction.Exec("TRUNCATE TABLE block_merge_sets")
+	if err != nil {
+		return err
+	}
+	for _, table := range blockDataTables {
+		_, err = databaseTransaction.Exec("TRUNCATE TABLE ?", pg.Ident(table))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = databaseTransaction.Exec("TRUNCATE TABLE resync_checkpoint")
 	return err
 }
 
+// Interrupt cancels the query in flight and makes the following transactions
+// fail. Unlike Close, it does not wait for the transaction in flight.
+func (db *Database) Interrupt() {
+	db.interrupt()
+}
+
 func (db *Database) Close() {
 	db.Lock()
 	defer db.Unlock()
@@ -405,3 +575,18 @@ func (db *Database) Close() {
 		log.Warnf("Could not close database: %s", err)
 	}
 }
+
+// PropagationDelaysBetweenHeights returns the propagation delays of the
+// blocks between `lowHeight` and `highHeight`, inclusive.
+// Blocks not received through a notification are omitted.
+func (db *Database) PropagationDelaysBetweenHeights(databaseTransaction *pg.Tx,
+	lowHeight uint64, highHeight uint64) ([]*model.PropagationDelay, error) {
+
+	var results []*model.PropagationDelay
+	_, err := databaseTransaction.Query(&results, "SELECT * FROM block_propagation_delays "+
+		"WHERE height >= ? AND height <= ? ORDER BY height, block_id", lowHeight, highHeight)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
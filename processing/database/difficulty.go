@@ -0,0 +1,66 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+)
+
+// InsertDifficultySamples stores difficulty samples.
+// Samples already stored for a DAA score are kept as they are.
+func (db *Database) InsertDifficultySamples(databaseTransaction *pg.Tx, samples []*model.DifficultySample) error {
+	return insertRows(databaseTransaction, samples, "DO NOTHING", "difficulty samples")
+}
+
+// DifficultySamplesBetweenDAAScores returns the difficulty samples having a
+// DAA score between `lowDAAScore` and `highDAAScore` included, ordered by DAA score
+func (db *Database) DifficultySamplesBetweenDAAScores(databaseTransaction *pg.Tx,
+	lowDAAScore uint64, highDAAScore uint64) ([]*model.DifficultySample, error) {
+
+	var results []*model.DifficultySample
+	_, err := databaseTransaction.Query(&results, "SELECT * FROM difficulty_series "+
+		"WHERE daa_score >= ? AND daa_score <= ? ORDER BY daa_score", lowDAAScore, highDAAScore)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DifficultySeriesBetweenDAAScores returns the difficulty series between
+// `lowDAAScore` and `highDAAScore` included, downsampled to at most
+// `maxPoints` points of equal DAA score ranges
+func (db *Database) DifficultySeriesBetweenDAAScores(databaseTransaction *pg.Tx,
+	lowDAAScore uint64, highDAAScore uint64, maxPoints int) ([]*model.DifficultyPoint, error) {
+
+	return db.difficultySeries(databaseTransaction, "daa_score", int64(lowDAAScore), int64(highDAAScore), maxPoints)
+}
+
+// DifficultySeriesBetweenTimestamps returns the difficulty series between
+// the timestamps in milliseconds `lowTimestamp` and `highTimestamp` included,
+// downsampled to at most `maxPoints` points of equal time ranges
+func (db *Database) DifficultySeriesBetweenTimestamps(databaseTransaction *pg.Tx,
+	lowTimestamp int64, highTimestamp int64, maxPoints int) ([]*model.DifficultyPoint, error) {
+
+	return db.difficultySeries(databaseTransaction, "timestamp", lowTimestamp, highTimestamp, maxPoints)
+}
+
+// difficultySeries averages the difficulty samples having a `column` value
+// between `low` and `high` included into at most `maxPoints` buckets.
+// `column` must be a trusted column name.
+func (db *Database) difficultySeries(databaseTransaction *pg.Tx, column string, low int64, high int64,
+	maxPoints int) ([]*model.DifficultyPoint, error) {
+
+	if high < low || maxPoints < 1 {
+		return []*model.DifficultyPoint{}, nil
+	}
+	bucketSize := (high - low + int64(maxPoints)) / int64(maxPoints)
+
+	var results []*model.DifficultyPoint
+	_, err := databaseTransaction.Query(&results, "SELECT MIN(daa_score) AS daa_score, MIN(timestamp) AS timestamp, "+
+		"AVG(difficulty) AS difficulty, AVG(hashrate) AS hashrate FROM difficulty_series "+
+		"WHERE "+column+" >= ? AND "+column+" <= ? GROUP BY ("+column+" - ?) / ? ORDER BY MIN("+column+")",
+		low, high, low, bucketSize)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
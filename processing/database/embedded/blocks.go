@@ -0,0 +1,685 @@
+package embedded
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+func (s *Storage) DoesBlockExist(databaseTransaction database.Transaction, blockHash *externalapi.DomainHash) (bool, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return false, err
+	}
+	return hasRow(tx, blockHashesBucket, []byte(blockHash.String())), nil
+}
+
+// insertBlock stores `block`, assigning it the next block id if it has none,
+// and adds the edges from its children stored before it
+func (s *Storage) insertBlock(tx *transaction, block *model.Block) error {
+	if hasRow(tx, blockHashesBucket, []byte(block.BlockHash)) {
+		return errors.Errorf("block %s already exists", block.BlockHash)
+	}
+	if block.ID == 0 {
+		id, err := nextID(tx, blockIDSequence)
+		if err != nil {
+			return err
+		}
+		block.ID = id
+	} else if hasRow(tx, blockIDsBucket, uint64Key(block.ID)) {
+		return errors.Errorf("block id %d already exists", block.ID)
+	}
+	key := blockKey(block.Height, block.ID)
+	err := putRow(tx, blocksBucket, key, block)
+	if err != nil {
+		return err
+	}
+	err = tx.tx.Bucket(blockHashesBucket).Put([]byte(block.BlockHash), key)
+	if err != nil {
+		return err
+	}
+	err = tx.tx.Bucket(blockIDsBucket).Put(uint64Key(block.ID), key)
+	if err != nil {
+		return err
+	}
+	return s.insertLateEdges(tx, block)
+}
+
+// insertLateEdges adds the edges from the stored children of the newly
+// inserted `block`, recorded as their missing parent, and removes these records
+func (s *Storage) insertLateEdges(tx *transaction, block *model.Block) error {
+	prefix := []byte(block.BlockHash)
+	keys, err := keysWithPrefix(tx, missingParentsByHashBucket, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		childID := keyUint64(key[len(prefix):], 0)
+		missingParentKey := append(uint64Key(childID), prefix...)
+		missingParent := &model.MissingParent{}
+		_, err := getRow(tx, missingParentsBucket, missingParentKey, missingParent)
+		if err != nil {
+			return err
+		}
+		child, ok, err := s.blockByID(tx, childID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			err = s.insertEdge(tx, &model.Edge{
+				FromBlockID:          child.ID,
+				ToBlockID:            block.ID,
+				FromHeight:           child.Height,
+				ToHeight:             block.Height,
+				FromHeightGroupIndex: child.HeightGroupIndex,
+				ToHeightGroupIndex:   block.HeightGroupIndex,
+				ParentIndex:          missingParent.ParentIndex,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.tx.Bucket(missingParentsBucket).Delete(missingParentKey)
+		if err != nil {
+			return err
+		}
+		err = tx.tx.Bucket(missingParentsByHashBucket).Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockByIndex returns the block whose blockKey is stored under `indexKey`
+// in the bucket `index`
+func (s *Storage) blockByIndex(tx *transaction, index []byte, indexKey []byte) (*model.Block, bool, error) {
+	key := tx.tx.Bucket(index).Get(indexKey)
+	if key == nil {
+		return nil, false, nil
+	}
+	block := &model.Block{}
+	ok, err := getRow(tx, blocksBucket, key, block)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, errors.Errorf("%s references the missing block %d at height %d",
+			index, keyUint64(key, 1), keyUint64(key, 0))
+	}
+	return block, true, nil
+}
+
+func (s *Storage) blockByID(tx *transaction, id uint64) (*model.Block, bool, error) {
+	return s.blockByIndex(tx, blockIDsBucket, uint64Key(id))
+}
+
+// blockByHash returns the block identified by `blockHash`.
+// Returns an error if `blockHash` does not exist in the storage
+func (s *Storage) blockByHash(tx *transaction, blockHash *externalapi.DomainHash) (*model.Block, error) {
+	block, ok, err := s.blockByIndex(tx, blockHashesBucket, []byte(blockHash.String()))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Errorf("block hash %s not found in blocks table", blockHash)
+	}
+	return block, nil
+}
+
+// GetBlock returns a block identified by `id`.
+// Returns an error if the block `id` does not exist
+func (s *Storage) GetBlock(databaseTransaction database.Transaction, id uint64) (*model.Block, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	block, ok, err := s.blockByID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Errorf("block id %d not found in blocks table", id)
+	}
+	return block, nil
+}
+
+// updateBlock stores the block `blockID` changed by `update`.
+// A missing block is ignored, like an UPDATE matching no row.
+func (s *Storage) updateBlock(tx *transaction, blockID uint64, update func(block *model.Block)) error {
+	block, ok, err := s.blockByID(tx, blockID)
+	if err != nil || !ok {
+		return err
+	}
+	update(block)
+	return putRow(tx, blocksBucket, blockKey(block.Height, block.ID), block)
+}
+
+func (s *Storage) updateBlockSelectedParent(tx *transaction, blockID uint64, selectedParentID uint64) error {
+	return s.updateBlock(tx, blockID, func(block *model.Block) {
+		block.SelectedParentID = &selectedParentID
+	})
+}
+
+func (s *Storage) UpdateBlockIsInVirtualSelectedParentChain(databaseTransaction database.Transaction,
+	blockIDsToIsInVirtualSelectedParentChain map[uint64]bool) error {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	for blockID, isInVirtualSelectedParentChain := range blockIDsToIsInVirtualSelectedParentChain {
+		err = s.updateBlock(tx, blockID, func(block *model.Block) {
+			block.IsInVirtualSelectedParentChain = isInVirtualSelectedParentChain
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) UpdateBlockColors(databaseTransaction database.Transaction, blockIDsToColors map[uint64]string) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	for blockID, color := range blockIDsToColors {
+		err = s.updateBlock(tx, blockID, func(block *model.Block) {
+			block.Color = color
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) UpdateBlockDAAScores(databaseTransaction database.Transaction, blockIDsToDAAScores map[uint64]uint64) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	for blockID, daaScore := range blockIDsToDAAScores {
+		err = s.updateBlock(tx, blockID, func(block *model.Block) {
+			block.DAAScore = daaScore
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) UpdateBlockBlueScoresAndWorks(databaseTransaction database.Transaction,
+	blockIDsToBlueScoresAndWorks map[uint64]*database.BlueScoreAndWork) error {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	for blockID, blueScoreAndWork := range blockIDsToBlueScoresAndWorks {
+		err = s.updateBlock(tx, blockID, func(block *model.Block) {
+			block.BlueScore = blueScoreAndWork.BlueScore
+			block.BlueWork = blueScoreAndWork.BlueWork
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockKeyByHash returns the blockKey of the block identified by `blockHash`.
+// Returns an error if `blockHash` does not exist in the storage
+func (s *Storage) blockKeyByHash(databaseTransaction database.Transaction, blockHash *externalapi.DomainHash) ([]byte, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	key := tx.tx.Bucket(blockHashesBucket).Get([]byte(blockHash.String()))
+	if key == nil {
+		return nil, errors.Errorf("block hash %s not found in blocks table", blockHash)
+	}
+	return key, nil
+}
+
+func (s *Storage) BlockIDByHash(databaseTransaction database.Transaction, blockHash *externalapi.DomainHash) (uint64, error) {
+	key, err := s.blockKeyByHash(databaseTransaction, blockHash)
+	if err != nil {
+		return 0, err
+	}
+	return keyUint64(key, 1), nil
+}
+
+func (s *Storage) BlockHeightByHash(databaseTransaction database.Transaction, blockHash *externalapi.DomainHash) (uint64, error) {
+	key, err := s.blockKeyByHash(databaseTransaction, blockHash)
+	if err != nil {
+		return 0, err
+	}
+	return keyUint64(key, 0), nil
+}
+
+// FindLatestStoredBlockIndex returns the index in a DAG ordered block hash
+// array `blockHashes` of the latest block hash that is stored
+func (s *Storage) FindLatestStoredBlockIndex(databaseTransaction database.Transaction,
+	blockHashes []*externalapi.DomainHash) (int, error) {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return 0, err
+	}
+	low := 0
+	high := len(blockHashes)
+	for (high - low) > 1 {
+		cur := (high + low) / 2
+		if hasRow(tx, blockHashesBucket, []byte(blockHashes[cur].String())) {
+			low = cur
+		} else {
+			high = cur
+		}
+	}
+	return low, nil
+}
+
+// forEachBlock calls `f` with the blocks in height order, or in reverse
+// height order if `isReversed`, until `f` returns false
+func forEachBlock(tx *transaction, isReversed bool, f func(block *model.Block) bool) error {
+	cursor := tx.tx.Bucket(blocksBucket).Cursor()
+	first, next := cursor.First, cursor.Next
+	if isReversed {
+		first, next = cursor.Last, cursor.Prev
+	}
+	for key, value := first(); key != nil; key, value = next() {
+		block := &model.Block{}
+		err := decodeRow(blocksBucket, value, block)
+		if err != nil {
+			return err
+		}
+		if !f(block) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Storage) BlockCountAtDAAScore(databaseTransaction database.Transaction, blockDAAScore uint64) (uint32, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return 0, err
+	}
+	count := uint32(0)
+	err = forEachBlock(tx, false, func(block *model.Block) bool {
+		if block.DAAScore == blockDAAScore {
+			count++
+		}
+		return true
+	})
+	return count, err
+}
+
+func (s *Storage) BlockCountWithoutBlueWork(databaseTransaction database.Transaction) (uint32, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return 0, err
+	}
+	count := uint32(0)
+	err = forEachBlock(tx, false, func(block *model.Block) bool {
+		blueWork, ok := new(big.Int).SetString(block.BlueWork, 10)
+		if !ok || blueWork.Sign() == 0 {
+			count++
+		}
+		return true
+	})
+	return count, err
+}
+
+// HighestBlockInVirtualSelectedParentChain returns the highest chain block,
+// or an empty block if the chain is empty
+func (s *Storage) HighestBlockInVirtualSelectedParentChain(databaseTransaction database.Transaction) (*model.Block, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	result := &model.Block{}
+	err = forEachBlock(tx, true, func(block *model.Block) bool {
+		if !block.IsInVirtualSelectedParentChain {
+			return true
+		}
+		result = block
+		return false
+	})
+	return result, err
+}
+
+func (s *Storage) MaxBlockHeight(databaseTransaction database.Transaction) (uint64, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return 0, err
+	}
+	key, _ := tx.tx.Bucket(blocksBucket).Cursor().Last()
+	if key == nil {
+		return 0, nil
+	}
+	return keyUint64(key, 0), nil
+}
+
+func (s *Storage) LowestBlockHeightSince(databaseTransaction database.Transaction, timestamp int64) (uint64, bool, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return 0, false, err
+	}
+	lowestHeight := uint64(0)
+	found := false
+	err = forEachBlock(tx, false, func(block *model.Block) bool {
+		if block.Timestamp < timestamp {
+			return true
+		}
+		lowestHeight = block.Height
+		found = true
+		return false
+	})
+	return lowestHeight, found, err
+}
+
+func (s *Storage) insertEdge(tx *transaction, edge *model.Edge) error {
+	key := uint64Key(edge.FromBlockID, edge.ToBlockID)
+	if hasRow(tx, edgesBucket, key) {
+		return errors.Errorf("edge from %d to %d already exists", edge.FromBlockID, edge.ToBlockID)
+	}
+	err := putRow(tx, edgesBucket, key, edge)
+	if err != nil {
+		return err
+	}
+	return tx.tx.Bucket(childrenBucket).Put(uint64Key(edge.ToBlockID, edge.FromBlockID), []byte{})
+}
+
+// deleteEdges removes the edges from and to the block `blockID`
+func (s *Storage) deleteEdges(tx *transaction, blockID uint64) error {
+	parentKeys, err := keysWithPrefix(tx, edgesBucket, uint64Key(blockID))
+	if err != nil {
+		return err
+	}
+	childKeys, err := keysWithPrefix(tx, childrenBucket, uint64Key(blockID))
+	if err != nil {
+		return err
+	}
+	for _, key := range parentKeys {
+		err = tx.tx.Bucket(childrenBucket).Delete(uint64Key(keyUint64(key, 1), blockID))
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range childKeys {
+		err = tx.tx.Bucket(edgesBucket).Delete(uint64Key(keyUint64(key, 1), blockID))
+		if err != nil {
+			return err
+		}
+	}
+	err = deleteKeys(tx, edgesBucket, parentKeys)
+	if err != nil {
+		return err
+	}
+	return deleteKeys(tx, childrenBucket, childKeys)
+}
+
+// insertMissingParents records the direct parents `missingParents` that are
+// not stored yet, so that their edges are added once they are
+func (s *Storage) insertMissingParents(tx *transaction, missingParents []*model.MissingParent) error {
+	for _, missingParent := range missingParents {
+		key := append(uint64Key(missingParent.BlockID), missingParent.ParentHash...)
+		err := putRow(tx, missingParentsBucket, key, missingParent)
+		if err != nil {
+			return err
+		}
+		hashKey := append([]byte(missingParent.ParentHash), uint64Key(missingParent.BlockID)...)
+		err = tx.tx.Bucket(missingParentsByHashBucket).Put(hashKey, []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMissingParents removes the missing parents of the block `blockID`
+func (s *Storage) deleteMissingParents(tx *transaction, blockID uint64) error {
+	prefix := uint64Key(blockID)
+	keys, err := keysWithPrefix(tx, missingParentsBucket, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = tx.tx.Bucket(missingParentsByHashBucket).Delete(append(key[len(prefix):], prefix...))
+		if err != nil {
+			return err
+		}
+	}
+	return deleteKeys(tx, missingParentsBucket, keys)
+}
+
+// UpdateTips adds the blocks `blockIDs`, just inserted with their edges, to
+// the tips and removes their parents from the tips.
+// A block arriving after one of its children already has the edge from it,
+// so it is not a tip.
+func (s *Storage) UpdateTips(databaseTransaction database.Transaction, blockIDs []uint64) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	tips := tx.tx.Bucket(tipsBucket)
+	for _, blockID := range blockIDs {
+		parentKeys, err := keysWithPrefix(tx, edgesBucket, uint64Key(blockID))
+		if err != nil {
+			return err
+		}
+		for _, key := range parentKeys {
+			err = tips.Delete(uint64Key(keyUint64(key, 1)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, blockID := range blockIDs {
+		if !hasRow(tx, blockIDsBucket, uint64Key(blockID)) {
+			continue
+		}
+		childKey, _ := tx.tx.Bucket(childrenBucket).Cursor().Seek(uint64Key(blockID))
+		if childKey != nil && keyUint64(childKey, 0) == blockID {
+			continue
+		}
+		err = tips.Put(uint64Key(blockID), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateBlockMergeSet replaces the merge set of the block `blockID`
+func (s *Storage) updateBlockMergeSet(tx *transaction, blockID uint64, mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64) error {
+	err := deleteWithPrefix(tx, mergeSetsBucket, uint64Key(blockID))
+	if err != nil {
+		return err
+	}
+	return s.insertBlockMergeSet(tx, blockID, mergeSetRedIDs, mergeSetBlueIDs)
+}
+
+// insertBlockMergeSet stores the merge set of the block `blockID`.
+// Relations already stored are kept as they are.
+func (s *Storage) insertBlockMergeSet(tx *transaction, blockID uint64, mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64) error {
+	insert := func(mergedBlockIDs []uint64, color string) error {
+		mergeSets := make([]*model.BlockMergeSet, len(mergedBlockIDs))
+		for i, mergedBlockID := range mergedBlockIDs {
+			mergeSets[i] = &model.BlockMergeSet{
+				ChainBlockID:  blockID,
+				MergedBlockID: mergedBlockID,
+				Color:         color,
+				MergeSetIndex: uint32(i),
+			}
+		}
+		return insertNew(tx, mergeSetsBucket, mergeSets, func(mergeSet *model.BlockMergeSet) []byte {
+			return uint64Key(mergeSet.ChainBlockID, mergeSet.MergedBlockID)
+		})
+	}
+	err := insert(mergeSetRedIDs, model.ColorRed)
+	if err != nil {
+		return err
+	}
+	return insert(mergeSetBlueIDs, model.ColorBlue)
+}
+
+// GetBlockMergeSet returns the ordered merge set reds and blues of the block `blockID`
+func (s *Storage) GetBlockMergeSet(databaseTransaction database.Transaction, blockID uint64) (
+	mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64, err error) {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, nil, err
+	}
+	mergeSets := make([]*model.BlockMergeSet, 0)
+	err = forEachWithPrefix(tx, mergeSetsBucket, uint64Key(blockID), func(_ []byte, value []byte) error {
+		mergeSet := &model.BlockMergeSet{}
+		mergeSets = append(mergeSets, mergeSet)
+		return decodeRow(mergeSetsBucket, value, mergeSet)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(mergeSets, func(i, j int) bool { return mergeSets[i].MergeSetIndex < mergeSets[j].MergeSetIndex })
+
+	mergeSetRedIDs = []uint64{}
+	mergeSetBlueIDs = []uint64{}
+	for _, mergeSet := range mergeSets {
+		if mergeSet.Color == model.ColorRed {
+			mergeSetRedIDs = append(mergeSetRedIDs, mergeSet.MergedBlockID)
+		} else {
+			mergeSetBlueIDs = append(mergeSetBlueIDs, mergeSet.MergedBlockID)
+		}
+	}
+	return mergeSetRedIDs, mergeSetBlueIDs, nil
+}
+
+// ColorChanges returns the color flips that applying `blockIDsToColors`
+// would cause, ordered by block id. Blocks keeping their color are omitted.
+func (s *Storage) ColorChanges(databaseTransaction database.Transaction, blockIDsToColors map[uint64]string) ([]*model.ColorChange, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	blockIDs := make([]uint64, 0, len(blockIDsToColors))
+	for blockID := range blockIDsToColors {
+		blockIDs = append(blockIDs, blockID)
+	}
+	sort.Slice(blockIDs, func(i, j int) bool { return blockIDs[i] < blockIDs[j] })
+
+	changes := make([]*model.ColorChange, 0, len(blockIDs))
+	for _, blockID := range blockIDs {
+		block, ok, err := s.blockByID(tx, blockID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || block.Color == blockIDsToColors[blockID] {
+			continue
+		}
+		changes = append(changes, &model.ColorChange{
+			BlockHash: block.BlockHash,
+			From:      block.Color,
+			To:        blockIDsToColors[blockID],
+		})
+	}
+	return changes, nil
+}
+
+// DeleteBlocksBelowHeight deletes the blocks having a height lower than
+// `height` along with their edges, height groups and block data.
+// Returns the number of deleted blocks.
+func (s *Storage) DeleteBlocksBelowHeight(databaseTransaction database.Transaction, height uint64) (int, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return 0, err
+	}
+	return s.deleteBlocksBelowHeight(tx, height)
+}
+
+func (s *Storage) deleteBlocksBelowHeight(tx *transaction, height uint64) (int, error) {
+	blocks := make([]*model.Block, 0)
+	err := forEachBlock(tx, false, func(block *model.Block) bool {
+		if block.Height >= height {
+			return false
+		}
+		blocks = append(blocks, block)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	blockIDs := make(map[uint64]bool, len(blocks))
+	for _, block := range blocks {
+		blockIDs[block.ID] = true
+	}
+
+	for _, block := range blocks {
+		err = s.deleteEdges(tx, block.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = deleteMatchingKeys(tx, mergeSetsBucket, func(key []byte) bool {
+		return blockIDs[keyUint64(key, 0)] || blockIDs[keyUint64(key, 1)]
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = deleteMatchingKeys(tx, heightGroupsBucket, func(key []byte) bool { return keyUint64(key, 0) < height })
+	if err != nil {
+		return 0, err
+	}
+	err = s.deleteBlockData(tx, blocks, blockIDs)
+	if err != nil {
+		return 0, err
+	}
+	for _, block := range blocks {
+		err = tx.tx.Bucket(blocksBucket).Delete(blockKey(block.Height, block.ID))
+		if err != nil {
+			return 0, err
+		}
+		err = tx.tx.Bucket(blockHashesBucket).Delete([]byte(block.BlockHash))
+		if err != nil {
+			return 0, err
+		}
+		err = tx.tx.Bucket(blockIDsBucket).Delete(uint64Key(block.ID))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(blocks), nil
+}
+
+// DropHeightPartitionsBelow deletes the blocks of the height partitions
+// lying entirely below `height`, and compacts the storage file once the
+// transaction is committed so that their space is given back, as dropping
+// the PostgreSQL partitions does.
+// Returns the height below which the blocks were dropped, 0 if none was.
+func (s *Storage) DropHeightPartitionsBelow(databaseTransaction database.Transaction, height uint64) (uint64, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return 0, err
+	}
+	droppedBelow := height / database.HeightPartitionSize * database.HeightPartitionSize
+	if droppedBelow == 0 {
+		return 0, nil
+	}
+	deletedCount, err := s.deleteBlocksBelowHeight(tx, droppedBelow)
+	if err != nil {
+		return 0, err
+	}
+	if deletedCount == 0 {
+		return 0, nil
+	}
+	tx.isCompactionNeeded = true
+	return droppedBelow, nil
+}
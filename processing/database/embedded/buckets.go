@@ -0,0 +1,247 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The buckets of the storage, mirroring the tables of the PostgreSQL schema.
+// Rows are stored as JSON under big-endian keys, so that the cursors walk
+// them in the order of their numeric keys.
+var (
+	// sequencesBucket maps the name of a sequence to its last id
+	sequencesBucket = []byte("sequences")
+	// blocksBucket maps blockKey(height, id) to a block, in height order
+	blocksBucket = []byte("block_nodes")
+	// blockHashesBucket maps a block hash to its blockKey
+	blockHashesBucket = []byte("block_hashes")
+	// blockIDsBucket maps a block id to its blockKey
+	blockIDsBucket = []byte("block_ids")
+	// edgesBucket maps uint64Key(from, to) to an edge
+	edgesBucket = []byte("edges")
+	// childrenBucket maps uint64Key(to, from) of the edges to nothing
+	childrenBucket = []byte("edges_by_parent")
+	// heightGroupsBucket maps a height to its height group
+	heightGroupsBucket = []byte("height_groups")
+	// mergeSetsBucket maps uint64Key(chain block id, merged block id) to a merge set relation
+	mergeSetsBucket = []byte("block_merge_sets")
+	// tipsBucket maps the block id of a tip to nothing
+	tipsBucket = []byte("tips")
+	// missingParentsBucket maps a block id and a parent hash to a missing parent
+	missingParentsBucket = []byte("missing_parents")
+	// missingParentsByHashBucket maps a parent hash and a block id to nothing
+	missingParentsByHashBucket = []byte("missing_parents_by_hash")
+	// headersBucket maps a block id to its header
+	headersBucket = []byte("block_headers")
+	// ghostdagDataBucket maps a block id to its GHOSTDAG data
+	ghostdagDataBucket = []byte("block_ghostdag_data")
+	// difficultySamplesBucket maps a DAA score to its difficulty sample
+	difficultySamplesBucket = []byte("difficulty_series")
+	// transactionAcceptancesBucket maps an accepting block id, a block id and
+	// a transaction index to a transaction acceptance
+	transactionAcceptancesBucket = []byte("transaction_acceptances")
+	// transactionSummariesBucket maps a block id to its transaction summary
+	transactionSummariesBucket = []byte("block_transaction_summaries")
+	// transactionIDsBucket maps a block id and a transaction index to a transaction id
+	transactionIDsBucket = []byte("block_transaction_ids")
+	// minersBucket maps a block id to its miner
+	minersBucket = []byte("block_miners")
+	// chainChangesBucket maps an id to a chain change
+	chainChangesBucket = []byte("chain_changes")
+	// appConfigBucket holds the app config under singletonKey
+	appConfigBucket = []byte("app_config")
+	// resyncCheckpointBucket holds the resync checkpoint under singletonKey
+	resyncCheckpointBucket = []byte("resync_checkpoint")
+)
+
+var allBuckets = [][]byte{
+	sequencesBucket, blocksBucket, blockHashesBucket, blockIDsBucket, edgesBucket, childrenBucket,
+	heightGroupsBucket, mergeSetsBucket, tipsBucket, missingParentsBucket, missingParentsByHashBucket,
+	headersBucket, ghostdagDataBucket, difficultySamplesBucket, transactionAcceptancesBucket,
+	transactionSummariesBucket, transactionIDsBucket, minersBucket, chainChangesBucket, appConfigBucket,
+	resyncCheckpointBucket,
+}
+
+// dagBuckets are the buckets emptied by Clear. The app config, the chain
+// changes and the id sequences are kept, as the PostgreSQL storage keeps them.
+var dagBuckets = [][]byte{
+	blocksBucket, blockHashesBucket, blockIDsBucket, edgesBucket, childrenBucket, heightGroupsBucket,
+	mergeSetsBucket, tipsBucket, missingParentsBucket, missingParentsByHashBucket, headersBucket,
+	ghostdagDataBucket, difficultySamplesBucket, transactionAcceptancesBucket, transactionSummariesBucket,
+	transactionIDsBucket, minersBucket, resyncCheckpointBucket,
+}
+
+// blockIDDataBuckets are the buckets of block data keyed by block id alone
+var blockIDDataBuckets = [][]byte{headersBucket, ghostdagDataBucket, tipsBucket, transactionSummariesBucket, minersBucket}
+
+// Sequences of the ids assigned by the storage
+var (
+	blockIDSequence       = []byte("block_id")
+	chainChangeIDSequence = []byte("chain_change_id")
+)
+
+var singletonKey = []byte("row")
+
+// uint64Key returns the key made of `values`
+func uint64Key(values ...uint64) []byte {
+	key := make([]byte, 8*len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint64(key[8*i:], value)
+	}
+	return key
+}
+
+// keyUint64 returns the `i`th value of the key made by uint64Key
+func keyUint64(key []byte, i int) uint64 {
+	return binary.BigEndian.Uint64(key[8*i:])
+}
+
+// blockKey returns the key of the block `id` at `height`
+func blockKey(height uint64, id uint64) []byte {
+	return uint64Key(height, id)
+}
+
+// transactionKey returns the key of the transaction `transactionIndex`
+// following `prefix`
+func transactionKey(prefix []byte, transactionIndex uint32) []byte {
+	key := make([]byte, len(prefix)+4)
+	copy(key, prefix)
+	binary.BigEndian.PutUint32(key[len(prefix):], transactionIndex)
+	return key
+}
+
+// putRow stores `row` under `key` in `bucket`
+func putRow(tx *transaction, bucket []byte, key []byte, row interface{}) error {
+	value, err := json.Marshal(row)
+	if err != nil {
+		return errors.Wrapf(err, "could not encode a row of %s", bucket)
+	}
+	return tx.tx.Bucket(bucket).Put(key, value)
+}
+
+// getRow decodes the row `key` of `bucket` into `row`. Returns false if
+// there is no such row.
+func getRow(tx *transaction, bucket []byte, key []byte, row interface{}) (bool, error) {
+	value := tx.tx.Bucket(bucket).Get(key)
+	if value == nil {
+		return false, nil
+	}
+	return true, decodeRow(bucket, value, row)
+}
+
+// decodeRow decodes the row `value` of `bucket` into `row`
+func decodeRow(bucket []byte, value []byte, row interface{}) error {
+	err := json.Unmarshal(value, row)
+	if err != nil {
+		return errors.Wrapf(err, "could not decode a row of %s", bucket)
+	}
+	return nil
+}
+
+// hasRow returns whether `bucket` has a row `key`
+func hasRow(tx *transaction, bucket []byte, key []byte) bool {
+	return tx.tx.Bucket(bucket).Get(key) != nil
+}
+
+// insertNew stores the rows of `rows` keyed by `key` within `tx`, keeping
+// the rows already stored, like an INSERT ... ON CONFLICT DO NOTHING
+func insertNew[T any](tx *transaction, bucket []byte, rows []*T, key func(row *T) []byte) error {
+	for _, row := range rows {
+		rowKey := key(row)
+		if hasRow(tx, bucket, rowKey) {
+			continue
+		}
+		err := putRow(tx, bucket, rowKey, row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachWithPrefix calls `f` with the rows of `bucket` whose key starts
+// with `prefix`, in key order. `f` must not change the bucket.
+func forEachWithPrefix(tx *transaction, bucket []byte, prefix []byte, f func(key []byte, value []byte) error) error {
+	cursor := tx.tx.Bucket(bucket).Cursor()
+	for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+		err := f(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keysWithPrefix returns the keys of the rows of `bucket` starting with `prefix`
+func keysWithPrefix(tx *transaction, bucket []byte, prefix []byte) ([][]byte, error) {
+	keys := make([][]byte, 0)
+	err := forEachWithPrefix(tx, bucket, prefix, func(key []byte, _ []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	return keys, err
+}
+
+// deleteKeys removes the rows `keys` of `bucket`
+func deleteKeys(tx *transaction, bucket []byte, keys [][]byte) error {
+	for _, key := range keys {
+		err := tx.tx.Bucket(bucket).Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteMatchingKeys removes the rows of `bucket` whose key matches `isMatching`
+func deleteMatchingKeys(tx *transaction, bucket []byte, isMatching func(key []byte) bool) error {
+	keys := make([][]byte, 0)
+	err := tx.tx.Bucket(bucket).ForEach(func(key []byte, _ []byte) error {
+		if isMatching(key) {
+			keys = append(keys, append([]byte{}, key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return deleteKeys(tx, bucket, keys)
+}
+
+// deleteWithPrefix removes the rows of `bucket` whose key starts with `prefix`
+func deleteWithPrefix(tx *transaction, bucket []byte, prefix []byte) error {
+	keys, err := keysWithPrefix(tx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	return deleteKeys(tx, bucket, keys)
+}
+
+// nextID returns the next id of `sequence`. Ids start at 1.
+func nextID(tx *transaction, sequence []byte) (uint64, error) {
+	bucket := tx.tx.Bucket(sequencesBucket)
+	id := uint64(1)
+	if value := bucket.Get(sequence); value != nil {
+		id = binary.BigEndian.Uint64(value) + 1
+	}
+	err := bucket.Put(sequence, uint64Key(id))
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// createBuckets creates the buckets missing from `tx`
+func createBuckets(tx *bolt.Tx, buckets [][]byte) error {
+	for _, bucket := range buckets {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return errors.Wrapf(err, "could not create bucket %s", bucket)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package embedded
+
+import (
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// InsertBlocks inserts `blocks`, ordered so that a parent always precedes its
+// children, with their edges and height groups. The blocks are inserted one at
+// a time, which yields the rows of the bulk PostgreSQL insert.
+func (s *Storage) InsertBlocks(databaseTransaction database.Transaction, blocks []*database.BulkBlock) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	existingBlocks := make([]*database.BulkBlock, 0)
+	seen := make(map[externalapi.DomainHash]bool)
+	for _, block := range blocks {
+		if seen[*block.Hash] {
+			continue
+		}
+		seen[*block.Hash] = true
+		if hasRow(tx, blockHashesBucket, []byte(block.Hash.String())) {
+			existingBlocks = append(existingBlocks, block)
+			continue
+		}
+		err = s.insertBulkBlock(tx, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Blocks already stored only get their selected parent and merge sets updated
+	for _, block := range existingBlocks {
+		log.Debugf("Block %s already exists in database; not processed", block.Hash)
+		if block.IsHeaderOnly {
+			continue
+		}
+		storedBlock, err := s.blockByHash(tx, block.Hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for block %s", block.Hash)
+		}
+		if block.SelectedParentHash != nil {
+			selectedParent, err := s.blockByHash(tx, block.SelectedParentHash)
+			if err == nil {
+				err = s.updateBlockSelectedParent(tx, storedBlock.ID, selectedParent.ID)
+				if err != nil {
+					return errors.Wrapf(err, "Could not update selected parent for block %s", block.Hash)
+				}
+			}
+		}
+		mergeSetRedIDs, mergeSetBlueIDs := s.bulkMergeSetIDs(tx, block)
+		err = s.updateBlockMergeSet(tx, storedBlock.ID, mergeSetRedIDs, mergeSetBlueIDs)
+		if err != nil {
+			return errors.Wrapf(err, "Could not update merge sets colors for block %s", block.Hash)
+		}
+	}
+	return nil
+}
+
+// insertBulkBlock inserts the new block `block` with its edges, height group
+// and, if all its parents are known, its selected parent and merge set
+func (s *Storage) insertBulkBlock(tx *transaction, block *database.BulkBlock) error {
+	parents := make([]*model.Block, 0, len(block.ParentHashes))
+	parentIndexes := make([]uint32, 0, len(block.ParentHashes))
+	missingParents := make([]*model.MissingParent, 0)
+	isIncomplete := false
+	height := uint64(0)
+	for parentIndex, parentHash := range block.ParentHashes {
+		parent, ok, err := s.blockByIndex(tx, blockHashesBucket, []byte(parentHash.String()))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Warnf("Parent %s for block %s does not exist in the database", parentHash, block.Hash)
+			isIncomplete = true
+			missingParents = append(missingParents, &model.MissingParent{
+				ParentHash:  parentHash.String(),
+				ParentIndex: uint32(parentIndex),
+			})
+			continue
+		}
+		parents = append(parents, parent)
+		parentIndexes = append(parentIndexes, uint32(parentIndex))
+		if parent.Height+1 > height {
+			height = parent.Height + 1
+		}
+	}
+
+	heightGroup := &model.HeightGroup{Height: height}
+	_, err := getRow(tx, heightGroupsBucket, uint64Key(height), heightGroup)
+	if err != nil {
+		return err
+	}
+	heightGroupIndex := heightGroup.Size
+	heightGroup.Size++
+	err = putRow(tx, heightGroupsBucket, uint64Key(height), heightGroup)
+	if err != nil {
+		return errors.Wrapf(err, "Could not insert or update height group %d", height)
+	}
+
+	databaseBlock := &model.Block{
+		BlockHash:                      block.Hash.String(),
+		Timestamp:                      block.Timestamp,
+		Height:                         height,
+		HeightGroupIndex:               heightGroupIndex,
+		SelectedParentID:               nil,
+		Color:                          model.ColorGray,
+		IsInVirtualSelectedParentChain: false,
+		DAAScore:                       block.DAAScore,
+		BlueScore:                      block.BlueScore,
+		BlueWork:                       block.BlueWork,
+		ReceivedAt:                     block.ReceivedAt,
+	}
+	var mergeSetRedIDs, mergeSetBlueIDs []uint64
+	hasVerboseData := !block.IsHeaderOnly && !isIncomplete
+	if hasVerboseData {
+		if block.SelectedParentHash != nil {
+			key := tx.tx.Bucket(blockHashesBucket).Get([]byte(block.SelectedParentHash.String()))
+			if key != nil {
+				selectedParentID := keyUint64(key, 1)
+				databaseBlock.SelectedParentID = &selectedParentID
+			}
+		}
+		mergeSetRedIDs, mergeSetBlueIDs = s.bulkMergeSetIDs(tx, block)
+	}
+	err = s.insertBlock(tx, databaseBlock)
+	if err != nil {
+		return errors.Wrapf(err, "Could not insert block %s", block.Hash)
+	}
+
+	for i, parent := range parents {
+		err = s.insertEdge(tx, &model.Edge{
+			FromBlockID:          databaseBlock.ID,
+			ToBlockID:            parent.ID,
+			FromHeight:           databaseBlock.Height,
+			ToHeight:             parent.Height,
+			FromHeightGroupIndex: databaseBlock.HeightGroupIndex,
+			ToHeightGroupIndex:   parent.HeightGroupIndex,
+			ParentIndex:          parentIndexes[i],
+		})
+		if err != nil {
+			return errors.Wrapf(err, "Could not insert edge for block %s", block.Hash)
+		}
+	}
+	for _, missingParent := range missingParents {
+		missingParent.BlockID = databaseBlock.ID
+	}
+	err = s.insertMissingParents(tx, missingParents)
+	if err != nil {
+		return errors.Wrapf(err, "Could not record the missing parents of block %s", block.Hash)
+	}
+	if !hasVerboseData {
+		return nil
+	}
+	return s.insertBlockMergeSet(tx, databaseBlock.ID, mergeSetRedIDs, mergeSetBlueIDs)
+}
+
+// bulkMergeSetIDs returns the ids of the merge set reds and blues of `block`.
+// Merge set blocks missing from the database are logged and left out.
+func (s *Storage) bulkMergeSetIDs(tx *transaction, block *database.BulkBlock) (mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64) {
+	mergeSetRedIDs, missingReds := storedBlockIDs(tx, block.MergeSetRedHashes)
+	if len(missingReds) > 0 {
+		log.Errorf("Could not get ids of merge set reds for block %s: %s", block.Hash, missingReds)
+	}
+	mergeSetBlueIDs, missingBlues := storedBlockIDs(tx, block.MergeSetBlueHashes)
+	if len(missingBlues) > 0 {
+		log.Errorf("Could not get ids of merge set blues for block %s: %s", block.Hash, missingBlues)
+	}
+	return mergeSetRedIDs, mergeSetBlueIDs
+}
+
+// storedBlockIDs returns the ids of the stored blocks of `blockHashes`, and
+// the hashes of the blocks not stored
+func storedBlockIDs(tx *transaction, blockHashes []*externalapi.DomainHash) ([]uint64, []*externalapi.DomainHash) {
+	blockIDs := make([]uint64, 0, len(blockHashes))
+	missingHashes := make([]*externalapi.DomainHash, 0)
+	for _, blockHash := range blockHashes {
+		key := tx.tx.Bucket(blockHashesBucket).Get([]byte(blockHash.String()))
+		if key == nil {
+			missingHashes = append(missingHashes, blockHash)
+			continue
+		}
+		blockIDs = append(blockIDs, keyUint64(key, 1))
+	}
+	return blockIDs, missingHashes
+}
@@ -0,0 +1,260 @@
+package embedded
+
+import (
+	"sort"
+
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+)
+
+// Clear removes the DAG and its block data. The app config, the chain
+// changes and the id sequences are kept, as the PostgreSQL storage keeps them.
+func (s *Storage) Clear(databaseTransaction database.Transaction) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range dagBuckets {
+		err = tx.tx.DeleteBucket(bucket)
+		if err != nil {
+			return err
+		}
+	}
+	return createBuckets(tx.tx, dagBuckets)
+}
+
+// deleteBlockData deletes the block data of the blocks `blocks`, whose ids
+// are `blockIDs`
+func (s *Storage) deleteBlockData(tx *transaction, blocks []*model.Block, blockIDs map[uint64]bool) error {
+	for _, block := range blocks {
+		for _, bucket := range blockIDDataBuckets {
+			err := tx.tx.Bucket(bucket).Delete(uint64Key(block.ID))
+			if err != nil {
+				return err
+			}
+		}
+		err := deleteWithPrefix(tx, transactionIDsBucket, uint64Key(block.ID))
+		if err != nil {
+			return err
+		}
+		err = s.deleteMissingParents(tx, block.ID)
+		if err != nil {
+			return err
+		}
+		sample := &model.DifficultySample{}
+		ok, err := getRow(tx, difficultySamplesBucket, uint64Key(block.DAAScore), sample)
+		if err != nil {
+			return err
+		}
+		if ok && sample.BlockID == block.ID {
+			err = tx.tx.Bucket(difficultySamplesBucket).Delete(uint64Key(block.DAAScore))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return deleteMatchingKeys(tx, transactionAcceptancesBucket, func(key []byte) bool { return blockIDs[keyUint64(key, 1)] })
+}
+
+func (s *Storage) StoreAppConfig(databaseTransaction database.Transaction, appConfig *model.AppConfig) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	row := *appConfig
+	row.ID = true
+	return putRow(tx, appConfigBucket, singletonKey, &row)
+}
+
+// GetResyncCheckpoint returns the resync checkpoint, or nil if there is none
+func (s *Storage) GetResyncCheckpoint(databaseTransaction database.Transaction) (*model.ResyncCheckpoint, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &model.ResyncCheckpoint{}
+	ok, err := getRow(tx, resyncCheckpointBucket, singletonKey, checkpoint)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (s *Storage) StoreResyncCheckpoint(databaseTransaction database.Transaction, checkpoint *model.ResyncCheckpoint) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	row := *checkpoint
+	row.ID = true
+	return putRow(tx, resyncCheckpointBucket, singletonKey, &row)
+}
+
+func (s *Storage) InsertChainChange(databaseTransaction database.Transaction, chainChange *model.ChainChange) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	id, err := nextID(tx, chainChangeIDSequence)
+	if err != nil {
+		return err
+	}
+	chainChange.ID = id
+	return putRow(tx, chainChangesBucket, uint64Key(id), chainChange)
+}
+
+func (s *Storage) InsertBlockHeaders(databaseTransaction database.Transaction, headers []*model.BlockHeader) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	return insertNew(tx, headersBucket, headers, func(header *model.BlockHeader) []byte { return uint64Key(header.BlockID) })
+}
+
+func (s *Storage) InsertBlocksGHOSTDAGData(databaseTransaction database.Transaction, ghostdagData []*model.BlockGHOSTDAGData) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	return insertNew(tx, ghostdagDataBucket, ghostdagData, func(data *model.BlockGHOSTDAGData) []byte {
+		return uint64Key(data.BlockID)
+	})
+}
+
+// BlocksWithoutGHOSTDAGData returns the id and hash of at most `limit` blocks
+// with an id greater than `afterBlockID`, a DAA score of at least
+// `minDAAScore` and no GHOSTDAG data, ordered by id
+func (s *Storage) BlocksWithoutGHOSTDAGData(databaseTransaction database.Transaction, afterBlockID uint64, minDAAScore uint64,
+	limit int) ([]*model.Block, error) {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]*model.Block, 0)
+	cursor := tx.tx.Bucket(blockIDsBucket).Cursor()
+	for key, _ := cursor.Seek(uint64Key(afterBlockID + 1)); key != nil && len(blocks) < limit; key, _ = cursor.Next() {
+		if hasRow(tx, ghostdagDataBucket, key) {
+			continue
+		}
+		block, _, err := s.blockByID(tx, keyUint64(key, 0))
+		if err != nil {
+			return nil, err
+		}
+		if block.DAAScore >= minDAAScore {
+			blocks = append(blocks, &model.Block{ID: block.ID, BlockHash: block.BlockHash})
+		}
+	}
+	return blocks, nil
+}
+
+func (s *Storage) InsertDifficultySamples(databaseTransaction database.Transaction, samples []*model.DifficultySample) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	return insertNew(tx, difficultySamplesBucket, samples, func(sample *model.DifficultySample) []byte {
+		return uint64Key(sample.DAAScore)
+	})
+}
+
+// DifficultySamplesBetweenDAAScores returns the difficulty samples with a DAA
+// score between `lowDAAScore` and `highDAAScore` inclusive, ordered by DAA score
+func (s *Storage) DifficultySamplesBetweenDAAScores(databaseTransaction database.Transaction,
+	lowDAAScore uint64, highDAAScore uint64) ([]*model.DifficultySample, error) {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]*model.DifficultySample, 0)
+	cursor := tx.tx.Bucket(difficultySamplesBucket).Cursor()
+	for key, value := cursor.Seek(uint64Key(lowDAAScore)); key != nil && keyUint64(key, 0) <= highDAAScore; key, value = cursor.Next() {
+		sample := &model.DifficultySample{}
+		err = decodeRow(difficultySamplesBucket, value, sample)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func (s *Storage) InsertTransactionAcceptances(databaseTransaction database.Transaction,
+	acceptances []*model.TransactionAcceptance) error {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	return insertNew(tx, transactionAcceptancesBucket, acceptances, func(acceptance *model.TransactionAcceptance) []byte {
+		return transactionKey(uint64Key(acceptance.AcceptingBlockID, acceptance.BlockID), acceptance.TransactionIndex)
+	})
+}
+
+func (s *Storage) DeleteTransactionAcceptances(databaseTransaction database.Transaction, acceptingBlockIDs []uint64) error {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	for _, acceptingBlockID := range acceptingBlockIDs {
+		err = deleteWithPrefix(tx, transactionAcceptancesBucket, uint64Key(acceptingBlockID))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) InsertBlockTransactions(databaseTransaction database.Transaction, summaries []*model.BlockTransactionSummary,
+	transactionIDs []*model.BlockTransactionID, miners []*model.BlockMiner) error {
+
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return err
+	}
+	err = insertNew(tx, transactionSummariesBucket, summaries, func(summary *model.BlockTransactionSummary) []byte {
+		return uint64Key(summary.BlockID)
+	})
+	if err != nil {
+		return err
+	}
+	err = insertNew(tx, transactionIDsBucket, transactionIDs, func(transactionID *model.BlockTransactionID) []byte {
+		return transactionKey(uint64Key(transactionID.BlockID), transactionID.TransactionIndex)
+	})
+	if err != nil {
+		return err
+	}
+	return insertNew(tx, minersBucket, miners, func(miner *model.BlockMiner) []byte { return uint64Key(miner.BlockID) })
+}
+
+// GetBlocksTransactionIDs returns the transaction ids of the blocks
+// `blockIDs`, ordered by block id and transaction index
+func (s *Storage) GetBlocksTransactionIDs(databaseTransaction database.Transaction, blockIDs []uint64) ([]*model.BlockTransactionID, error) {
+	tx, err := s.transaction(databaseTransaction)
+	if err != nil {
+		return nil, err
+	}
+	sortedBlockIDs := make([]uint64, 0, len(blockIDs))
+	isAdded := make(map[uint64]bool, len(blockIDs))
+	for _, blockID := range blockIDs {
+		if !isAdded[blockID] {
+			isAdded[blockID] = true
+			sortedBlockIDs = append(sortedBlockIDs, blockID)
+		}
+	}
+	sort.Slice(sortedBlockIDs, func(i, j int) bool { return sortedBlockIDs[i] < sortedBlockIDs[j] })
+
+	transactionIDs := make([]*model.BlockTransactionID, 0)
+	for _, blockID := range sortedBlockIDs {
+		err = forEachWithPrefix(tx, transactionIDsBucket, uint64Key(blockID), func(_ []byte, value []byte) error {
+			transactionID := &model.BlockTransactionID{}
+			transactionIDs = append(transactionIDs, transactionID)
+			return decodeRow(transactionIDsBucket, value, transactionID)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return transactionIDs, nil
+}
@@ -0,0 +1,203 @@
+package embedded
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/logging"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var log = logging.Logger()
+
+// openTimeout bounds the wait for the lock of a storage file held by
+// another process
+const openTimeout = 10 * time.Second
+
+// compactionTxMaxSize is the maximum size of a transaction of the compaction
+const compactionTxMaxSize = 64 * 1024 * 1024
+
+// Storage is a database.Storage keeping the DAG in a bbolt file. A
+// transaction is a bbolt read-write transaction, synced to the file when
+// committed. Dropping height partitions compacts the file once committed,
+// so that the space of the dropped blocks is given back.
+type Storage struct {
+	path string
+	db   *bolt.DB
+
+	// failure is set once the file could not be reopened after a
+	// compaction. The storage refuses all transactions from then on.
+	failure error
+
+	// isInterrupted is set by Interrupt. The operations of the transaction
+	// in flight and the following transactions fail from then on.
+	isInterrupted uint32
+
+	sync.Mutex
+}
+
+var _ database.Storage = (*Storage)(nil)
+
+// transaction is a transaction of the embedded storage
+type transaction struct {
+	database.TransactionBase
+	tx       *bolt.Tx
+	isClosed bool
+
+	// isCompactionNeeded is set once rows were dropped in bulk
+	isCompactionNeeded bool
+}
+
+// Open opens the storage kept in the file at `path`, creating it if needed
+func Open(path string) (*Storage, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		path: path,
+		db:   db,
+	}, nil
+}
+
+func openDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open the embedded storage %s", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return createBuckets(tx, allBuckets)
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// RunInTransaction runs `transactionFunction` in a transaction, committed if
+// it returns nil and rolled back otherwise. Transactions run one at a time.
+func (s *Storage) RunInTransaction(transactionFunction func(database.Transaction) error) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.failure != nil {
+		return errors.Wrapf(s.failure, "the embedded storage is unusable")
+	}
+	if atomic.LoadUint32(&s.isInterrupted) == 1 {
+		return errors.New("the embedded storage is interrupted")
+	}
+	var tx *transaction
+	err := s.db.Update(func(boltTx *bolt.Tx) error {
+		tx = &transaction{tx: boltTx}
+		defer func() { tx.isClosed = true }()
+		return transactionFunction(tx)
+	})
+	if err != nil {
+		return err
+	}
+	if tx.isCompactionNeeded {
+		s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the storage file without its free pages. The file is
+// compacted next to the storage file and renamed over it, so that a crash
+// leaves either file intact. A failed compaction keeps the storage file.
+func (s *Storage) compact() {
+	temporaryPath := s.path + ".compact"
+	defer os.Remove(temporaryPath)
+
+	err := s.compactTo(temporaryPath)
+	if err != nil {
+		log.Warnf("Could not compact the embedded storage %s: %s", s.path, err)
+		return
+	}
+	err = s.db.Close()
+	if err != nil {
+		log.Warnf("Could not close the embedded storage %s before replacing it: %s", s.path, err)
+	}
+	err = os.Rename(temporaryPath, s.path)
+	if err == nil {
+		err = syncDirectory(filepath.Dir(s.path))
+	}
+	if err != nil {
+		log.Warnf("Could not replace the embedded storage %s by its compaction: %s", s.path, err)
+	}
+	s.db, err = openDB(s.path)
+	if err != nil {
+		s.failure = errors.Wrapf(err, "could not reopen the embedded storage after its compaction")
+	}
+}
+
+func (s *Storage) compactTo(path string) error {
+	compacted, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = bolt.Compact(compacted, s.db, compactionTxMaxSize)
+	closeErr := compacted.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return errors.WithStack(err)
+}
+
+func syncDirectory(path string) error {
+	directory, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer directory.Close()
+	return errors.WithStack(directory.Sync())
+}
+
+// transaction returns the embedded transaction `databaseTransaction`
+func (s *Storage) transaction(databaseTransaction database.Transaction) (*transaction, error) {
+	tx, ok := databaseTransaction.(*transaction)
+	if !ok {
+		return nil, errors.Errorf("%T is not a transaction of the embedded storage", databaseTransaction)
+	}
+	if tx.isClosed {
+		return nil, errors.New("the transaction is closed")
+	}
+	if atomic.LoadUint32(&s.isInterrupted) == 1 {
+		return nil, errors.New("the embedded storage is interrupted")
+	}
+	return tx, nil
+}
+
+// LoadCache does nothing: the embedded storage has no cache to load
+func (s *Storage) LoadCache(databaseTransaction database.Transaction, minHeight uint64) error {
+	_, err := s.transaction(databaseTransaction)
+	return err
+}
+
+// Interrupt makes the operations of the transaction in flight and the
+// following transactions fail
+func (s *Storage) Interrupt() {
+	atomic.StoreUint32(&s.isInterrupted, 1)
+}
+
+func (s *Storage) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.failure != nil {
+		return
+	}
+	err := s.db.Close()
+	if err != nil {
+		log.Warnf("Could not close the embedded storage: %s", err)
+	}
+}
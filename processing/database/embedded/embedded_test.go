@@ -0,0 +1,288 @@
+package embedded
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+func testBlockHash(hashByte byte) *externalapi.DomainHash {
+	return externalapi.NewDomainHashFromByteArray(&[externalapi.DomainHashSize]byte{hashByte})
+}
+
+func openTestStorage(t *testing.T, path string) *Storage {
+	t.Helper()
+
+	storage, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	return storage
+}
+
+// insertTestBlock inserts the block `hashByte` in its own transaction and
+// returns its id
+func insertTestBlock(t *testing.T, storage *Storage, hashByte byte) uint64 {
+	t.Helper()
+
+	var blockID uint64
+	err := storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+		err := storage.InsertBlocks(databaseTransaction, []*database.BulkBlock{{Hash: testBlockHash(hashByte)}})
+		if err != nil {
+			return err
+		}
+		blockID, err = storage.BlockIDByHash(databaseTransaction, testBlockHash(hashByte))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("InsertBlocks: %s", err)
+	}
+	return blockID
+}
+
+func doesTestBlockExist(t *testing.T, storage *Storage, hashByte byte) bool {
+	t.Helper()
+
+	var blockExists bool
+	err := storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+		var err error
+		blockExists, err = storage.DoesBlockExist(databaseTransaction, testBlockHash(hashByte))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("DoesBlockExist: %s", err)
+	}
+	return blockExists
+}
+
+func TestRunInTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		// transactionFunction runs after inserting block 1 in the transaction
+		transactionFunction func() error
+		isCommitted         bool
+	}{
+		{
+			name:                "commit",
+			transactionFunction: func() error { return nil },
+			isCommitted:         true,
+		},
+		{
+			name:                "rollback on error",
+			transactionFunction: func() error { return errors.New("failure") },
+		},
+		{
+			name:                "rollback on panic",
+			transactionFunction: func() error { panic("failure") },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.db")
+			storage := openTestStorage(t, path)
+
+			func() {
+				defer func() { _ = recover() }()
+				_ = storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+					err := storage.InsertBlocks(databaseTransaction, []*database.BulkBlock{{Hash: testBlockHash(1)}})
+					if err != nil {
+						t.Fatalf("InsertBlocks: %s", err)
+					}
+					return test.transactionFunction()
+				})
+			}()
+			if blockExists := doesTestBlockExist(t, storage, 1); blockExists != test.isCommitted {
+				t.Errorf("block exists: got %t, want %t", blockExists, test.isCommitted)
+			}
+			// A rolled back transaction gives its block id back
+			wantID := uint64(1)
+			if test.isCommitted {
+				wantID = 2
+			}
+			if id := insertTestBlock(t, storage, 2); id != wantID {
+				t.Errorf("next block id: got %d, want %d", id, wantID)
+			}
+			storage.Close()
+
+			storage = openTestStorage(t, path)
+			defer storage.Close()
+			if blockExists := doesTestBlockExist(t, storage, 1); blockExists != test.isCommitted {
+				t.Errorf("block exists after reopening: got %t, want %t", blockExists, test.isCommitted)
+			}
+			if !doesTestBlockExist(t, storage, 2) {
+				t.Errorf("block 2 does not exist after reopening")
+			}
+		})
+	}
+}
+
+func TestDropHeightPartitionsBelow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.db")
+	storage := openTestStorage(t, path)
+	defer storage.Close()
+
+	// The blocks 0 to 1999 fill the first height partition, the block 2000
+	// starts the second one
+	const droppedCount = 2000
+	err := storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+		tx, err := storage.transaction(databaseTransaction)
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i <= droppedCount; i++ {
+			height := i
+			if i == droppedCount {
+				height = database.HeightPartitionSize
+			}
+			hash := externalapi.NewDomainHashFromByteArray(&[externalapi.DomainHashSize]byte{byte(i), byte(i >> 8)})
+			err = storage.insertBlock(tx, &model.Block{BlockHash: hash.String(), Height: height, Color: model.ColorGray})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("insertBlock: %s", err)
+	}
+	sizeBefore := fileSize(t, path)
+
+	for _, test := range []struct {
+		height           uint64
+		wantDroppedBelow uint64
+	}{
+		{height: database.HeightPartitionSize - 1, wantDroppedBelow: 0},
+		{height: database.HeightPartitionSize + 1, wantDroppedBelow: database.HeightPartitionSize},
+		{height: database.HeightPartitionSize + 1, wantDroppedBelow: 0},
+	} {
+		var droppedBelow uint64
+		err = storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+			var err error
+			droppedBelow, err = storage.DropHeightPartitionsBelow(databaseTransaction, test.height)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("DropHeightPartitionsBelow: %s", err)
+		}
+		if droppedBelow != test.wantDroppedBelow {
+			t.Errorf("dropped below height %d: got %d, want %d", test.height, droppedBelow, test.wantDroppedBelow)
+		}
+	}
+
+	if sizeAfter := fileSize(t, path); sizeAfter >= sizeBefore {
+		t.Errorf("file size: got %d after dropping, want less than %d", sizeAfter, sizeBefore)
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("the compaction left its file behind: %v", err)
+	}
+	err = storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+		maxHeight, err := storage.MaxBlockHeight(databaseTransaction)
+		if err != nil {
+			return err
+		}
+		if maxHeight != database.HeightPartitionSize {
+			t.Errorf("max block height: got %d, want %d", maxHeight, uint64(database.HeightPartitionSize))
+		}
+		lowestHeight, _, err := storage.LowestBlockHeightSince(databaseTransaction, 0)
+		if err != nil {
+			return err
+		}
+		if lowestHeight != database.HeightPartitionSize {
+			t.Errorf("lowest block height: got %d, want %d", lowestHeight, uint64(database.HeightPartitionSize))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("the storage is unusable after its compaction: %s", err)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestLateParentEdges(t *testing.T) {
+	storage := openTestStorage(t, filepath.Join(t.TempDir(), "storage.db"))
+	defer storage.Close()
+
+	// The child 2 of the blocks 1 and 3 is stored before its parent 3
+	insertTestBlock(t, storage, 1)
+	for _, block := range []*database.BulkBlock{
+		{Hash: testBlockHash(2), ParentHashes: []*externalapi.DomainHash{testBlockHash(1), testBlockHash(3)}},
+		{Hash: testBlockHash(3), ParentHashes: []*externalapi.DomainHash{testBlockHash(1)}},
+	} {
+		err := storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+			err := storage.InsertBlocks(databaseTransaction, []*database.BulkBlock{block})
+			if err != nil {
+				return err
+			}
+			blockID, err := storage.BlockIDByHash(databaseTransaction, block.Hash)
+			if err != nil {
+				return err
+			}
+			return storage.UpdateTips(databaseTransaction, []uint64{blockID})
+		})
+		if err != nil {
+			t.Fatalf("InsertBlocks: %s", err)
+		}
+	}
+
+	err := storage.RunInTransaction(func(databaseTransaction database.Transaction) error {
+		tx, err := storage.transaction(databaseTransaction)
+		if err != nil {
+			return err
+		}
+		childID, err := storage.BlockIDByHash(databaseTransaction, testBlockHash(2))
+		if err != nil {
+			return err
+		}
+		for parentIndex, parentHash := range []*externalapi.DomainHash{testBlockHash(1), testBlockHash(3)} {
+			parentID, err := storage.BlockIDByHash(databaseTransaction, parentHash)
+			if err != nil {
+				return err
+			}
+			edge := &model.Edge{}
+			ok, err := getRow(tx, edgesBucket, uint64Key(childID, parentID), edge)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				t.Fatalf("no edge to parent %d", parentIndex)
+			}
+			if edge.ParentIndex != uint32(parentIndex) {
+				t.Errorf("parent index of parent %s: got %d, want %d", parentHash, edge.ParentIndex, parentIndex)
+			}
+			if !hasRow(tx, childrenBucket, uint64Key(parentID, childID)) {
+				t.Errorf("the child is not indexed as a child of parent %d", parentIndex)
+			}
+		}
+		if missingParentCount := tx.tx.Bucket(missingParentsBucket).Stats().KeyN; missingParentCount != 0 {
+			t.Errorf("missing parents: got %d, want none", missingParentCount)
+		}
+		lateParentID, err := storage.BlockIDByHash(databaseTransaction, testBlockHash(3))
+		if err != nil {
+			return err
+		}
+		if hasRow(tx, tipsBucket, uint64Key(lateParentID)) {
+			t.Errorf("the late parent is a tip")
+		}
+		if !hasRow(tx, tipsBucket, uint64Key(childID)) {
+			t.Errorf("the child is not a tip")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
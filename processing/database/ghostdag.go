@@ -0,0 +1,43 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/pkg/errors"
+)
+
+// InsertBlocksGHOSTDAGData stores the GHOSTDAG data of blocks.
+// Data already stored for a block is kept as it is.
+func (db *Database) InsertBlocksGHOSTDAGData(databaseTransaction *pg.Tx, ghostdagData []*model.BlockGHOSTDAGData) error {
+	return insertRows(databaseTransaction, ghostdagData, "DO NOTHING", "GHOSTDAG data rows")
+}
+
+// GetBlockGHOSTDAGData returns the GHOSTDAG data of the block `blockID`.
+// Returns nil if the GHOSTDAG data of the block is not stored.
+func (db *Database) GetBlockGHOSTDAGData(databaseTransaction *pg.Tx, blockID uint64) (*model.BlockGHOSTDAGData, error) {
+	result := new(model.BlockGHOSTDAGData)
+	_, err := databaseTransaction.QueryOne(result, "SELECT * FROM block_ghostdag_data WHERE block_id = ?", blockID)
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BlocksWithoutGHOSTDAGData returns the id and hash of at most `limit` blocks
+// with an id greater than `afterBlockID`, a DAA score of at least
+// `minDAAScore` and no GHOSTDAG data, ordered by id
+func (db *Database) BlocksWithoutGHOSTDAGData(databaseTransaction *pg.Tx, afterBlockID uint64, minDAAScore uint64,
+	limit int) ([]*model.Block, error) {
+
+	var results []*model.Block
+	_, err := databaseTransaction.Query(&results, "SELECT id, block_hash FROM block_nodes WHERE id > ? AND daa_score >= ? "+
+		"AND NOT EXISTS (SELECT 1 FROM block_ghostdag_data WHERE block_id = block_nodes.id) ORDER BY id LIMIT ?",
+		afterBlockID, minDAAScore, limit)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
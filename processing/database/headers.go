@@ -0,0 +1,38 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// InsertBlockHeaders stores block headers.
+// Headers already stored for a block are kept as they are.
+func (db *Database) InsertBlockHeaders(databaseTransaction *pg.Tx, headers []*model.BlockHeader) error {
+	return insertRows(databaseTransaction, headers, "DO NOTHING", "block headers")
+}
+
+// GetBlockHeader returns the header of the block `blockID`.
+// Returns nil if the header of the block is not stored.
+func (db *Database) GetBlockHeader(databaseTransaction *pg.Tx, blockID uint64) (*model.BlockHeader, error) {
+	result := new(model.BlockHeader)
+	_, err := databaseTransaction.QueryOne(result, "SELECT * FROM block_headers WHERE block_id = ?", blockID)
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetBlockHeaderByHash returns the header of the block identified by `blockHash`.
+// Returns nil if the header of the block is not stored.
+func (db *Database) GetBlockHeaderByHash(databaseTransaction *pg.Tx, blockHash *externalapi.DomainHash) (*model.BlockHeader, error) {
+	blockID, err := db.BlockIDByHash(databaseTransaction, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetBlockHeader(databaseTransaction, blockID)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+)
+
+// mergeSetRows returns the merge set relations of the chain block `blockID`
+func mergeSetRows(blockID uint64, mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64) []*model.BlockMergeSet {
+	rows := make([]*model.BlockMergeSet, 0, len(mergeSetRedIDs)+len(mergeSetBlueIDs))
+	for i, redID := range mergeSetRedIDs {
+		rows = append(rows, &model.BlockMergeSet{
+			ChainBlockID:  blockID,
+			MergedBlockID: redID,
+			Color:         model.ColorRed,
+			MergeSetIndex: uint32(i),
+		})
+	}
+	for i, blueID := range mergeSetBlueIDs {
+		rows = append(rows, &model.BlockMergeSet{
+			ChainBlockID:  blockID,
+			MergedBlockID: blueID,
+			Color:         model.ColorBlue,
+			MergeSetIndex: uint32(i),
+		})
+	}
+	return rows
+}
+
+// insertBlockMergeSets stores merge set relations.
+// Relations already stored are kept as they are.
+func (db *Database) insertBlockMergeSets(databaseTransaction *pg.Tx, mergeSets []*model.BlockMergeSet) error {
+	return insertRows(databaseTransaction, mergeSets, "DO NOTHING", "merge set relations")
+}
+
+// UpdateBlockMergeSet replaces the merge set of the block `blockID`
+func (db *Database) UpdateBlockMergeSet(
+	databaseTransaction *pg.Tx, blockID uint64, mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64) error {
+
+	_, err := databaseTransaction.Exec("DELETE FROM block_merge_sets WHERE chain_block_id = ?", blockID)
+	if err != nil {
+		return err
+	}
+	return db.insertBlockMergeSets(databaseTransaction, mergeSetRows(blockID, mergeSetRedIDs, mergeSetBlueIDs))
+}
+
+// GetBlockMergeSet returns the ordered merge set reds and blues of the block `blockID`
+func (db *Database) GetBlockMergeSet(databaseTransaction *pg.Tx, blockID uint64) (
+	mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64, err error) {
+
+	var mergeSets []*model.BlockMergeSet
+	_, err = databaseTransaction.Query(&mergeSets, "SELECT * FROM block_merge_sets "+
+		"WHERE chain_block_id = ? ORDER BY merge_set_index", blockID)
+	if err != nil {
+		return nil, nil, err
+	}
+	mergeSetRedIDs = []uint64{}
+	mergeSetBlueIDs = []uint64{}
+	for _, mergeSet := range mergeSets {
+		if mergeSet.Color == model.ColorRed {
+			mergeSetRedIDs = append(mergeSetRedIDs, mergeSet.MergedBlockID)
+		} else {
+			mergeSetBlueIDs = append(mergeSetBlueIDs, mergeSet.MergedBlockID)
+		}
+	}
+	return mergeSetRedIDs, mergeSetBlueIDs, nil
+}
+
+// GetMergingBlocks returns the merge set relations of the blocks merging the
+// block `mergedBlockID`, with the color each one gives it
+func (db *Database) GetMergingBlocks(databaseTransaction *pg.Tx, mergedBlockID uint64) ([]*model.BlockMergeSet, error) {
+	var results []*model.BlockMergeSet
+	_, err := databaseTransaction.Query(&results, "SELECT * FROM block_merge_sets "+
+		"WHERE merged_block_id = ? ORDER BY chain_block_id", mergedBlockID)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
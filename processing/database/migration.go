@@ -1,15 +1,24 @@
 package database
 
 import (
+	"embed"
+	"io"
+	"os"
+
 	migratePackage "github.com/golang-migrate/migrate/v4"
+	migrateDatabase "github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/pkg/errors"
-	"os"
 
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
+// migrations are embedded in the binary, so that it runs from any directory
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
 func isCurrent(migrator *migratePackage.Migrate, driver source.Driver) (bool, uint, error) {
 	version, isDirty, err := migrator.Version()
 	if errors.Is(err, migratePackage.ErrNilVersion) {
@@ -19,26 +28,29 @@ func isCurrent(migrator *migratePackage.Migrate, driver source.Driver) (bool, ui
 		return false, 0, errors.WithStack(err)
 	}
 	if isDirty {
-		return false, 0, errors.Errorf("Database is dirty")
+		return false, 0, errors.Errorf("Database is dirty at version %d -- fix the schema by hand, "+
+			"then run `migrate force %d` (or `migrate force <previous version>` if the migration was not applied)",
+			version, version)
 	}
 
 	// The database is current if Next returns ErrNotExist
 	_, err = driver.Next(version)
-	var pathErr *os.PathError
-	if errors.As(err, &pathErr) {
-		if pathErr.Err == os.ErrNotExist {
-			return true, version, nil
-		}
+	if isNotExist(err) {
+		return true, version, nil
 	}
 	return false, version, err
 }
 
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
+
 func openMigrator(connectionString string) (*migratePackage.Migrate, source.Driver, error) {
-	driver, err := source.Open("file://database/migrations")
+	driver, err := iofs.New(migrations, "migrations")
 	if err != nil {
 		return nil, nil, err
 	}
-	migrator, err := migratePackage.NewWithSourceInstance("migrations", driver, connectionString)
+	migrator, err := migratePackage.NewWithSourceInstance("iofs", driver, connectionString)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -71,3 +83,248 @@ func migrate(connectionString string) error {
 	log.Infof("Migrated database to the latest version (version %d)", version)
 	return nil
 }
+
+// Migrator runs the migrations of the database on demand. Version 0 stands
+// for a database without any migration applied.
+type Migrator struct {
+	migrator *migratePackage.Migrate
+	driver   source.Driver
+}
+
+// MigrationStatus is the migration state of the database
+type MigrationStatus struct {
+	Version         uint
+	IsDirty         bool
+	LatestVersion   uint
+	PendingVersions []uint
+}
+
+// MigrationStep is a migration script run when moving between two versions
+type MigrationStep struct {
+	Version    uint
+	IsUp       bool
+	Identifier string
+	SQL        string
+}
+
+// OpenMigrator opens the migrations of the database mentioned in the connection string
+func OpenMigrator(connectionString string) (*Migrator, error) {
+	migrator, driver, err := openMigrator(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		migrator: migrator,
+		driver:   driver,
+	}, nil
+}
+
+// Close closes the connections of the migrator
+func (m *Migrator) Close() error {
+	sourceErr, databaseErr := m.migrator.Close()
+	if sourceErr != nil {
+		return sourceErr
+	}
+	return databaseErr
+}
+
+func (m *Migrator) version() (uint, bool, error) {
+	version, isDirty, err := m.migrator.Version()
+	if errors.Is(err, migratePackage.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+	return version, isDirty, nil
+}
+
+// next returns the version following the given one, or false if there is none
+func (m *Migrator) next(version uint) (uint, bool, error) {
+	var next uint
+	var err error
+	if version == 0 {
+		next, err = m.driver.First()
+	} else {
+		next, err = m.driver.Next(version)
+	}
+	if isNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return next, true, nil
+}
+
+// previous returns the version preceding the given one, which is 0 for the first migration
+func (m *Migrator) previous(version uint) (uint, error) {
+	previous, err := m.driver.Prev(version)
+	if isNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return previous, nil
+}
+
+// Status returns the migration state of the database
+func (m *Migrator) Status() (*MigrationStatus, error) {
+	version, isDirty, err := m.version()
+	if err != nil {
+		return nil, err
+	}
+	status := &MigrationStatus{
+		Version: version,
+		IsDirty: isDirty,
+	}
+	status.LatestVersion, err = m.LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	pending := version
+	for {
+		next, ok, err := m.next(pending)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return status, nil
+		}
+		status.PendingVersions = append(status.PendingVersions, next)
+		pending = next
+	}
+}
+
+// LatestVersion returns the version of the last available migration
+func (m *Migrator) LatestVersion() (uint, error) {
+	latest := uint(0)
+	for {
+		next, ok, err := m.next(latest)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return latest, nil
+		}
+		latest = next
+	}
+}
+
+// DownTarget returns the version reached by reverting the given number of
+// migrations from the current version
+func (m *Migrator) DownTarget(steps uint) (uint, error) {
+	target, _, err := m.version()
+	if err != nil {
+		return 0, err
+	}
+	for i := uint(0); i < steps; i++ {
+		if target == 0 {
+			return 0, errors.Errorf("could not revert %d migrations: only %d are applied", steps, i)
+		}
+		target, err = m.previous(target)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return target, nil
+}
+
+// Plan returns the migration scripts run when migrating the database from
+// its current version to the target version, in order
+func (m *Migrator) Plan(target uint) ([]*MigrationStep, error) {
+	version, isDirty, err := m.version()
+	if err != nil {
+		return nil, err
+	}
+	if isDirty {
+		return nil, errors.Errorf("database is dirty at version %d -- run `migrate force` first", version)
+	}
+
+	var steps []*MigrationStep
+	for version < target {
+		next, ok, err := m.next(version)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || next > target {
+			return nil, errors.Errorf("migration version %d does not exist", target)
+		}
+		step, err := m.readStep(next, true)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+		version = next
+	}
+	for version > target {
+		step, err := m.readStep(version, false)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+		version, err = m.previous(version)
+		if err != nil {
+			return nil, err
+		}
+		if version < target {
+			return nil, errors.Errorf("migration version %d does not exist", target)
+		}
+	}
+	return steps, nil
+}
+
+func (m *Migrator) readStep(version uint, isUp bool) (*MigrationStep, error) {
+	var reader io.ReadCloser
+	var identifier string
+	var err error
+	if isUp {
+		reader, identifier, err = m.driver.ReadUp(version)
+	} else {
+		reader, identifier, err = m.driver.ReadDown(version)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read migration %d", version)
+	}
+	defer reader.Close()
+
+	sql, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read migration %d", version)
+	}
+	return &MigrationStep{
+		Version:    version,
+		IsUp:       isUp,
+		Identifier: identifier,
+		SQL:        string(sql),
+	}, nil
+}
+
+// MigrateTo migrates the database up or down to the target version
+func (m *Migrator) MigrateTo(target uint) error {
+	var err error
+	if target == 0 {
+		err = m.migrator.Down()
+	} else {
+		err = m.migrator.Migrate(target)
+	}
+	if errors.Is(err, migratePackage.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// Force sets the version of the database and marks it clean without running
+// any migration. Use it once a failed migration was fixed by hand.
+func (m *Migrator) Force(version uint) error {
+	if version == 0 {
+		return m.migrator.Force(migrateDatabase.NilVersion)
+	}
+	reader, _, err := m.driver.ReadUp(version)
+	if err != nil {
+		return errors.Wrapf(err, "migration version %d does not exist", version)
+	}
+	reader.Close()
+	return m.migrator.Force(int(version))
+}
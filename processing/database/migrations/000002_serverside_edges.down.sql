@@ -0,0 +1,4 @@
+DROP TABLE height_groups;
+DROP TABLE edges;
+ALTER TABLE blocks
+    DROP COLUMN height_group_index;
@@ -0,0 +1,2 @@
+ALTER TABLE blocks
+  DROP COLUMN daa_score;
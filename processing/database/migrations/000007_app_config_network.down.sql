@@ -0,0 +1,2 @@
+ALTER TABLE app_config
+  DROP COLUMN network;
@@ -0,0 +1 @@
+DROP TABLE resync_checkpoint;
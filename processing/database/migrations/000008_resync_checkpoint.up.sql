@@ -0,0 +1,9 @@
+CREATE TABLE resync_checkpoint
+(
+    id                   BOOLEAN    PRIMARY KEY DEFAULT TRUE,
+    pruning_point_hash   CHAR(64)   NOT NULL,
+    last_committed_index BIGINT     NOT NULL,
+    last_committed_hash  TEXT       NOT NULL,
+    phase                TEXT CHECK (phase IN ('blocks', 'chain', 'done')) NOT NULL,
+    CONSTRAINT unique_row CHECK (id)
+);
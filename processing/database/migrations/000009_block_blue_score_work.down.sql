@@ -0,0 +1,3 @@
+ALTER TABLE blocks
+  DROP COLUMN blue_score,
+  DROP COLUMN blue_work;
@@ -0,0 +1,7 @@
+ALTER TABLE blocks
+  ADD COLUMN blue_score BIGINT NULL,
+  ADD COLUMN blue_work NUMERIC NULL;
+UPDATE blocks SET blue_score = 0, blue_work = 0;
+ALTER TABLE blocks
+  ALTER COLUMN blue_score SET NOT NULL,
+  ALTER COLUMN blue_work SET NOT NULL;
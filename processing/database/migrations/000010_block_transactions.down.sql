@@ -0,0 +1,2 @@
+DROP TABLE block_transaction_ids;
+DROP TABLE block_transaction_summaries;
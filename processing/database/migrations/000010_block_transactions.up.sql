@@ -0,0 +1,18 @@
+CREATE TABLE block_transaction_summaries
+(
+    block_id            BIGINT NOT NULL,
+    transaction_count   INT    NOT NULL,
+    total_mass          BIGINT NOT NULL,
+    total_output_amount BIGINT NOT NULL,
+    coinbase_value      BIGINT NOT NULL,
+    PRIMARY KEY (block_id)
+);
+
+CREATE TABLE block_transaction_ids
+(
+    block_id          BIGINT   NOT NULL,
+    transaction_index INT      NOT NULL,
+    transaction_id    CHAR(64) NOT NULL,
+    PRIMARY KEY (block_id, transaction_index)
+);
+CREATE INDEX block_transaction_ids_transaction_id_idx ON block_transaction_ids(transaction_id);
@@ -0,0 +1,2 @@
+DROP VIEW miner_blocks;
+DROP TABLE block_miners;
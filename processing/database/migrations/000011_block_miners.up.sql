@@ -0,0 +1,20 @@
+CREATE TABLE block_miners
+(
+    block_id          BIGINT NOT NULL,
+    script_public_key TEXT   NOT NULL,
+    address           TEXT   NOT NULL,
+    tag               TEXT   NOT NULL,
+    PRIMARY KEY (block_id)
+);
+CREATE INDEX block_miners_address_idx ON block_miners(address);
+
+CREATE VIEW miner_blocks AS
+SELECT blocks.id AS block_id,
+       blocks.height,
+       blocks.timestamp,
+       blocks.color,
+       block_miners.script_public_key,
+       block_miners.address,
+       block_miners.tag
+FROM blocks
+         JOIN block_miners ON block_miners.block_id = blocks.id;
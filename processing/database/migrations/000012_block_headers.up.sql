@@ -0,0 +1,13 @@
+CREATE TABLE block_headers
+(
+    block_id                BIGINT   NOT NULL,
+    version                 SMALLINT NOT NULL,
+    parents                 JSONB    NOT NULL,
+    hash_merkle_root        CHAR(64) NOT NULL,
+    accepted_id_merkle_root CHAR(64) NOT NULL,
+    utxo_commitment         CHAR(64) NOT NULL,
+    bits                    BIGINT   NOT NULL,
+    nonce                   NUMERIC  NOT NULL,
+    pruning_point           CHAR(64) NOT NULL,
+    PRIMARY KEY (block_id)
+);
@@ -0,0 +1,3 @@
+DROP VIEW block_propagation_delays;
+ALTER TABLE blocks
+    DROP COLUMN received_at;
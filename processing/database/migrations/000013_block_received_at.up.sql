@@ -0,0 +1,13 @@
+ALTER TABLE blocks
+    ADD COLUMN received_at BIGINT;
+
+CREATE VIEW block_propagation_delays AS
+SELECT id                      AS block_id,
+       block_hash,
+       height,
+       color,
+       timestamp,
+       received_at,
+       received_at - timestamp AS delay
+FROM blocks
+WHERE received_at IS NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE chain_changes
+(
+    id                   BIGSERIAL,
+    timestamp            BIGINT  NOT NULL,
+    added_block_hashes   JSONB   NOT NULL,
+    removed_block_hashes JSONB   NOT NULL,
+    reorg_depth          INTEGER NOT NULL,
+    color_changes        JSONB   NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX chain_changes_timestamp_idx ON chain_changes (timestamp);
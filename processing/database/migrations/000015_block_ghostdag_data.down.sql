@@ -0,0 +1 @@
+DROP TABLE block_ghostdag_data;
@@ -0,0 +1,12 @@
+CREATE TABLE block_ghostdag_data
+(
+    block_id             BIGINT   NOT NULL,
+    blue_score           BIGINT   NOT NULL,
+    blue_work            NUMERIC  NOT NULL,
+    selected_parent_hash CHAR(64) NOT NULL,
+    merge_set_blues      JSONB    NOT NULL,
+    merge_set_reds       JSONB    NOT NULL,
+    blues_anticone_sizes JSONB    NOT NULL,
+    k                    SMALLINT NOT NULL,
+    PRIMARY KEY (block_id)
+);
@@ -0,0 +1 @@
+DROP TABLE difficulty_series;
@@ -0,0 +1,12 @@
+CREATE TABLE difficulty_series
+(
+    daa_score  BIGINT           NOT NULL,
+    block_id   BIGINT           NOT NULL,
+    timestamp  BIGINT           NOT NULL,
+    bits       BIGINT           NOT NULL,
+    difficulty DOUBLE PRECISION NOT NULL,
+    hashrate   DOUBLE PRECISION NULL,
+    PRIMARY KEY (daa_score)
+);
+CREATE INDEX difficulty_series_block_id_idx ON difficulty_series (block_id);
+CREATE INDEX difficulty_series_timestamp_idx ON difficulty_series (timestamp);
@@ -0,0 +1,11 @@
+CREATE TABLE transaction_acceptances
+(
+    accepting_block_id BIGINT   NOT NULL,
+    block_id           BIGINT   NOT NULL,
+    transaction_index  INTEGER  NOT NULL,
+    transaction_id     CHAR(64) NOT NULL,
+    is_accepted        BOOLEAN  NOT NULL,
+    PRIMARY KEY (accepting_block_id, block_id, transaction_index)
+);
+CREATE INDEX transaction_acceptances_block_id_idx ON transaction_acceptances (block_id);
+CREATE INDEX transaction_acceptances_transaction_id_idx ON transaction_acceptances (transaction_id);
@@ -0,0 +1,3 @@
+DROP TABLE tips;
+DROP INDEX block_headers_direct_parents_idx;
+DROP INDEX edges_to_block_id_idx;
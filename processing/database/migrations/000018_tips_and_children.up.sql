@@ -0,0 +1,13 @@
+CREATE INDEX edges_to_block_id_idx ON edges (to_block_id);
+CREATE INDEX block_headers_direct_parents_idx ON block_headers USING GIN ((parents -> 0));
+
+CREATE TABLE tips
+(
+    block_id BIGINT NOT NULL,
+    PRIMARY KEY (block_id)
+);
+
+INSERT INTO tips (block_id)
+SELECT blocks.id
+FROM blocks
+WHERE NOT EXISTS(SELECT 1 FROM edges WHERE edges.to_block_id = blocks.id);
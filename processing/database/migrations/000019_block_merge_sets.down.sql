@@ -0,0 +1,28 @@
+DROP VIEW blocks;
+
+ALTER TABLE block_nodes
+    ADD COLUMN parent_ids JSONB NULL,
+    ADD COLUMN merge_set_red_ids JSONB NULL,
+    ADD COLUMN merge_set_blue_ids JSONB NULL;
+
+UPDATE block_nodes
+SET parent_ids         = COALESCE((SELECT jsonb_agg(edges.to_block_id ORDER BY edges.to_block_id)
+                                   FROM edges
+                                   WHERE edges.from_block_id = block_nodes.id), '[]'::JSONB),
+    merge_set_red_ids  = COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                                   FROM block_merge_sets
+                                   WHERE block_merge_sets.chain_block_id = block_nodes.id
+                                     AND block_merge_sets.color = 'red'), '[]'::JSONB),
+    merge_set_blue_ids = COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                                   FROM block_merge_sets
+                                   WHERE block_merge_sets.chain_block_id = block_nodes.id
+                                     AND block_merge_sets.color = 'blue'), '[]'::JSONB);
+
+ALTER TABLE block_nodes
+    ALTER COLUMN parent_ids SET NOT NULL,
+    ALTER COLUMN merge_set_red_ids SET NOT NULL,
+    ALTER COLUMN merge_set_blue_ids SET NOT NULL;
+ALTER TABLE block_nodes
+    RENAME TO blocks;
+
+DROP TABLE block_merge_sets;
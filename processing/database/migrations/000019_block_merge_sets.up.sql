@@ -0,0 +1,56 @@
+CREATE TABLE block_merge_sets
+(
+    chain_block_id  BIGINT                                NOT NULL,
+    merged_block_id BIGINT                                NOT NULL,
+    color           TEXT CHECK (color IN ('red', 'blue')) NOT NULL,
+    merge_set_index INT                                   NOT NULL,
+    PRIMARY KEY (chain_block_id, merged_block_id)
+);
+CREATE INDEX block_merge_sets_merged_block_id_idx ON block_merge_sets (merged_block_id, color);
+
+INSERT INTO block_merge_sets (chain_block_id, merged_block_id, color, merge_set_index)
+SELECT blocks.id, merged.value::BIGINT, 'red', merged.ordinality - 1
+FROM blocks,
+     jsonb_array_elements_text(blocks.merge_set_red_ids) WITH ORDINALITY AS merged
+ON CONFLICT DO NOTHING;
+
+INSERT INTO block_merge_sets (chain_block_id, merged_block_id, color, merge_set_index)
+SELECT blocks.id, merged.value::BIGINT, 'blue', merged.ordinality - 1
+FROM blocks,
+     jsonb_array_elements_text(blocks.merge_set_blue_ids) WITH ORDINALITY AS merged
+ON CONFLICT DO NOTHING;
+
+-- The parents are the edges of the block
+ALTER TABLE blocks
+    RENAME TO block_nodes;
+ALTER TABLE block_nodes
+    DROP COLUMN parent_ids,
+    DROP COLUMN merge_set_red_ids,
+    DROP COLUMN merge_set_blue_ids;
+
+-- The blocks view keeps the former JSONB columns for the API
+CREATE VIEW blocks AS
+SELECT block_nodes.id,
+       block_nodes.block_hash,
+       block_nodes.timestamp,
+       COALESCE((SELECT jsonb_agg(edges.to_block_id ORDER BY edges.to_block_id)
+                 FROM edges
+                 WHERE edges.from_block_id = block_nodes.id), '[]'::JSONB)          AS parent_ids,
+       block_nodes.height,
+       block_nodes.selected_parent_id,
+       block_nodes.color,
+       block_nodes.is_in_virtual_selected_parent_chain,
+       block_nodes.height_group_index,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'red'), '[]'::JSONB)  AS merge_set_red_ids,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'blue'), '[]'::JSONB) AS merge_set_blue_ids,
+       block_nodes.daa_score,
+       block_nodes.blue_score,
+       block_nodes.blue_work,
+       block_nodes.received_at
+FROM block_nodes;
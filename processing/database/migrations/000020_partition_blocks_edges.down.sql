@@ -0,0 +1,85 @@
+DROP VIEW blocks;
+DROP VIEW miner_blocks;
+DROP VIEW block_propagation_delays;
+
+ALTER TABLE block_nodes
+    RENAME TO block_nodes_partitioned;
+ALTER TABLE edges
+    RENAME TO edges_partitioned;
+
+CREATE TABLE block_nodes
+(
+    LIKE block_nodes_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+    PRIMARY KEY (id),
+    UNIQUE (block_hash)
+);
+ALTER SEQUENCE blocks_id_seq OWNED BY block_nodes.id;
+
+CREATE TABLE edges
+(
+    LIKE edges_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+    PRIMARY KEY (from_block_id, to_block_id)
+);
+
+INSERT INTO block_nodes
+SELECT *
+FROM block_nodes_partitioned;
+INSERT INTO edges
+SELECT *
+FROM edges_partitioned;
+-- Dropping the partitioned tables drops their partitions as well
+DROP TABLE block_nodes_partitioned;
+DROP TABLE edges_partitioned;
+
+CREATE INDEX blocks_height_idx ON block_nodes (height DESC);
+CREATE INDEX edges_to_height_idx ON edges (to_height DESC);
+CREATE INDEX edges_from_height_idx ON edges (from_height DESC);
+CREATE INDEX edges_to_block_id_idx ON edges (to_block_id);
+
+CREATE VIEW blocks AS
+SELECT block_nodes.id,
+       block_nodes.block_hash,
+       block_nodes.timestamp,
+       COALESCE((SELECT jsonb_agg(edges.to_block_id ORDER BY edges.to_block_id)
+                 FROM edges
+                 WHERE edges.from_block_id = block_nodes.id), '[]'::JSONB)          AS parent_ids,
+       block_nodes.height,
+       block_nodes.selected_parent_id,
+       block_nodes.color,
+       block_nodes.is_in_virtual_selected_parent_chain,
+       block_nodes.height_group_index,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'red'), '[]'::JSONB)  AS merge_set_red_ids,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'blue'), '[]'::JSONB) AS merge_set_blue_ids,
+       block_nodes.daa_score,
+       block_nodes.blue_score,
+       block_nodes.blue_work,
+       block_nodes.received_at
+FROM block_nodes;
+
+CREATE VIEW miner_blocks AS
+SELECT block_nodes.id AS block_id,
+       block_nodes.height,
+       block_nodes.timestamp,
+       block_nodes.color,
+       block_miners.script_public_key,
+       block_miners.address,
+       block_miners.tag
+FROM block_nodes
+         JOIN block_miners ON block_miners.block_id = block_nodes.id;
+
+CREATE VIEW block_propagation_delays AS
+SELECT id                      AS block_id,
+       block_hash,
+       height,
+       color,
+       timestamp,
+       received_at,
+       received_at - timestamp AS delay
+FROM block_nodes
+WHERE received_at IS NOT NULL;
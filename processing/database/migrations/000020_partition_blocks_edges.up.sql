@@ -0,0 +1,109 @@
+-- block_nodes and edges are range partitioned by height, 1000000 heights per
+-- partition. The processing tier creates the partitions as the DAG grows.
+-- The primary and unique keys of a partitioned table must include the
+-- partition key, so they no longer make the block hashes and ids unique
+-- across heights. The block_hashes table of the next migration does.
+DROP VIEW blocks;
+DROP VIEW miner_blocks;
+DROP VIEW block_propagation_delays;
+
+ALTER TABLE block_nodes
+    RENAME TO block_nodes_unpartitioned;
+ALTER TABLE edges
+    RENAME TO edges_unpartitioned;
+
+CREATE TABLE block_nodes
+(
+    LIKE block_nodes_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+    PRIMARY KEY (id, height),
+    UNIQUE (block_hash, height)
+) PARTITION BY RANGE (height);
+ALTER SEQUENCE blocks_id_seq OWNED BY block_nodes.id;
+
+CREATE TABLE edges
+(
+    LIKE edges_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+    PRIMARY KEY (from_block_id, to_block_id, from_height)
+) PARTITION BY RANGE (from_height);
+
+DO
+$$
+    DECLARE
+        partition_size CONSTANT BIGINT := 1000000;
+        highest_index           BIGINT;
+    BEGIN
+        SELECT COALESCE(MAX(height), 0) / partition_size + 1 INTO highest_index FROM block_nodes_unpartitioned;
+        FOR partition_index IN 0 .. highest_index
+            LOOP
+                EXECUTE format('CREATE TABLE %I PARTITION OF block_nodes FOR VALUES FROM (%s) TO (%s)',
+                               'block_nodes_p' || partition_index,
+                               partition_index * partition_size, (partition_index + 1) * partition_size);
+                EXECUTE format('CREATE TABLE %I PARTITION OF edges FOR VALUES FROM (%s) TO (%s)',
+                               'edges_p' || partition_index,
+                               partition_index * partition_size, (partition_index + 1) * partition_size);
+            END LOOP;
+    END
+$$;
+
+INSERT INTO block_nodes
+SELECT *
+FROM block_nodes_unpartitioned;
+INSERT INTO edges
+SELECT *
+FROM edges_unpartitioned;
+DROP TABLE block_nodes_unpartitioned;
+DROP TABLE edges_unpartitioned;
+
+CREATE INDEX block_nodes_height_idx ON block_nodes (height DESC);
+CREATE INDEX block_nodes_daa_score_idx ON block_nodes (daa_score);
+CREATE INDEX edges_to_height_idx ON edges (to_height DESC);
+CREATE INDEX edges_from_height_idx ON edges (from_height DESC);
+CREATE INDEX edges_to_block_id_idx ON edges (to_block_id);
+
+CREATE VIEW blocks AS
+SELECT block_nodes.id,
+       block_nodes.block_hash,
+       block_nodes.timestamp,
+       COALESCE((SELECT jsonb_agg(edges.to_block_id ORDER BY edges.to_block_id)
+                 FROM edges
+                 WHERE edges.from_block_id = block_nodes.id), '[]'::JSONB)          AS parent_ids,
+       block_nodes.height,
+       block_nodes.selected_parent_id,
+       block_nodes.color,
+       block_nodes.is_in_virtual_selected_parent_chain,
+       block_nodes.height_group_index,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'red'), '[]'::JSONB)  AS merge_set_red_ids,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'blue'), '[]'::JSONB) AS merge_set_blue_ids,
+       block_nodes.daa_score,
+       block_nodes.blue_score,
+       block_nodes.blue_work,
+       block_nodes.received_at
+FROM block_nodes;
+
+CREATE VIEW miner_blocks AS
+SELECT block_nodes.id AS block_id,
+       block_nodes.height,
+       block_nodes.timestamp,
+       block_nodes.color,
+       block_miners.script_public_key,
+       block_miners.address,
+       block_miners.tag
+FROM block_nodes
+         JOIN block_miners ON block_miners.block_id = block_nodes.id;
+
+CREATE VIEW block_propagation_delays AS
+SELECT id                      AS block_id,
+       block_hash,
+       height,
+       color,
+       timestamp,
+       received_at,
+       received_at - timestamp AS delay
+FROM block_nodes
+WHERE received_at IS NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE block_hashes;
@@ -0,0 +1,19 @@
+-- Partitioning block_nodes by height made its primary key (id, height) and its
+-- unique key (block_hash, height): PostgreSQL only enforces uniqueness within
+-- a partition, so a block hash or id could be stored twice at two heights.
+-- block_hashes is not partitioned and restores the global uniqueness of both.
+-- The trade-off is an extra row written with every block, and a table
+-- that retention deletes from row by row rather than by dropping partitions.
+CREATE TABLE block_hashes
+(
+    block_hash CHAR(64) NOT NULL,
+    id         BIGINT   NOT NULL,
+    height     BIGINT   NOT NULL,
+    PRIMARY KEY (block_hash),
+    UNIQUE (id)
+);
+CREATE INDEX block_hashes_height_idx ON block_hashes (height);
+
+INSERT INTO block_hashes (block_hash, id, height)
+SELECT block_hash, id, height
+FROM block_nodes;
@@ -0,0 +1,2 @@
+CREATE INDEX block_headers_direct_parents_idx ON block_headers USING GIN ((parents -> 0));
+DROP TABLE missing_parents;
@@ -0,0 +1,37 @@
+-- A child stored before one of its direct parents has no edge to it. The
+-- parents missing when a block is inserted are kept here by hash, so that the
+-- edges from their children are added once they are inserted.
+CREATE TABLE missing_parents
+(
+    block_id    BIGINT   NOT NULL,
+    parent_hash CHAR(64) NOT NULL,
+    PRIMARY KEY (block_id, parent_hash)
+);
+CREATE INDEX missing_parents_parent_hash_idx ON missing_parents (parent_hash);
+
+-- The edges of the parents inserted after their children so far
+INSERT INTO edges (from_block_id, to_block_id, from_height, to_height, from_height_group_index, to_height_group_index)
+SELECT children.id,
+       parents.id,
+       children.height,
+       parents.height,
+       children.height_group_index,
+       parents.height_group_index
+FROM block_headers
+         CROSS JOIN jsonb_array_elements_text(block_headers.parents -> 0) AS direct_parents(block_hash)
+         JOIN block_nodes AS children ON children.id = block_headers.block_id
+         JOIN block_nodes AS parents ON parents.block_hash = direct_parents.block_hash
+WHERE NOT EXISTS(SELECT 1 FROM edges WHERE edges.from_block_id = children.id AND edges.to_block_id = parents.id);
+
+INSERT INTO missing_parents (block_id, parent_hash)
+SELECT block_headers.block_id, direct_parents.block_hash
+FROM block_headers
+         CROSS JOIN jsonb_array_elements_text(block_headers.parents -> 0) AS direct_parents(block_hash)
+WHERE NOT EXISTS(SELECT 1 FROM block_hashes WHERE block_hashes.block_hash = direct_parents.block_hash);
+
+DELETE
+FROM tips
+WHERE block_id IN (SELECT to_block_id FROM edges);
+
+-- The tips and the children are found through the edges only
+DROP INDEX block_headers_direct_parents_idx;
@@ -0,0 +1,31 @@
+DROP VIEW blocks;
+CREATE VIEW blocks AS
+SELECT block_nodes.id,
+       block_nodes.block_hash,
+       block_nodes.timestamp,
+       COALESCE((SELECT jsonb_agg(edges.to_block_id ORDER BY edges.to_block_id)
+                 FROM edges
+                 WHERE edges.from_block_id = block_nodes.id), '[]'::JSONB)          AS parent_ids,
+       block_nodes.height,
+       block_nodes.selected_parent_id,
+       block_nodes.color,
+       block_nodes.is_in_virtual_selected_parent_chain,
+       block_nodes.height_group_index,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'red'), '[]'::JSONB)  AS merge_set_red_ids,
+       COALESCE((SELECT jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                 FROM block_merge_sets
+                 WHERE block_merge_sets.chain_block_id = block_nodes.id
+                   AND block_merge_sets.color = 'blue'), '[]'::JSONB) AS merge_set_blue_ids,
+       block_nodes.daa_score,
+       block_nodes.blue_score,
+       block_nodes.blue_work,
+       block_nodes.received_at
+FROM block_nodes;
+
+ALTER TABLE missing_parents
+    DROP COLUMN parent_index;
+ALTER TABLE edges
+    DROP COLUMN parent_index;
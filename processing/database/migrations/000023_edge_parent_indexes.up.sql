@@ -0,0 +1,64 @@
+-- The edges keep the index of their parent in the direct parents of the block
+-- header, so that the parent_ids of the blocks view follow the header order.
+-- The edges of the blocks stored without a header keep index 0 and are
+-- ordered by parent id.
+ALTER TABLE edges
+    ADD COLUMN parent_index INT NOT NULL DEFAULT 0;
+ALTER TABLE missing_parents
+    ADD COLUMN parent_index INT NOT NULL DEFAULT 0;
+
+UPDATE edges
+SET parent_index = direct_parents.ordinality - 1
+FROM block_headers
+         CROSS JOIN jsonb_array_elements_text(block_headers.parents -> 0)
+    WITH ORDINALITY AS direct_parents(block_hash, ordinality)
+         JOIN block_hashes ON block_hashes.block_hash = direct_parents.block_hash
+WHERE edges.from_block_id = block_headers.block_id
+  AND edges.to_block_id = block_hashes.id;
+
+UPDATE missing_parents
+SET parent_index = direct_parents.ordinality - 1
+FROM block_headers
+         CROSS JOIN jsonb_array_elements_text(block_headers.parents -> 0)
+    WITH ORDINALITY AS direct_parents(block_hash, ordinality)
+WHERE missing_parents.block_id = block_headers.block_id
+  AND missing_parents.parent_hash = direct_parents.block_hash;
+
+ALTER TABLE edges
+    ALTER COLUMN parent_index DROP DEFAULT;
+ALTER TABLE missing_parents
+    ALTER COLUMN parent_index DROP DEFAULT;
+
+-- The JSONB columns are aggregated once per block through grouped joins
+-- rather than by subqueries run for every row
+DROP VIEW blocks;
+CREATE VIEW blocks AS
+SELECT block_nodes.id,
+       block_nodes.block_hash,
+       block_nodes.timestamp,
+       COALESCE(parents.parent_ids, '[]'::JSONB)                 AS parent_ids,
+       block_nodes.height,
+       block_nodes.selected_parent_id,
+       block_nodes.color,
+       block_nodes.is_in_virtual_selected_parent_chain,
+       block_nodes.height_group_index,
+       COALESCE(merge_sets.merge_set_red_ids, '[]'::JSONB)  AS merge_set_red_ids,
+       COALESCE(merge_sets.merge_set_blue_ids, '[]'::JSONB) AS merge_set_blue_ids,
+       block_nodes.daa_score,
+       block_nodes.blue_score,
+       block_nodes.blue_work,
+       block_nodes.received_at
+FROM block_nodes
+         LEFT JOIN (SELECT edges.from_block_id,
+                           jsonb_agg(edges.to_block_id ORDER BY edges.parent_index, edges.to_block_id) AS parent_ids
+                    FROM edges
+                    GROUP BY edges.from_block_id) AS parents
+                   ON parents.from_block_id = block_nodes.id
+         LEFT JOIN (SELECT block_merge_sets.chain_block_id,
+                           jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                           FILTER (WHERE block_merge_sets.color = 'red')  AS merge_set_red_ids,
+                           jsonb_agg(block_merge_sets.merged_block_id ORDER BY block_merge_sets.merge_set_index)
+                           FILTER (WHERE block_merge_sets.color = 'blue') AS merge_set_blue_ids
+                    FROM block_merge_sets
+                    GROUP BY block_merge_sets.chain_block_id) AS merge_sets
+                   ON merge_sets.chain_block_id = block_nodes.id;
@@ -6,19 +6,54 @@ const (
 	ColorBlue = "blue"
 )
 
+const (
+	ResyncPhaseBlocks = "blocks"
+	ResyncPhaseChain  = "chain"
+	ResyncPhaseDone   = "done"
+)
+
+// Block is a block of the DAG. Its parents are its edges and its merge sets
+// are its BlockMergeSet relations.
 type Block struct {
-	ID                             uint64   `pg:"id,pk"`
-	BlockHash                      string   `pg:"block_hash"`
-	Timestamp                      int64    `pg:"timestamp,use_zero"`
-	ParentIDs                      []uint64 `pg:"parent_ids,use_zero"`
-	DAAScore                       uint64   `pg:"daa_score,use_zero"`
-	Height                         uint64   `pg:"height,use_zero"`
-	HeightGroupIndex               uint32   `pg:"height_group_index,use_zero"`
-	SelectedParentID               *uint64  `pg:"selected_parent_id"`
-	Color                          string   `pg:"color"`
-	IsInVirtualSelectedParentChain bool     `pg:"is_in_virtual_selected_parent_chain,use_zero"`
-	MergeSetRedIDs                 []uint64 `pg:"merge_set_red_ids,use_zero"`
-	MergeSetBlueIDs                []uint64 `pg:"merge_set_blue_ids,use_zero"`
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_nodes,alias:block_nodes"`
+
+	ID                             uint64  `pg:"id,pk"`
+	BlockHash                      string  `pg:"block_hash"`
+	Timestamp                      int64   `pg:"timestamp,use_zero"`
+	DAAScore                       uint64  `pg:"daa_score,use_zero"`
+	BlueScore                      uint64  `pg:"blue_score,use_zero"`
+	BlueWork                       string  `pg:"blue_work,use_zero"`
+	Height                         uint64  `pg:"height,use_zero"`
+	HeightGroupIndex               uint32  `pg:"height_group_index,use_zero"`
+	SelectedParentID               *uint64 `pg:"selected_parent_id"`
+	Color                          string  `pg:"color"`
+	IsInVirtualSelectedParentChain bool    `pg:"is_in_virtual_selected_parent_chain,use_zero"`
+	ReceivedAt                     *int64  `pg:"received_at"`
+}
+
+// BlockHash maps the hash of a block to its id and height. Unlike the height
+// partitioned block_nodes, it enforces the uniqueness of both across heights.
+type BlockHash struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_hashes,alias:block_hashes"`
+
+	BlockHash string `pg:"block_hash,pk"`
+	ID        uint64 `pg:"id,use_zero"`
+	Height    uint64 `pg:"height,use_zero"`
+}
+
+// BlockMergeSet relates the chain block ChainBlockID to the block
+// MergedBlockID of its merge set, colored by it. MergeSetIndex is the position
+// of the merged block within the merge set blues or reds.
+type BlockMergeSet struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_merge_sets,alias:block_merge_sets"`
+
+	ChainBlockID  uint64 `pg:"chain_block_id,pk"`
+	MergedBlockID uint64 `pg:"merged_block_id,pk"`
+	Color         string `pg:"color"`
+	MergeSetIndex uint32 `pg:"merge_set_index,use_zero"`
 }
 
 type Edge struct {
@@ -28,6 +63,20 @@ type Edge struct {
 	ToHeight             uint64 `pg:"to_height,use_zero"`
 	FromHeightGroupIndex uint32 `pg:"from_height_group_index,use_zero"`
 	ToHeightGroupIndex   uint32 `pg:"to_height_group_index,use_zero"`
+	// ParentIndex is the index of the parent in the direct parents of the block
+	ParentIndex uint32 `pg:"parent_index,use_zero"`
+}
+
+// MissingParent is a direct parent of the block `BlockID` that was not
+// stored when the block was inserted. The edge to it is added, and the row
+// removed, once it is inserted.
+type MissingParent struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"missing_parents,alias:missing_parents"`
+
+	BlockID     uint64 `pg:"block_id,pk"`
+	ParentHash  string `pg:"parent_hash,pk"`
+	ParentIndex uint32 `pg:"parent_index,use_zero"`
 }
 
 type HeightGroup struct {
@@ -35,6 +84,165 @@ type HeightGroup struct {
 	Size   uint32 `pg:"size,use_zero"`
 }
 
+// ChainChange records a change of the virtual selected parent chain.
+// The reorg depth is the number of removed chain blocks.
+// Timestamp is the arrival time in milliseconds of the notification of the
+// change, or its processing time when the change was fetched from the node
+// after a resync or a recovery. Consecutive notifications are applied at
+// once, so the color changes of their net chain diff are recorded with the
+// last of them.
+type ChainChange struct {
+	ID                 uint64         `pg:"id,pk"`
+	Timestamp          int64          `pg:"timestamp,use_zero"`
+	AddedBlockHashes   []string       `pg:"added_block_hashes,use_zero"`
+	RemovedBlockHashes []string       `pg:"removed_block_hashes,use_zero"`
+	ReorgDepth         int            `pg:"reorg_depth,use_zero"`
+	ColorChanges       []*ColorChange `pg:"color_changes,use_zero"`
+}
+
+// ColorChange is the color flip of a block caused by a chain change
+type ColorChange struct {
+	BlockHash string `json:"blockHash"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// ChainChangeStats summarizes the chain changes of a time range
+type ChainChangeStats struct {
+	ChangeCount    uint64  `pg:"change_count,use_zero"`
+	ReorgCount     uint64  `pg:"reorg_count,use_zero"`
+	MaxReorgDepth  int     `pg:"max_reorg_depth,use_zero"`
+	MeanReorgDepth float64 `pg:"mean_reorg_depth,use_zero"`
+}
+
+// PropagationDelay is the delay, in milliseconds, between the header
+// timestamp of a block and its arrival at the processing tier
+type PropagationDelay struct {
+	BlockID    uint64 `pg:"block_id"`
+	BlockHash  string `pg:"block_hash"`
+	Height     uint64 `pg:"height"`
+	Color      string `pg:"color"`
+	Timestamp  int64  `pg:"timestamp"`
+	ReceivedAt int64  `pg:"received_at"`
+	Delay      int64  `pg:"delay"`
+}
+
+// BlockHeader holds the header fields of a block not stored in Block.
+// Parents lists the parent hashes of every block level, starting with the
+// direct parents. Nonce is a decimal string.
+type BlockHeader struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_headers,alias:block_headers"`
+
+	BlockID              uint64     `pg:"block_id,pk"`
+	Version              uint16     `pg:"version,use_zero"`
+	Parents              [][]string `pg:"parents,use_zero"`
+	HashMerkleRoot       string     `pg:"hash_merkle_root"`
+	AcceptedIDMerkleRoot string     `pg:"accepted_id_merkle_root"`
+	UTXOCommitment       string     `pg:"utxo_commitment"`
+	Bits                 uint32     `pg:"bits,use_zero"`
+	Nonce                string     `pg:"nonce,use_zero"`
+	PruningPoint         string     `pg:"pruning_point"`
+}
+
+// TransactionAcceptance tells whether the transaction at TransactionIndex of
+// the block BlockID was accepted by the chain block AcceptingBlockID merging it
+type TransactionAcceptance struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"transaction_acceptances,alias:transaction_acceptances"`
+
+	AcceptingBlockID uint64 `pg:"accepting_block_id,pk"`
+	BlockID          uint64 `pg:"block_id,pk"`
+	TransactionIndex uint32 `pg:"transaction_index,pk,use_zero"`
+	TransactionID    string `pg:"transaction_id"`
+	IsAccepted       bool   `pg:"is_accepted,use_zero"`
+}
+
+// BlockGHOSTDAGData is the GHOSTDAG data of a block computed by the embedded
+// consensus. The merge sets are ordered block hashes, BluesAnticoneSizes maps
+// the hash of every merge set blue to the size of its blue anticone, and K is
+// the anticone size bound of the network. The blue work is a decimal string.
+type BlockGHOSTDAGData struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_ghostdag_data,alias:block_ghostdag_data"`
+
+	BlockID            uint64           `pg:"block_id,pk"`
+	BlueScore          uint64           `pg:"blue_score,use_zero"`
+	BlueWork           string           `pg:"blue_work,use_zero"`
+	SelectedParentHash string           `pg:"selected_parent_hash"`
+	MergeSetBlues      []string         `pg:"merge_set_blues,use_zero"`
+	MergeSetReds       []string         `pg:"merge_set_reds,use_zero"`
+	BluesAnticoneSizes map[string]uint8 `pg:"blues_anticone_sizes,use_zero"`
+	K                  uint8            `pg:"k,use_zero"`
+}
+
+// DifficultySample is the difficulty of the first stored block of a DAA
+// score, along with the estimated network hashrate in hashes per second over
+// the DAA window ending at it. Hashrate is nil when the window spans no time.
+type DifficultySample struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"difficulty_series,alias:difficulty_series"`
+
+	DAAScore   uint64   `pg:"daa_score,pk"`
+	BlockID    uint64   `pg:"block_id,use_zero"`
+	Timestamp  int64    `pg:"timestamp,use_zero"`
+	Bits       uint32   `pg:"bits,use_zero"`
+	Difficulty float64  `pg:"difficulty,use_zero"`
+	Hashrate   *float64 `pg:"hashrate"`
+}
+
+// DifficultyPoint is a point of a downsampled difficulty series, averaging
+// the samples from its DAA score and timestamp on
+type DifficultyPoint struct {
+	DAAScore   uint64   `pg:"daa_score"`
+	Timestamp  int64    `pg:"timestamp"`
+	Difficulty float64  `pg:"difficulty"`
+	Hashrate   *float64 `pg:"hashrate"`
+}
+
+// BlockTransactionSummary summarizes the transactions of a block.
+// TotalOutputAmount excludes the coinbase transaction, which outputs
+// add up to CoinbaseValue. Amounts are in sompi.
+type BlockTransactionSummary struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_transaction_summaries,alias:block_transaction_summaries"`
+
+	BlockID           uint64 `pg:"block_id,pk"`
+	TransactionCount  uint32 `pg:"transaction_count,use_zero"`
+	TotalMass         uint64 `pg:"total_mass,use_zero"`
+	TotalOutputAmount uint64 `pg:"total_output_amount,use_zero"`
+	CoinbaseValue     uint64 `pg:"coinbase_value,use_zero"`
+}
+
+type BlockTransactionID struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_transaction_ids,alias:block_transaction_ids"`
+
+	BlockID          uint64 `pg:"block_id,pk"`
+	TransactionIndex uint32 `pg:"transaction_index,pk,use_zero"`
+	TransactionID    string `pg:"transaction_id"`
+}
+
+// BlockMiner is the miner of a block as found in its coinbase transaction
+type BlockMiner struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"block_miners,alias:block_miners"`
+
+	BlockID         uint64 `pg:"block_id,pk"`
+	ScriptPublicKey string `pg:"script_public_key,use_zero"`
+	Address         string `pg:"address,use_zero"`
+	Tag             string `pg:"tag,use_zero"`
+}
+
+// MinerStats aggregates the blocks of a miner
+type MinerStats struct {
+	Address    string
+	Tag        string
+	BlockCount uint64
+	BlueCount  uint64
+	RedCount   uint64
+}
+
 type AppConfig struct {
 	//lint:ignore U1000 This field is used by gp-pg reflexively
 	tableName struct{} `pg:"app_config,alias:app_config"`
@@ -44,3 +252,14 @@ type AppConfig struct {
 	ProcessingVersion string `pg:"processing_version"`
 	Network           string `pg:"network"`
 }
+
+type ResyncCheckpoint struct {
+	//lint:ignore U1000 This field is used by gp-pg reflexively
+	tableName struct{} `pg:"resync_checkpoint,alias:resync_checkpoint"`
+
+	ID                 bool   `pg:"id,pk"`
+	PruningPointHash   string `pg:"pruning_point_hash"`
+	LastCommittedIndex int64  `pg:"last_committed_index,use_zero"`
+	LastCommittedHash  string `pg:"last_committed_hash,use_zero"`
+	Phase              string `pg:"phase"`
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// HeightPartitionSize is the number of heights of a partition of the
+// block_nodes and edges tables. It must match the partition size of the
+// partitioning migration.
+const HeightPartitionSize = 1000000
+
+// heightPartitionedTables are the tables range partitioned by height
+var heightPartitionedTables = []string{"block_nodes", "edges"}
+
+func heightPartitionName(table string, index uint64) string {
+	return fmt.Sprintf("%s_p%d", table, index)
+}
+
+// ensureHeightPartitions creates the partitions holding the blocks of
+// `heights`, along with the partitions that follow them, so that a partition
+// always exists before the DAG reaches it
+func (db *Database) ensureHeightPartitions(databaseTransaction *pg.Tx, heights ...uint64) error {
+	if db.heightPartitions == nil {
+		db.heightPartitions = make(map[uint64]bool)
+	}
+	for _, height := range heights {
+		for index := height / HeightPartitionSize; index <= height/HeightPartitionSize+1; index++ {
+			if db.heightPartitions[index] {
+				continue
+			}
+			for _, table := range heightPartitionedTables {
+				_, err := databaseTransaction.Exec("CREATE TABLE IF NOT EXISTS ? PARTITION OF ? FOR VALUES FROM (?) TO (?)",
+					pg.Ident(heightPartitionName(table, index)), pg.Ident(table),
+					index*HeightPartitionSize, (index+1)*HeightPartitionSize)
+				if err != nil {
+					return err
+				}
+			}
+			db.heightPartitions[index] = true
+		}
+	}
+	return nil
+}
+
+// DropHeightPartitionsBelow drops the partitions of the blocks and edges
+// lying entirely below `height`, after deleting the data of their blocks.
+// Dropping a partition is much cheaper than deleting its rows.
+// Returns the height below which all partitions are dropped, 0 if none is.
+func (db *Database) DropHeightPartitionsBelow(databaseTransaction *pg.Tx, height uint64) (uint64, error) {
+	var partitionNames []string
+	_, err := databaseTransaction.Query(&partitionNames, "SELECT child.relname FROM pg_inherits "+
+		"JOIN pg_class child ON child.oid = pg_inherits.inhrelid "+
+		"WHERE pg_inherits.inhparent = 'block_nodes'::regclass")
+	if err != nil {
+		return 0, err
+	}
+	indexes := make([]uint64, 0, len(partitionNames))
+	for _, partitionName := range partitionNames {
+		var index uint64
+		_, err := fmt.Sscanf(partitionName, "block_nodes_p%d", &index)
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	droppedBelow := uint64(0)
+	for _, index := range indexes {
+		end := (index + 1) * HeightPartitionSize
+		if end > height {
+			break
+		}
+		err = db.deleteBlockDataBelowHeight(databaseTransaction, end)
+		if err != nil {
+			return 0, err
+		}
+		for _, table := range heightPartitionedTables {
+			_, err = databaseTransaction.Exec("DROP TABLE IF EXISTS ?", pg.Ident(heightPartitionName(table, index)))
+			if err != nil {
+				return 0, err
+			}
+		}
+		delete(db.heightPartitions, index)
+		droppedBelow = end
+	}
+	if droppedBelow > 0 {
+		_, err = databaseTransaction.Exec("DELETE FROM block_hashes WHERE height < ?", droppedBelow)
+		if err != nil {
+			return 0, err
+		}
+		db.clearCache()
+	}
+	return droppedBelow, nil
+}
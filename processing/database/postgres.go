@@ -0,0 +1,186 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+)
+
+// PostgresStorage is the Storage of a PostgreSQL database.
+// Its transactions wrap a *pg.Tx.
+type PostgresStorage struct {
+	database *Database
+}
+
+// NewPostgresStorage returns the Storage of `database`
+func NewPostgresStorage(database *Database) *PostgresStorage {
+	return &PostgresStorage{database: database}
+}
+
+var _ Storage = (*PostgresStorage)(nil)
+
+// postgresTransaction is the Transaction of a PostgresStorage
+type postgresTransaction struct {
+	TransactionBase
+	tx *pg.Tx
+}
+
+func pgTx(databaseTransaction Transaction) *pg.Tx {
+	return databaseTransaction.(*postgresTransaction).tx
+}
+
+func (s *PostgresStorage) RunInTransaction(transactionFunction func(Transaction) error) error {
+	return s.database.RunInTransaction(func(databaseTransaction *pg.Tx) error {
+		return transactionFunction(&postgresTransaction{tx: databaseTransaction})
+	})
+}
+
+func (s *PostgresStorage) LoadCache(databaseTransaction Transaction, minHeight uint64) error {
+	return s.database.LoadCache(pgTx(databaseTransaction), minHeight)
+}
+
+func (s *PostgresStorage) Clear(databaseTransaction Transaction) error {
+	return s.database.Clear(pgTx(databaseTransaction))
+}
+
+func (s *PostgresStorage) Interrupt() {
+	s.database.Interrupt()
+}
+
+func (s *PostgresStorage) Close() {
+	s.database.Close()
+}
+
+func (s *PostgresStorage) DoesBlockExist(databaseTransaction Transaction, blockHash *externalapi.DomainHash) (bool, error) {
+	return s.database.DoesBlockExist(pgTx(databaseTransaction), blockHash)
+}
+
+func (s *PostgresStorage) InsertBlocks(databaseTransaction Transaction, blocks []*BulkBlock) error {
+	return s.database.InsertBlocks(pgTx(databaseTransaction), blocks)
+}
+
+func (s *PostgresStorage) GetBlock(databaseTransaction Transaction, id uint64) (*model.Block, error) {
+	return s.database.GetBlock(pgTx(databaseTransaction), id)
+}
+
+func (s *PostgresStorage) UpdateBlockIsInVirtualSelectedParentChain(databaseTransaction Transaction, blockIDsToIsInVirtualSelectedParentChain map[uint64]bool) error {
+	return s.database.UpdateBlockIsInVirtualSelectedParentChain(pgTx(databaseTransaction), blockIDsToIsInVirtualSelectedParentChain)
+}
+
+func (s *PostgresStorage) UpdateBlockColors(databaseTransaction Transaction, blockIDsToColors map[uint64]string) error {
+	return s.database.UpdateBlockColors(pgTx(databaseTransaction), blockIDsToColors)
+}
+
+func (s *PostgresStorage) UpdateBlockDAAScores(databaseTransaction Transaction, blockIDsToDAAScores map[uint64]uint64) error {
+	return s.database.UpdateBlockDAAScores(pgTx(databaseTransaction), blockIDsToDAAScores)
+}
+
+func (s *PostgresStorage) UpdateBlockBlueScoresAndWorks(databaseTransaction Transaction, blockIDsToBlueScoresAndWorks map[uint64]*BlueScoreAndWork) error {
+	return s.database.UpdateBlockBlueScoresAndWorks(pgTx(databaseTransaction), blockIDsToBlueScoresAndWorks)
+}
+
+func (s *PostgresStorage) GetBlockMergeSet(databaseTransaction Transaction, blockID uint64) ([]uint64, []uint64, error) {
+	return s.database.GetBlockMergeSet(pgTx(databaseTransaction), blockID)
+}
+
+func (s *PostgresStorage) BlockIDByHash(databaseTransaction Transaction, blockHash *externalapi.DomainHash) (uint64, error) {
+	return s.database.BlockIDByHash(pgTx(databaseTransaction), blockHash)
+}
+
+func (s *PostgresStorage) BlockHeightByHash(databaseTransaction Transaction, blockHash *externalapi.DomainHash) (uint64, error) {
+	return s.database.BlockHeightByHash(pgTx(databaseTransaction), blockHash)
+}
+
+func (s *PostgresStorage) FindLatestStoredBlockIndex(databaseTransaction Transaction, blockHashes []*externalapi.DomainHash) (int, error) {
+	return s.database.FindLatestStoredBlockIndex(pgTx(databaseTransaction), blockHashes)
+}
+
+func (s *PostgresStorage) BlockCountAtDAAScore(databaseTransaction Transaction, blockDAAScore uint64) (uint32, error) {
+	return s.database.BlockCountAtDAAScore(pgTx(databaseTransaction), blockDAAScore)
+}
+
+func (s *PostgresStorage) BlockCountWithoutBlueWork(databaseTransaction Transaction) (uint32, error) {
+	return s.database.BlockCountWithoutBlueWork(pgTx(databaseTransaction))
+}
+
+func (s *PostgresStorage) HighestBlockInVirtualSelectedParentChain(databaseTransaction Transaction) (*model.Block, error) {
+	return s.database.HighestBlockInVirtualSelectedParentChain(pgTx(databaseTransaction))
+}
+
+func (s *PostgresStorage) MaxBlockHeight(databaseTransaction Transaction) (uint64, error) {
+	return s.database.MaxBlockHeight(pgTx(databaseTransaction))
+}
+
+func (s *PostgresStorage) LowestBlockHeightSince(databaseTransaction Transaction, timestamp int64) (uint64, bool, error) {
+	return s.database.LowestBlockHeightSince(pgTx(databaseTransaction), timestamp)
+}
+
+func (s *PostgresStorage) DeleteBlocksBelowHeight(databaseTransaction Transaction, height uint64) (int, error) {
+	return s.database.DeleteBlocksBelowHeight(pgTx(databaseTransaction), height)
+}
+
+func (s *PostgresStorage) DropHeightPartitionsBelow(databaseTransaction Transaction, height uint64) (uint64, error) {
+	return s.database.DropHeightPartitionsBelow(pgTx(databaseTransaction), height)
+}
+
+func (s *PostgresStorage) UpdateTips(databaseTransaction Transaction, blockIDs []uint64) error {
+	return s.database.UpdateTips(pgTx(databaseTransaction), blockIDs)
+}
+
+func (s *PostgresStorage) StoreAppConfig(databaseTransaction Transaction, appConfig *model.AppConfig) error {
+	return s.database.StoreAppConfig(pgTx(databaseTransaction), appConfig)
+}
+
+func (s *PostgresStorage) GetResyncCheckpoint(databaseTransaction Transaction) (*model.ResyncCheckpoint, error) {
+	return s.database.GetResyncCheckpoint(pgTx(databaseTransaction))
+}
+
+func (s *PostgresStorage) StoreResyncCheckpoint(databaseTransaction Transaction, checkpoint *model.ResyncCheckpoint) error {
+	return s.database.StoreResyncCheckpoint(pgTx(databaseTransaction), checkpoint)
+}
+
+func (s *PostgresStorage) ColorChanges(databaseTransaction Transaction, blockIDsToColors map[uint64]string) ([]*model.ColorChange, error) {
+	return s.database.ColorChanges(pgTx(databaseTransaction), blockIDsToColors)
+}
+
+func (s *PostgresStorage) InsertChainChange(databaseTransaction Transaction, chainChange *model.ChainChange) error {
+	return s.database.InsertChainChange(pgTx(databaseTransaction), chainChange)
+}
+
+func (s *PostgresStorage) InsertBlockHeaders(databaseTransaction Transaction, headers []*model.BlockHeader) error {
+	return s.database.InsertBlockHeaders(pgTx(databaseTransaction), headers)
+}
+
+func (s *PostgresStorage) InsertBlocksGHOSTDAGData(databaseTransaction Transaction, ghostdagData []*model.BlockGHOSTDAGData) error {
+	return s.database.InsertBlocksGHOSTDAGData(pgTx(databaseTransaction), ghostdagData)
+}
+
+func (s *PostgresStorage) BlocksWithoutGHOSTDAGData(databaseTransaction Transaction, afterBlockID uint64, minDAAScore uint64,
+	limit int) ([]*model.Block, error) {
+
+	return s.database.BlocksWithoutGHOSTDAGData(pgTx(databaseTransaction), afterBlockID, minDAAScore, limit)
+}
+
+func (s *PostgresStorage) InsertDifficultySamples(databaseTransaction Transaction, samples []*model.DifficultySample) error {
+	return s.database.InsertDifficultySamples(pgTx(databaseTransaction), samples)
+}
+
+func (s *PostgresStorage) DifficultySamplesBetweenDAAScores(databaseTransaction Transaction, lowDAAScore uint64, highDAAScore uint64) ([]*model.DifficultySample, error) {
+	return s.database.DifficultySamplesBetweenDAAScores(pgTx(databaseTransaction), lowDAAScore, highDAAScore)
+}
+
+func (s *PostgresStorage) InsertTransactionAcceptances(databaseTransaction Transaction, acceptances []*model.TransactionAcceptance) error {
+	return s.database.InsertTransactionAcceptances(pgTx(databaseTransaction), acceptances)
+}
+
+func (s *PostgresStorage) DeleteTransactionAcceptances(databaseTransaction Transaction, acceptingBlockIDs []uint64) error {
+	return s.database.DeleteTransactionAcceptances(pgTx(databaseTransaction), acceptingBlockIDs)
+}
+
+func (s *PostgresStorage) InsertBlockTransactions(databaseTransaction Transaction, summaries []*model.BlockTransactionSummary, transactionIDs []*model.BlockTransactionID, miners []*model.BlockMiner) error {
+	return s.database.InsertBlockTransactions(pgTx(databaseTransaction), summaries, transactionIDs, miners)
+}
+
+func (s *PostgresStorage) GetBlocksTransactionIDs(databaseTransaction Transaction, blockIDs []uint64) ([]*model.BlockTransactionID, error) {
+	return s.database.GetBlocksTransactionIDs(pgTx(databaseTransaction), blockIDs)
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/pkg/errors"
+)
+
+// expectedTable is the schema a model expects from its table at the latest
+// migration. Column types are information_schema data types and indexes are
+// pg_get_indexdef definitions from USING on, prefixed by UNIQUE if unique.
+type expectedTable struct {
+	model       interface{}
+	columnTypes map[string]string
+	indexes     []string
+}
+
+var expectedTables = []*expectedTable{
+	{
+		model: (*model.Block)(nil),
+		columnTypes: map[string]string{
+			"id":                                  "bigint",
+			"block_hash":                          "character",
+			"timestamp":                           "bigint",
+			"daa_score":                           "bigint",
+			"blue_score":                          "bigint",
+			"blue_work":                           "numeric",
+			"height":                              "bigint",
+			"height_group_index":                  "integer",
+			"selected_parent_id":                  "bigint",
+			"color":                               "text",
+			"is_in_virtual_selected_parent_chain": "boolean",
+			"received_at":                         "bigint",
+		},
+		indexes: []string{
+			"UNIQUE btree (id, height)",
+			"UNIQUE btree (block_hash, height)",
+			"btree (height DESC)",
+			"btree (daa_score)",
+		},
+	},
+	{
+		model: (*model.BlockHash)(nil),
+		columnTypes: map[string]string{
+			"block_hash": "character",
+			"id":         "bigint",
+			"height":     "bigint",
+		},
+		indexes: []string{
+			"UNIQUE btree (block_hash)",
+			"UNIQUE btree (id)",
+			"btree (height)",
+		},
+	},
+	{
+		model: (*model.Edge)(nil),
+		columnTypes: map[string]string{
+			"from_block_id":           "bigint",
+			"to_block_id":             "bigint",
+			"from_height":             "bigint",
+			"to_height":               "bigint",
+			"from_height_group_index": "integer",
+			"to_height_group_index":   "integer",
+			"parent_index":            "integer",
+		},
+		indexes: []string{
+			"UNIQUE btree (from_block_id, to_block_id, from_height)",
+			"btree (to_height DESC)",
+			"btree (from_height DESC)",
+			"btree (to_block_id)",
+		},
+	},
+	{
+		model: (*model.MissingParent)(nil),
+		columnTypes: map[string]string{
+			"block_id":     "bigint",
+			"parent_hash":  "character",
+			"parent_index": "integer",
+		},
+		indexes: []string{
+			"UNIQUE btree (block_id, parent_hash)",
+			"btree (parent_hash)",
+		},
+	},
+	{
+		model: (*model.HeightGroup)(nil),
+		columnTypes: map[string]string{
+			"height": "bigint",
+			"size":   "integer",
+		},
+		indexes: []string{
+			"UNIQUE btree (height)",
+		},
+	},
+	{
+		model: (*model.AppConfig)(nil),
+		columnTypes: map[string]string{
+			"id":                 "boolean",
+			"karlsend_version":   "text",
+			"processing_version": "text",
+			"network":            "text",
+		},
+		indexes: []string{
+			"UNIQUE btree (id)",
+		},
+	},
+}
+
+// verifySchema compares the live schema of the tables of the models with the
+// schema they expect, and returns an error listing the differences if
+// someone altered it by hand.
+func verifySchema(db *pg.DB) error {
+	var differences []string
+	for _, expected := range expectedTables {
+		tableDifferences, err := verifyTable(db, expected)
+		if err != nil {
+			return err
+		}
+		differences = append(differences, tableDifferences...)
+	}
+	if len(differences) > 0 {
+		return errors.Errorf("the database schema does not match the models:\n  %s",
+			strings.Join(differences, "\n  "))
+	}
+	return nil
+}
+
+func verifyTable(db *pg.DB, expected *expectedTable) ([]string, error) {
+	table := orm.GetTable(reflect.TypeOf(expected.model).Elem())
+	tableName := strings.Trim(string(table.SQLName), `"`)
+
+	var columns []struct {
+		ColumnName string
+		DataType   string
+	}
+	_, err := db.Query(&columns, `SELECT column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ?`, tableName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read the columns of %s", tableName)
+	}
+	if len(columns) == 0 {
+		return []string{fmt.Sprintf("missing table %s", tableName)}, nil
+	}
+
+	var differences []string
+	liveColumnTypes := make(map[string]string, len(columns))
+	for _, column := range columns {
+		liveColumnTypes[column.ColumnName] = column.DataType
+	}
+	modelColumns := make(map[string]bool, len(table.Fields))
+	for _, field := range table.Fields {
+		modelColumns[field.SQLName] = true
+		expectedType := expected.columnTypes[field.SQLName]
+		liveType, ok := liveColumnTypes[field.SQLName]
+		switch {
+		case !ok:
+			differences = append(differences, fmt.Sprintf("%s: missing column %s", tableName, field.SQLName))
+		case liveType != expectedType:
+			differences = append(differences, fmt.Sprintf("%s.%s: type is %s, expected %s",
+				tableName, field.SQLName, liveType, expectedType))
+		}
+	}
+	for _, column := range columns {
+		if !modelColumns[column.ColumnName] {
+			differences = append(differences, fmt.Sprintf("%s: unexpected column %s", tableName, column.ColumnName))
+		}
+	}
+
+	var indexDefinitions []string
+	_, err = db.Query(&indexDefinitions, `SELECT indexdef
+		FROM pg_indexes
+		WHERE schemaname = current_schema() AND tablename = ?`, tableName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read the indexes of %s", tableName)
+	}
+	liveIndexes := make(map[string]bool, len(indexDefinitions))
+	for _, indexDefinition := range indexDefinitions {
+		liveIndexes[normalizeIndexDefinition(indexDefinition)] = true
+	}
+	expectedIndexes := make(map[string]bool, len(expected.indexes))
+	for _, index := range expected.indexes {
+		expectedIndexes[index] = true
+		if !liveIndexes[index] {
+			differences = append(differences, fmt.Sprintf("%s: missing index %s", tableName, index))
+		}
+	}
+	var unexpectedIndexes []string
+	for index := range liveIndexes {
+		if !expectedIndexes[index] {
+			unexpectedIndexes = append(unexpectedIndexes, index)
+		}
+	}
+	sort.Strings(unexpectedIndexes)
+	for _, index := range unexpectedIndexes {
+		differences = append(differences, fmt.Sprintf("%s: unexpected index %s", tableName, index))
+	}
+	return differences, nil
+}
+
+// normalizeIndexDefinition drops the index and table names of an index
+// definition, which differ between databases migrated along different paths
+func normalizeIndexDefinition(indexDefinition string) string {
+	normalized := indexDefinition
+	if i := strings.Index(indexDefinition, " USING "); i >= 0 {
+		normalized = indexDefinition[i+len(" USING "):]
+	}
+	if strings.HasPrefix(indexDefinition, "CREATE UNIQUE INDEX") {
+		normalized = "UNIQUE " + normalized
+	}
+	return normalized
+}
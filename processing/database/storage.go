@@ -0,0 +1,76 @@
+package database
+
+import (
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+)
+
+// Transaction is a transaction of a Storage. It is only valid within the
+// RunInTransaction call of the Storage that began it.
+type Transaction interface {
+	isTransaction()
+}
+
+// TransactionBase makes the transaction type of a Storage implementation a
+// Transaction when embedded in it
+type TransactionBase struct{}
+
+func (TransactionBase) isTransaction() {}
+
+// Storage stores the DAG processed by the processing tier.
+// All reads and writes happen within a transaction: RunInTransaction commits
+// the writes of its function if it returns nil, and rolls them all back if it
+// returns an error. Transactions are serialized and see their own writes.
+// Interrupt makes the transaction in flight fail without waiting for it,
+// while Close waits for it to finish.
+type Storage interface {
+	RunInTransaction(transactionFunction func(Transaction) error) error
+	LoadCache(databaseTransaction Transaction, minHeight uint64) error
+	Clear(databaseTransaction Transaction) error
+	Interrupt()
+	Close()
+
+	DoesBlockExist(databaseTransaction Transaction, blockHash *externalapi.DomainHash) (bool, error)
+	InsertBlocks(databaseTransaction Transaction, blocks []*BulkBlock) error
+	GetBlock(databaseTransaction Transaction, id uint64) (*model.Block, error)
+	UpdateBlockIsInVirtualSelectedParentChain(databaseTransaction Transaction,
+		blockIDsToIsInVirtualSelectedParentChain map[uint64]bool) error
+	UpdateBlockColors(databaseTransaction Transaction, blockIDsToColors map[uint64]string) error
+	UpdateBlockDAAScores(databaseTransaction Transaction, blockIDsToDAAScores map[uint64]uint64) error
+	UpdateBlockBlueScoresAndWorks(databaseTransaction Transaction,
+		blockIDsToBlueScoresAndWorks map[uint64]*BlueScoreAndWork) error
+	GetBlockMergeSet(databaseTransaction Transaction, blockID uint64) (mergeSetRedIDs []uint64, mergeSetBlueIDs []uint64, err error)
+
+	BlockIDByHash(databaseTransaction Transaction, blockHash *externalapi.DomainHash) (uint64, error)
+	BlockHeightByHash(databaseTransaction Transaction, blockHash *externalapi.DomainHash) (uint64, error)
+	FindLatestStoredBlockIndex(databaseTransaction Transaction, blockHashes []*externalapi.DomainHash) (int, error)
+	BlockCountAtDAAScore(databaseTransaction Transaction, blockDAAScore uint64) (uint32, error)
+	BlockCountWithoutBlueWork(databaseTransaction Transaction) (uint32, error)
+	HighestBlockInVirtualSelectedParentChain(databaseTransaction Transaction) (*model.Block, error)
+	MaxBlockHeight(databaseTransaction Transaction) (uint64, error)
+	LowestBlockHeightSince(databaseTransaction Transaction, timestamp int64) (uint64, bool, error)
+
+	DeleteBlocksBelowHeight(databaseTransaction Transaction, height uint64) (int, error)
+	DropHeightPartitionsBelow(databaseTransaction Transaction, height uint64) (uint64, error)
+
+	UpdateTips(databaseTransaction Transaction, blockIDs []uint64) error
+
+	StoreAppConfig(databaseTransaction Transaction, appConfig *model.AppConfig) error
+	GetResyncCheckpoint(databaseTransaction Transaction) (*model.ResyncCheckpoint, error)
+	StoreResyncCheckpoint(databaseTransaction Transaction, checkpoint *model.ResyncCheckpoint) error
+
+	ColorChanges(databaseTransaction Transaction, blockIDsToColors map[uint64]string) ([]*model.ColorChange, error)
+	InsertChainChange(databaseTransaction Transaction, chainChange *model.ChainChange) error
+
+	InsertBlockHeaders(databaseTransaction Transaction, headers []*model.BlockHeader) error
+	InsertBlocksGHOSTDAGData(databaseTransaction Transaction, ghostdagData []*model.BlockGHOSTDAGData) error
+	BlocksWithoutGHOSTDAGData(databaseTransaction Transaction, afterBlockID uint64, minDAAScore uint64, limit int) ([]*model.Block, error)
+	InsertDifficultySamples(databaseTransaction Transaction, samples []*model.DifficultySample) error
+	DifficultySamplesBetweenDAAScores(databaseTransaction Transaction,
+		lowDAAScore uint64, highDAAScore uint64) ([]*model.DifficultySample, error)
+	InsertTransactionAcceptances(databaseTransaction Transaction, acceptances []*model.TransactionAcceptance) error
+	DeleteTransactionAcceptances(databaseTransaction Transaction, acceptingBlockIDs []uint64) error
+	InsertBlockTransactions(databaseTransaction Transaction, summaries []*model.BlockTransactionSummary,
+		transactionIDs []*model.BlockTransactionID, miners []*model.BlockMiner) error
+	GetBlocksTransactionIDs(databaseTransaction Transaction, blockIDs []uint64) ([]*model.BlockTransactionID, error)
+}
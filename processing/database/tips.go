@@ -0,0 +1,47 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+)
+
+// UpdateTips adds the blocks `blockIDs`, just inserted with their edges, to
+// the tips and removes their parents from the tips.
+// A block arriving after one of its children already has the edge from it,
+// so it is not a tip.
+func (db *Database) UpdateTips(databaseTransaction *pg.Tx, blockIDs []uint64) error {
+	if len(blockIDs) == 0 {
+		return nil
+	}
+	_, err := databaseTransaction.Exec("DELETE FROM tips WHERE block_id IN "+
+		"(SELECT to_block_id FROM edges WHERE from_block_id IN (?))", pg.In(blockIDs))
+	if err != nil {
+		return err
+	}
+	_, err = databaseTransaction.Exec("INSERT INTO tips (block_id) SELECT block_nodes.id FROM block_nodes WHERE block_nodes.id IN (?) "+
+		"AND NOT EXISTS (SELECT 1 FROM edges WHERE edges.to_block_id = block_nodes.id) "+
+		"ON CONFLICT DO NOTHING", pg.In(blockIDs))
+	return err
+}
+
+// GetTips returns the blocks having no stored children
+func (db *Database) GetTips(databaseTransaction *pg.Tx) ([]*model.Block, error) {
+	var results []*model.Block
+	_, err := databaseTransaction.Query(&results, "SELECT block_nodes.* FROM tips "+
+		"JOIN block_nodes ON block_nodes.id = tips.block_id ORDER BY block_nodes.height, block_nodes.id")
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetBlockChildren returns the stored children of the block `blockID`
+func (db *Database) GetBlockChildren(databaseTransaction *pg.Tx, blockID uint64) ([]*model.Block, error) {
+	var results []*model.Block
+	_, err := databaseTransaction.Query(&results, "SELECT block_nodes.* FROM edges "+
+		"JOIN block_nodes ON block_nodes.id = edges.from_block_id WHERE edges.to_block_id = ? ORDER BY block_nodes.id", blockID)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
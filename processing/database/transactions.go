@@ -0,0 +1,130 @@
+package database
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/pkg/errors"
+)
+
+// InsertBlockTransactions stores transaction summaries, transaction ids and
+// block miners. Rows already stored for a block are kept as they are.
+func (db *Database) InsertBlockTransactions(databaseTransaction *pg.Tx, summaries []*model.BlockTransactionSummary,
+	transactionIDs []*model.BlockTransactionID, miners []*model.BlockMiner) error {
+
+	err := insertRows(databaseTransaction, summaries, "DO NOTHING", "transaction summaries")
+	if err != nil {
+		return err
+	}
+	err = insertRows(databaseTransaction, transactionIDs, "DO NOTHING", "transaction ids")
+	if err != nil {
+		return err
+	}
+	return insertRows(databaseTransaction, miners, "DO NOTHING", "block miners")
+}
+
+// GetBlockTransactionSummary returns the transaction summary of the block `blockID`.
+// Returns nil if the block has no summary.
+func (db *Database) GetBlockTransactionSummary(databaseTransaction *pg.Tx, blockID uint64) (*model.BlockTransactionSummary, error) {
+	result := new(model.BlockTransactionSummary)
+	_, err := databaseTransaction.QueryOne(result, "SELECT * FROM block_transaction_summaries WHERE block_id = ?", blockID)
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// BlockTransactionSummariesBetweenHeights returns the transaction summaries of
+// the blocks having a height between `lowHeight` and `highHeight` included
+func (db *Database) BlockTransactionSummariesBetweenHeights(databaseTransaction *pg.Tx,
+	lowHeight uint64, highHeight uint64) ([]*model.BlockTransactionSummary, error) {
+
+	var results []*model.BlockTransactionSummary
+	_, err := databaseTransaction.Query(&results, "SELECT block_transaction_summaries.* FROM block_transaction_summaries "+
+		"JOIN block_nodes ON block_nodes.id = block_transaction_summaries.block_id "+
+		"WHERE block_nodes.height >= ? AND block_nodes.height <= ? ORDER BY block_nodes.height, block_nodes.height_group_index", lowHeight, highHeight)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetBlockTransactionIDs returns the ids of the transactions of the block
+// `blockID` in block order
+func (db *Database) GetBlockTransactionIDs(databaseTransaction *pg.Tx, blockID uint64) ([]string, error) {
+	var results []string
+	_, err := databaseTransaction.Query(&results, "SELECT transaction_id FROM block_transaction_ids "+
+		"WHERE block_id = ? ORDER BY transaction_index", blockID)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetBlocksTransactionIDs returns the transaction ids of the blocks
+// `blockIDs`, ordered by block id and transaction index
+func (db *Database) GetBlocksTransactionIDs(databaseTransaction *pg.Tx, blockIDs []uint64) ([]*model.BlockTransactionID, error) {
+	if len(blockIDs) == 0 {
+		return []*model.BlockTransactionID{}, nil
+	}
+	var results []*model.BlockTransactionID
+	_, err := databaseTransaction.Query(&results, "SELECT * FROM block_transaction_ids "+
+		"WHERE block_id IN (?) ORDER BY block_id, transaction_index", pg.In(blockIDs))
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// BlockIDsByTransactionID returns the ids of the blocks including the
+// transaction `transactionID`
+func (db *Database) BlockIDsByTransactionID(databaseTransaction *pg.Tx, transactionID string) ([]uint64, error) {
+	var results []uint64
+	_, err := databaseTransaction.Query(&results, "SELECT block_id FROM block_transaction_ids WHERE transaction_id = ?", transactionID)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetBlockMiner returns the miner of the block `blockID`.
+// Returns nil if the block has no known miner.
+func (db *Database) GetBlockMiner(databaseTransaction *pg.Tx, blockID uint64) (*model.BlockMiner, error) {
+	result := new(model.BlockMiner)
+	_, err := databaseTransaction.QueryOne(result, "SELECT * FROM block_miners WHERE block_id = ?", blockID)
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MinerStatsBetweenHeights aggregates the blocks of every miner having a
+// height between `lowHeight` and `highHeight` included
+func (db *Database) MinerStatsBetweenHeights(databaseTransaction *pg.Tx, lowHeight uint64, highHeight uint64) ([]*model.MinerStats, error) {
+	return db.minerStats(databaseTransaction, "height", int64(lowHeight), int64(highHeight))
+}
+
+// MinerStatsBetweenTimestamps aggregates the blocks of every miner having a
+// timestamp in milliseconds between `lowTimestamp` and `highTimestamp` included
+func (db *Database) MinerStatsBetweenTimestamps(databaseTransaction *pg.Tx, lowTimestamp int64, highTimestamp int64) ([]*model.MinerStats, error) {
+	return db.minerStats(databaseTransaction, "timestamp", lowTimestamp, highTimestamp)
+}
+
+// minerStats aggregates the blocks of every miner having a `column` value
+// between `low` and `high` included. `column` must be a trusted column name.
+func (db *Database) minerStats(databaseTransaction *pg.Tx, column string, low int64, high int64) ([]*model.MinerStats, error) {
+	var results []*model.MinerStats
+	_, err := databaseTransaction.Query(&results, "SELECT address, tag, COUNT(*) AS block_count, "+
+		"COUNT(*) FILTER (WHERE color = ?) AS blue_count, COUNT(*) FILTER (WHERE color = ?) AS red_count "+
+		"FROM miner_blocks WHERE "+column+" >= ? AND "+column+" <= ? GROUP BY address, tag ORDER BY block_count DESC",
+		model.ColorBlue, model.ColorRed, low, high)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -9,6 +9,7 @@ require (
 	github.com/jessevdk/go-flags v1.6.1
 	github.com/karlsen-network/karlsend/v2 v2.2.1
 	github.com/pkg/errors v0.9.1
+	go.etcd.io/bbolt v1.3.11
 	golang.org/x/exp v0.0.0-20240909161429-701f63a606c0
 )
 
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/logging"
@@ -17,11 +19,28 @@ import (
 )
 
 const (
-	appDataDirectory      = "kgi-processing"
-	defaultLogDirname     = "logs"
-	defaultLogLevel       = "info"
-	defaultLogFilename    = "kgi-processing.log"
-	defaultErrLogFilename = "kgi-processing_err.log"
+	appDataDirectory       = "kgi-processing"
+	defaultLogDirname      = "logs"
+	defaultLogLevel        = "info"
+	defaultLogFilename     = "kgi-processing.log"
+	defaultErrLogFilename  = "kgi-processing_err.log"
+	defaultResyncWorkers   = 8
+	defaultResyncChunkSize = 1000
+	defaultShutdownTimeout = 30 * time.Second
+	defaultEventQueueSize  = 10000
+
+	defaultRetentionPolicy      = RetentionPolicyAll
+	defaultRetentionHeights     = 100000
+	defaultRetentionDays        = 30
+	defaultRetentionInterval    = time.Hour
+	defaultRetentionHeadHeights = 10000
+)
+
+// Retention policies of the blocks stored in the database
+const (
+	RetentionPolicyAll     = "all"
+	RetentionPolicyHeights = "heights"
+	RetentionPolicyDays    = "days"
 )
 
 var (
@@ -31,22 +50,52 @@ var (
 )
 
 type Flags struct {
-	ShowVersion              bool     `short:"V" long:"version" description:"Display version information and exit"`
-	AppDir                   string   `short:"b" long:"appdir" description:"Directory to store data"`
-	LogDir                   string   `long:"logdir" description:"Directory to log output."`
-	DatabaseConnectionString string   `long:"connection-string" description:"Connection string for PostgrSQL database to connect to. Should be of the form: postgres://<username>:<password>@<host>:<port>/<database name>"`
-	ConnectPeers             []string `long:"connect" description:"Connect only to the specified peers at startup"`
-	DNSSeed                  string   `long:"dnsseed" description:"Override DNS seeds with specified hostname (Only 1 hostname allowed)"`
-	GRPCSeed                 string   `long:"grpcseed" description:"Hostname of gRPC server for seeding peers"`
-	Resync                   bool     `long:"resync" description:"Force to resync all available node blocks with the PostgrSQL database -- Use if some recently added blocks have missing parents"`
-	ClearDB                  bool     `long:"clear-db" description:"Clear the PostgrSQL database and sync from scratch"`
-	LogLevel                 string   `short:"d" long:"loglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
-	RPCServer                string   `short:"s" long:"rpcserver" description:"RPC server to connect to"`
+	ShowVersion              bool          `short:"V" long:"version" description:"Display version information and exit"`
+	AppDir                   string        `short:"b" long:"appdir" description:"Directory to store data"`
+	LogDir                   string        `long:"logdir" description:"Directory to log output."`
+	DatabaseConnectionString string        `long:"connection-string" description:"Connection string for PostgrSQL database to connect to. Should be of the form: postgres://<username>:<password>@<host>:<port>/<database name>"`
+	EmbeddedStorage          string        `long:"embedded-storage" description:"Store the processed DAG in this file instead of the PostgrSQL database -- Use to run the processing without a PostgrSQL server, e.g. for development"`
+	ConnectPeers             []string      `long:"connect" description:"Connect only to the specified peers at startup"`
+	DNSSeed                  string        `long:"dnsseed" description:"Override DNS seeds with specified hostname (Only 1 hostname allowed)"`
+	GRPCSeed                 string        `long:"grpcseed" description:"Hostname of gRPC server for seeding peers"`
+	Resync                   bool          `long:"resync" description:"Force to resync all available node blocks with the PostgrSQL database -- Use if some recently added blocks have missing parents"`
+	ClearDB                  bool          `long:"clear-db" description:"Clear the PostgrSQL database and sync from scratch"`
+	NoTransactions           bool          `long:"no-transactions" description:"Do not fetch the transactions of the blocks nor store their summaries and ids -- Miner attribution reads the coinbase transaction, so it is disabled as well -- Use for lightweight deployments"`
+	ResyncWorkers            int           `long:"resync-workers" description:"Number of concurrent workers decoding the pages of blocks walked from the node while resyncing the database"`
+	ResyncChunkSize          int           `long:"resync-chunk-size" description:"Number of blocks committed to the database at once while resyncing -- An interrupted resync continues from the last committed chunk"`
+	LogLevel                 string        `short:"d" long:"loglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
+	RPCServer                string        `short:"s" long:"rpcserver" description:"RPC server to connect to"`
+	EmbeddedNode             bool          `long:"embedded-node" description:"Run the embedded node next to the RPC server and store the GHOSTDAG data of the blocks from its consensus"`
+	EventQueueSize           int           `long:"event-queue-size" description:"Maximum number of node notifications waiting to be processed -- Notifications received while the queue is full are dropped and backfilled later"`
+	ShutdownTimeout          time.Duration `long:"shutdown-timeout" description:"Maximum time to wait for the processing to stop gracefully on SIGINT/SIGTERM"`
+	RetentionPolicy          string        `long:"retention-policy" description:"Retention policy of the blocks stored in the database {all, heights, days} -- Blocks at or above the node pruning point are always kept"`
+	RetentionHeights         uint64        `long:"retention-heights" description:"Number of heights kept behind the node pruning point with --retention-policy=heights"`
+	RetentionDays            uint64        `long:"retention-days" description:"Number of days of blocks kept with --retention-policy=days"`
+	RetentionInterval        time.Duration `long:"retention-interval" description:"Time between two applications of the retention policy"`
+	RetentionHeadHeights     uint64        `long:"retention-head-heights" description:"Number of heights below the highest block never removed by the retention policy, so that the API head view stays complete"`
+	DryRun                   bool          `long:"dry-run" description:"Print the SQL of the pending migrations of a migrate command instead of running them"`
 	karlsenConfigPackage.NetworkFlags
 }
 
+// Subcommands of the migrate command
+const (
+	MigrateStatus = "status"
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateGoto   = "goto"
+	MigrateForce  = "force"
+)
+
+// MigrateCommand is a migrate command given on the command line, run instead
+// of the processing
+type MigrateCommand struct {
+	Subcommand string
+	Argument   uint
+}
+
 type Config struct {
 	*Flags
+	Migrate *MigrateCommand
 }
 
 // cleanAndExpandPath expands environment variables and leading ~ in the
@@ -65,9 +114,19 @@ func cleanAndExpandPath(path string) string {
 
 func defaultFlags() *Flags {
 	return &Flags{
-		AppDir:    defaultDataDir,
-		LogLevel:  defaultLogLevel,
-		RPCServer: "localhost",
+		AppDir:          defaultDataDir,
+		LogLevel:        defaultLogLevel,
+		RPCServer:       "localhost",
+		ResyncWorkers:   defaultResyncWorkers,
+		ResyncChunkSize: defaultResyncChunkSize,
+		ShutdownTimeout: defaultShutdownTimeout,
+		EventQueueSize:  defaultEventQueueSize,
+
+		RetentionPolicy:      defaultRetentionPolicy,
+		RetentionHeights:     defaultRetentionHeights,
+		RetentionDays:        defaultRetentionDays,
+		RetentionInterval:    defaultRetentionInterval,
+		RetentionHeadHeights: defaultRetentionHeadHeights,
 	}
 }
 
@@ -79,7 +138,8 @@ func LoadConfig() (*Config, error) {
 
 	cfgFlags := defaultFlags()
 	parser := flags.NewParser(cfgFlags, flags.HelpFlag)
-	_, err := parser.Parse()
+	parser.Usage = "[OPTIONS] [migrate {status,up,down N,goto V,force V}]"
+	args, err := parser.Parse()
 	if err != nil {
 		var flagsErr *flags.Error
 		if ok := errors.As(err, &flagsErr); !ok || flagsErr.Type != flags.ErrHelp {
@@ -90,6 +150,13 @@ func LoadConfig() (*Config, error) {
 	cfg := &Config{
 		Flags: cfgFlags,
 	}
+	cfg.Migrate, err = parseMigrateCommand(args)
+	if err != nil {
+		return nil, errors.Errorf("%s\n\n%s", err, usageMessage)
+	}
+	if cfg.DryRun && cfg.Migrate == nil {
+		return nil, errors.Errorf("--dry-run is only supported by the migrate command.")
+	}
 
 	// Show the version and exit if the version flag was specified.
 	if cfg.ShowVersion {
@@ -98,8 +165,35 @@ func LoadConfig() (*Config, error) {
 		os.Exit(0)
 	}
 
-	if cfg.DatabaseConnectionString == "" {
-		return nil, errors.Errorf("--connection-string is required.")
+	if cfg.EmbeddedStorage != "" {
+		if cfg.DatabaseConnectionString != "" {
+			return nil, errors.Errorf("--connection-string and --embedded-storage cannot be used together.")
+		}
+		if cfg.Migrate != nil {
+			return nil, errors.Errorf("The migrate command only applies to the PostgrSQL database.")
+		}
+		cfg.EmbeddedStorage = cleanAndExpandPath(cfg.EmbeddedStorage)
+	} else if cfg.DatabaseConnectionString == "" {
+		return nil, errors.Errorf("--connection-string or --embedded-storage is required.")
+	}
+
+	if cfg.ResyncWorkers < 1 {
+		return nil, errors.Errorf("--resync-workers must be at least 1.")
+	}
+	if cfg.ResyncChunkSize < 1 {
+		return nil, errors.Errorf("--resync-chunk-size must be at least 1.")
+	}
+	if cfg.EventQueueSize < 1 {
+		return nil, errors.Errorf("--event-queue-size must be at least 1.")
+	}
+	switch cfg.RetentionPolicy {
+	case RetentionPolicyAll, RetentionPolicyHeights, RetentionPolicyDays:
+	default:
+		return nil, errors.Errorf("--retention-policy must be one of %s, %s or %s.",
+			RetentionPolicyAll, RetentionPolicyHeights, RetentionPolicyDays)
+	}
+	if cfg.RetentionInterval <= 0 {
+		return nil, errors.Errorf("--retention-interval must be positive.")
 	}
 
 	err = cfg.ResolveNetwork(parser)
@@ -141,3 +235,37 @@ func LoadConfig() (*Config, error) {
 
 	return cfg, nil
 }
+
+func parseMigrateCommand(args []string) (*MigrateCommand, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if args[0] != "migrate" {
+		return nil, errors.Errorf("unknown command %s", args[0])
+	}
+	if len(args) < 2 {
+		return nil, errors.Errorf("migrate requires a subcommand")
+	}
+
+	command := &MigrateCommand{Subcommand: args[1]}
+	argumentCount := 0
+	switch command.Subcommand {
+	case MigrateStatus, MigrateUp:
+	case MigrateDown, MigrateGoto, MigrateForce:
+		argumentCount = 1
+	default:
+		return nil, errors.Errorf("unknown migrate subcommand %s", command.Subcommand)
+	}
+	if len(args)-2 != argumentCount {
+		return nil, errors.Errorf("migrate %s takes %d arguments", command.Subcommand, argumentCount)
+	}
+	if argumentCount == 1 {
+		argument, err := strconv.ParseUint(args[2], 10, 0)
+		if err != nil {
+			return nil, errors.Errorf("migrate %s requires a non-negative number, got %s",
+				command.Subcommand, args[2])
+		}
+		command.Argument = uint(argument)
+	}
+	return command, nil
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/karlsen-network/karlsend/v2/infrastructure/network/rpcclient"
+	"github.com/pkg/errors"
 
 	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	embeddedPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/embedded"
 	configPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/config"
 	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/logging"
+	karlsendPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/karlsend"
 	processingPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing"
 	versionPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/version"
 	"github.com/karlsen-network/karlsend/v2/version"
@@ -22,29 +30,103 @@ func main() {
 		logging.LogErrorAndExit("Could not parse command line arguments.\n%s", err)
 	}
 
+	if config.Migrate != nil {
+		err := runMigrateCommand(config)
+		if err != nil {
+			logging.LogErrorAndExit("Could not run migrate %s: %s", config.Migrate.Subcommand, err)
+		}
+		return
+	}
+
 	logging.Logger().Infof("Application version %s", versionPackage.Version())
 	logging.Logger().Infof("Embedded karlsend version %s", version.Version())
 	logging.Logger().Infof("Network %s", config.ActiveNetParams.Name)
 
-	database, err := databasePackage.Connect(config.DatabaseConnectionString)
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	storage, err := openStorage(config)
 	if err != nil {
-		logging.LogErrorAndExit("Could not connect to database %s: %s", config.DatabaseConnectionString, err)
+		logging.LogErrorAndExit("Could not open the storage: %s", err)
+	}
+	// closeStorageAndExit closes the storage before exiting on an error
+	closeStorageAndExit := func(errorLog string, logParameters ...interface{}) {
+		storage.Close()
+		logging.LogErrorAndExit(errorLog, logParameters...)
 	}
-	defer database.Close()
 
 	rpcAddress, err := config.NetParams().NormalizeRPCServerAddress(config.RPCServer)
 	if err != nil {
-		panic(err)
+		closeStorageAndExit("Could not parse the RPC server address %s: %s", config.RPCServer, err)
 	}
-	rpcClient, err := rpcclient.NewRPCClient(rpcAddress)
+	dialNodeClient := func() (processingPackage.NodeClient, error) {
+		return rpcclient.NewRPCClient(rpcAddress)
+	}
+	rpcClient, err := dialNodeClient()
 	if err != nil {
-		panic(err)
+		closeStorageAndExit("Could not connect to the node %s: %s", rpcAddress, err)
 	}
 
-	_, err = processingPackage.NewProcessing(config, database, rpcClient)
+	processing, err := processingPackage.NewProcessing(config, storage, rpcClient, dialNodeClient)
 	if err != nil {
-		logging.LogErrorAndExit("Could not initialize processing: %s", err)
+		_ = rpcClient.Close()
+		closeStorageAndExit("Could not initialize processing: %s", err)
+	}
+	stop := func() error {
+		stopContext, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		return processing.Stop(stopContext)
+	}
+	// stopAndExit stops processing, which closes the RPC client and the
+	// storage, before exiting on an error
+	stopAndExit := func(errorLog string, logParameters ...interface{}) {
+		err := stop()
+		if err != nil {
+			logging.Logger().Warnf("Could not stop processing gracefully: %s", err)
+		}
+		logging.LogErrorAndExit(errorLog, logParameters...)
 	}
 
-	<-make(chan struct{})
+	if config.EmbeddedNode {
+		karlsend, err := karlsendPackage.New(config)
+		if err != nil {
+			stopAndExit("Could not initialize the embedded node: %s", err)
+		}
+		err = karlsend.Start()
+		if err != nil {
+			stopAndExit("Could not start the embedded node: %s", err)
+		}
+		processing.SetGHOSTDAGDataSource(karlsend)
+	}
+	err = processing.Start(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		stopAndExit("Could not start processing: %s", err)
+	}
+
+	<-ctx.Done()
+	logging.Logger().Infof("Shutdown requested, stopping within %s", config.ShutdownTimeout)
+
+	err = stop()
+	if err != nil {
+		logging.LogErrorAndExit("Could not stop processing gracefully: %s", err)
+	}
+	logging.Logger().Infof("Processing stopped")
+}
+
+// openStorage opens the embedded storage if configured, and connects to the
+// PostgreSQL database otherwise
+func openStorage(config *configPackage.Config) (databasePackage.Storage, error) {
+	if config.EmbeddedStorage != "" {
+		logging.Logger().Infof("Using the embedded storage %s", config.EmbeddedStorage)
+		storage, err := embeddedPackage.Open(config.EmbeddedStorage)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not open the embedded storage %s", config.EmbeddedStorage)
+		}
+		return storage, nil
+	}
+	database, err := databasePackage.Connect(config.DatabaseConnectionString)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not connect to database %s", config.DatabaseConnectionString)
+	}
+	return databasePackage.NewPostgresStorage(database), nil
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	configPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/config"
+)
+
+// runMigrateCommand runs the migrate command of the config against the
+// database instead of starting the processing
+func runMigrateCommand(config *configPackage.Config) error {
+	migrator, err := databasePackage.OpenMigrator(config.DatabaseConnectionString)
+	if err != nil {
+		return errors.Wrapf(err, "could not open the database migrations")
+	}
+	defer migrator.Close()
+
+	command := config.Migrate
+	var target uint
+	switch command.Subcommand {
+	case configPackage.MigrateStatus:
+		return printMigrationStatus(migrator)
+	case configPackage.MigrateForce:
+		if config.DryRun {
+			fmt.Printf("Would force the database version to %d\n", command.Argument)
+			return nil
+		}
+		err := migrator.Force(command.Argument)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Forced the database version to %d\n", command.Argument)
+		return nil
+	case configPackage.MigrateUp:
+		target, err = migrator.LatestVersion()
+	case configPackage.MigrateDown:
+		target, err = migrator.DownTarget(command.Argument)
+	case configPackage.MigrateGoto:
+		target = command.Argument
+	}
+	if err != nil {
+		return err
+	}
+
+	steps, err := migrator.Plan(target)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Printf("The database is already at version %d\n", target)
+		return nil
+	}
+	if config.DryRun {
+		for _, step := range steps {
+			direction := "down"
+			if step.IsUp {
+				direction = "up"
+			}
+			fmt.Printf("-- Migration %d %s (%s)\n%s\n", step.Version, direction, step.Identifier, step.SQL)
+		}
+		return nil
+	}
+	err = migrator.MigrateTo(target)
+	if err != nil {
+		return errors.Wrapf(err, "could not migrate the database to version %d", target)
+	}
+	fmt.Printf("Migrated the database to version %d (%d migrations run)\n", target, len(steps))
+	return nil
+}
+
+func printMigrationStatus(migrator *databasePackage.Migrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Version:  %d\n", status.Version)
+	fmt.Printf("Dirty:    %t\n", status.IsDirty)
+	fmt.Printf("Latest:   %d\n", status.LatestVersion)
+	fmt.Printf("Pending:  %v\n", status.PendingVersions)
+	if status.IsDirty {
+		fmt.Printf("The last migration failed -- fix the schema, then run `migrate force %d` "+
+			"or `migrate force <previous version>`\n", status.Version)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package processing
+
+import (
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// acceptedTransactionIDsByBlock indexes `acceptedTransactionIDs`, as sent by
+// the node along with chain changes, by accepting block hash
+func acceptedTransactionIDsByBlock(acceptedTransactionIDs []*appmessage.AcceptedTransactionIDs) (
+	map[externalapi.DomainHash]map[string]struct{}, error) {
+
+	results := make(map[externalapi.DomainHash]map[string]struct{}, len(acceptedTransactionIDs))
+	for _, accepted := range acceptedTransactionIDs {
+		acceptingBlockHash, err := externalapi.NewDomainHashFromString(accepted.AcceptingBlockHash)
+		if err != nil {
+			return nil, err
+		}
+		transactionIDs := make(map[string]struct{}, len(accepted.AcceptedTransactionIDs))
+		for _, transactionID := range accepted.AcceptedTransactionIDs {
+			transactionIDs[transactionID] = struct{}{}
+		}
+		results[*acceptingBlockHash] = transactionIDs
+	}
+	return results, nil
+}
+
+// updateTransactionAcceptances removes the transaction acceptances of the
+// chain blocks `removedBlockIDs` and stores the ones of `addedBlockHashes`,
+// whose accepted transactions are `acceptedTransactionIDs`.
+// Every transaction of the merge set of an added chain block is marked
+// accepted or rejected by it.
+func (p *Processing) updateTransactionAcceptances(databaseTransaction databasePackage.Transaction, removedBlockIDs []uint64,
+	addedBlockHashes []*externalapi.DomainHash, acceptedTransactionIDs []*appmessage.AcceptedTransactionIDs) error {
+
+	err := p.database.DeleteTransactionAcceptances(databaseTransaction, removedBlockIDs)
+	if err != nil {
+		return errors.Wrapf(err, "Could not delete the transaction acceptances of %d removed chain blocks", len(removedBlockIDs))
+	}
+	if !p.includeTransactions() || len(addedBlockHashes) == 0 {
+		return nil
+	}
+
+	acceptedTransactionIDsByHash, err := acceptedTransactionIDsByBlock(acceptedTransactionIDs)
+	if err != nil {
+		return err
+	}
+
+	var rows []*model.TransactionAcceptance
+	for _, addedBlockHash := range addedBlockHashes {
+		accepted, ok := acceptedTransactionIDsByHash[*addedBlockHash]
+		if !ok {
+			log.Debugf("No accepted transaction ids sent for chain block %s, no transaction acceptances stored", addedBlockHash)
+			continue
+		}
+		addedBlockID, err := p.database.BlockIDByHash(databaseTransaction, addedBlockHash)
+		if err != nil {
+			continue
+		}
+		mergeSetRedIDs, mergeSetBlueIDs, err := p.database.GetBlockMergeSet(databaseTransaction, addedBlockID)
+		if err != nil {
+			return err
+		}
+		mergeSetIDs := append(mergeSetBlueIDs, mergeSetRedIDs...)
+		transactionIDs, err := p.database.GetBlocksTransactionIDs(databaseTransaction, mergeSetIDs)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get the transactions merged by block %s", addedBlockHash)
+		}
+		for _, transactionID := range transactionIDs {
+			_, isAccepted := accepted[transactionID.TransactionID]
+			rows = append(rows, &model.TransactionAcceptance{
+				AcceptingBlockID: addedBlockID,
+				BlockID:          transactionID.BlockID,
+				TransactionIndex: transactionID.TransactionIndex,
+				TransactionID:    transactionID.TransactionID,
+				IsAccepted:       isAccepted,
+			})
+		}
+	}
+	return p.database.InsertTransactionAcceptances(databaseTransaction, rows)
+}
@@ -1,39 +1,49 @@
 package batch
 
 import (
-	"github.com/go-pg/pg/v10"
 	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
 	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/logging"
 	"github.com/karlsen-network/karlsend/v2/app/appmessage"
 	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
-	"github.com/karlsen-network/karlsend/v2/infrastructure/network/rpcclient"
 	"github.com/pkg/errors"
 )
 
 var log = logging.Logger()
 
+// NodeClient is the part of the node RPC client used to fetch missing dependencies
+type NodeClient interface {
+	GetBlock(hash string, includeTransactions bool) (*appmessage.GetBlockResponseMessage, error)
+}
+
 type Batch struct {
-	database      *databasePackage.Database
-	rpcClient     *rpcclient.RPCClient
-	blocks        []*BlockAndHash
-	hashes        map[externalapi.DomainHash]*BlockAndHash
-	prunningBlock *externalapi.DomainBlock
+	database            databasePackage.Storage
+	rpcClient           NodeClient
+	includeTransactions bool
+	blocks              []*BlockAndHash
+	hashes              map[externalapi.DomainHash]*BlockAndHash
+	prunningBlock       *externalapi.DomainBlock
 }
 
 type Block externalapi.DomainBlock
 
 type BlockAndHash struct {
 	*externalapi.DomainBlock
-	hash *externalapi.DomainHash
+	hash        *externalapi.DomainHash
+	verboseData *appmessage.RPCBlockVerboseData
 }
 
-func New(database *databasePackage.Database, rpcClient *rpcclient.RPCClient, prunningBlock *externalapi.DomainBlock) *Batch {
+// New creates a Batch fetching the missing dependencies with `rpcClient`,
+// along with their transactions if `includeTransactions` is true
+func New(database databasePackage.Storage, rpcClient NodeClient, prunningBlock *externalapi.DomainBlock,
+	includeTransactions bool) *Batch {
+
 	batch := &Batch{
-		database:      database,
-		rpcClient:     rpcClient,
-		blocks:        make([]*BlockAndHash, 0),
-		hashes:        make(map[externalapi.DomainHash]*BlockAndHash),
-		prunningBlock: prunningBlock,
+		database:            database,
+		rpcClient:           rpcClient,
+		includeTransactions: includeTransactions,
+		blocks:              make([]*BlockAndHash, 0),
+		hashes:              make(map[externalapi.DomainHash]*BlockAndHash),
+		prunningBlock:       prunningBlock,
 	}
 	return batch
 }
@@ -44,13 +54,15 @@ func (b *Batch) InScope(block *externalapi.DomainBlock) bool {
 	return b.prunningBlock == nil || b.prunningBlock.Header.DAAScore() <= block.Header.DAAScore()
 }
 
-// Add adds a pair `hash` and its matching `block` to the batch.
+// Add adds a pair `hash` and its matching `block` to the batch, along with
+// the block verbose data if already known.
 // Avoid duplicates and ignore blocks not in scope
-func (b *Batch) Add(hash *externalapi.DomainHash, block *externalapi.DomainBlock) {
+func (b *Batch) Add(hash *externalapi.DomainHash, block *externalapi.DomainBlock, verboseData *appmessage.RPCBlockVerboseData) {
 	if !b.Has(hash) && b.InScope(block) {
 		ba := &BlockAndHash{
 			DomainBlock: block,
 			hash:        hash,
+			verboseData: verboseData,
 		}
 		b.blocks = append(b.blocks, ba)
 		b.hashes[*hash] = ba
@@ -77,12 +89,12 @@ func (b *Batch) Empty() bool {
 	return len(b.blocks) == 0
 }
 
-// Pop returns the latest hash and block added and removes the pair from the batch.
-// Returns false if the batch is empty
-func (b *Batch) Pop() (*externalapi.DomainHash, *externalapi.DomainBlock, bool) {
+// Pop returns the latest hash, block and verbose data added and removes them from the batch.
+// The verbose data is nil if it was not provided. Returns false if the batch is empty
+func (b *Batch) Pop() (*externalapi.DomainHash, *externalapi.DomainBlock, *appmessage.RPCBlockVerboseData, bool) {
 	cnt := len(b.blocks)
 	if cnt == 0 {
-		return nil, nil, false
+		return nil, nil, nil, false
 	}
 	blockAddress := b.blocks[cnt-1]
 
@@ -94,13 +106,15 @@ func (b *Batch) Pop() (*externalapi.DomainHash, *externalapi.DomainBlock, bool)
 	}
 	delete(b.hashes, *blockAddress.hash)
 
-	return blockAddress.hash, blockAddress.DomainBlock, true
+	return blockAddress.hash, blockAddress.DomainBlock, blockAddress.verboseData, true
 }
 
 // CollectBlockAndDependencies adds `block` and all its missing direct and
 // indirect dependencies
-func (b *Batch) CollectBlockAndDependencies(databaseTransaction *pg.Tx, hash *externalapi.DomainHash, block *externalapi.DomainBlock) error {
-	b.Add(hash, block)
+func (b *Batch) CollectBlockAndDependencies(databaseTransaction databasePackage.Transaction, hash *externalapi.DomainHash,
+	block *externalapi.DomainBlock, verboseData *appmessage.RPCBlockVerboseData) error {
+
+	b.Add(hash, block, verboseData)
 	for i := 0; i < len(b.blocks); i++ {
 		item := b.blocks[i]
 		err := b.CollectDirectDependencies(databaseTransaction, item.hash, item.DomainBlock)
@@ -112,7 +126,7 @@ func (b *Batch) CollectBlockAndDependencies(databaseTransaction *pg.Tx, hash *ex
 }
 
 // CollectDirectDependencies adds the missing direct parents of `block`
-func (b *Batch) CollectDirectDependencies(databaseTransaction *pg.Tx, hash *externalapi.DomainHash, block *externalapi.DomainBlock) error {
+func (b *Batch) CollectDirectDependencies(databaseTransaction databasePackage.Transaction, hash *externalapi.DomainHash, block *externalapi.DomainBlock) error {
 	parentHashes := block.Header.DirectParents()
 	for _, parentHash := range parentHashes {
 		parentExists, err := b.database.DoesBlockExist(databaseTransaction, parentHash)
@@ -121,7 +135,7 @@ func (b *Batch) CollectDirectDependencies(databaseTransaction *pg.Tx, hash *exte
 			return errors.Wrapf(err, "Could not check if parent %s for block %s does exist in database", parentHash, hash)
 		}
 		if !parentExists {
-			rpcBlock, err := b.rpcClient.GetBlock(parentHash.String(), false)
+			rpcBlock, err := b.rpcClient.GetBlock(parentHash.String(), b.includeTransactions)
 			if err != nil {
 				// We ignore the `block not found` karlsend error.
 				// In this case the parent is out the node scope so we have no way
@@ -133,7 +147,7 @@ func (b *Batch) CollectDirectDependencies(databaseTransaction *pg.Tx, hash *exte
 				if err != nil {
 					return err
 				}
-				b.Add(parentHash, parentBlock)
+				b.Add(parentHash, parentBlock, rpcBlock.Block.VerboseData)
 				log.Warnf("Parent %s for block %s found by karlsend domain consensus; the missing dependency is registered for processing", parentHash, hash)
 			}
 		}
@@ -0,0 +1,82 @@
+package coinbase
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/utils/transactionhelper"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/utils/txscript"
+	"github.com/karlsen-network/karlsend/v2/domain/dagconfig"
+	"github.com/pkg/errors"
+)
+
+// Layout of the coinbase payload: blue score, subsidy, script public key
+// version, script public key length, script public key, then the extra data
+// set by the miner
+const (
+	blueScoreLength             = 8
+	subsidyLength               = 8
+	scriptPublicKeyVersionLen   = 2
+	scriptPublicKeyLengthLength = 1
+	scriptPublicKeyOffset       = blueScoreLength + subsidyLength + scriptPublicKeyVersionLen + scriptPublicKeyLengthLength
+)
+
+// Miner is the payout destination and the tag a miner set in a coinbase transaction
+type Miner struct {
+	// ScriptPublicKey is the hex encoded payout script public key
+	ScriptPublicKey string
+	// Address is the payout address, empty if the script is non standard
+	Address string
+	// Tag is the printable part of the coinbase extra data
+	Tag string
+}
+
+// Parse extracts the miner from the payload of `coinbaseTransaction`
+func Parse(coinbaseTransaction *externalapi.DomainTransaction, params *dagconfig.Params) (*Miner, error) {
+	if !transactionhelper.IsCoinBase(coinbaseTransaction) {
+		return nil, errors.Errorf("transaction is not a coinbase transaction")
+	}
+	payload := coinbaseTransaction.Payload
+	if len(payload) < scriptPublicKeyOffset {
+		return nil, errors.Errorf("coinbase payload of %d bytes is shorter than the minimum length of %d",
+			len(payload), scriptPublicKeyOffset)
+	}
+
+	version := binary.LittleEndian.Uint16(payload[blueScoreLength+subsidyLength:])
+	scriptLength := int(payload[scriptPublicKeyOffset-scriptPublicKeyLengthLength])
+	if scriptLength > int(params.CoinbasePayloadScriptPublicKeyMaxLength) {
+		return nil, errors.Errorf("coinbase payload script public key of %d bytes is longer than the maximum of %d",
+			scriptLength, params.CoinbasePayloadScriptPublicKeyMaxLength)
+	}
+	if len(payload) < scriptPublicKeyOffset+scriptLength {
+		return nil, errors.Errorf("coinbase payload is too short for a script public key of %d bytes", scriptLength)
+	}
+	scriptPublicKey := &externalapi.ScriptPublicKey{
+		Script:  payload[scriptPublicKeyOffset : scriptPublicKeyOffset+scriptLength],
+		Version: version,
+	}
+
+	miner := &Miner{
+		ScriptPublicKey: hex.EncodeToString(scriptPublicKey.Script),
+		Tag:             printable(payload[scriptPublicKeyOffset+scriptLength:]),
+	}
+	_, address, err := txscript.ExtractScriptPubKeyAddress(scriptPublicKey, params)
+	if err == nil && address != nil {
+		miner.Address = address.EncodeAddress()
+	}
+	return miner, nil
+}
+
+// printable keeps the printable characters of `extraData`, which is free-form
+// and usually holds the node version followed by a pool or miner name
+func printable(extraData []byte) string {
+	return strings.Map(func(r rune) rune {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(string(extraData), ""))
+}
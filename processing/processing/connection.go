@@ -0,0 +1,265 @@
+package processing
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/pkg/errors"
+)
+
+const (
+	heartbeatInterval   = 10 * time.Second
+	minReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff = 2 * time.Minute
+)
+
+// superviseConnection checks the connection to the node at regular intervals
+// and recovers from a lost connection, from notifications that stopped
+// arriving and from notifications that failed to be processed.
+// It returns once `ctx` is done.
+func (p *Processing) superviseConnection(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	lastSelectedTipHash := ""
+	lastChainChangedCount := atomic.LoadUint64(&p.chainChangedCount)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			selectedTip, err := p.rpcClient.GetSelectedTipHash()
+			if err != nil {
+				log.Warnf("Lost connection to the node: %s", err)
+				p.recover(ctx, true)
+				lastSelectedTipHash = ""
+				lastChainChangedCount = atomic.LoadUint64(&p.chainChangedCount)
+				continue
+			}
+			// The node selected tip moved since the previous heartbeat, yet
+			// no chain changed notification arrived in the meantime
+			chainChangedCount := atomic.LoadUint64(&p.chainChangedCount)
+			if lastSelectedTipHash != "" && selectedTip.SelectedTipHash != lastSelectedTipHash &&
+				chainChangedCount == lastChainChangedCount {
+
+				log.Warnf("The node stopped sending notifications")
+				p.recover(ctx, true)
+				chainChangedCount = atomic.LoadUint64(&p.chainChangedCount)
+			}
+			lastSelectedTipHash = selectedTip.SelectedTipHash
+			lastChainChangedCount = chainChangedCount
+
+			stats := p.EventQueueStats()
+			log.Debugf("Event queue: %d/%d events, %d processed, latency %s (average %s)",
+				stats.Depth, stats.Capacity, stats.ProcessedEvents, stats.LastLatency, stats.AverageLatency)
+
+		case <-p.recoveryRequests:
+			p.recover(ctx, false)
+			lastSelectedTipHash = ""
+			lastChainChangedCount = atomic.LoadUint64(&p.chainChangedCount)
+		}
+	}
+}
+
+// requestRecovery asks the connection supervisor to recover the database
+// and the notifications. Requests made while one is pending are merged.
+func (p *Processing) requestRecovery() {
+	select {
+	case p.recoveryRequests <- struct{}{}:
+	default:
+	}
+}
+
+// recover backfills the blocks missed in the meantime, after connecting again
+// to the node and registering for notifications if `reconnect` is set or if
+// the node stops responding. Failed attempts are retried with an exponential
+// backoff until one succeeds or `ctx` is done.
+func (p *Processing) recover(ctx context.Context, reconnect bool) {
+	backoff := minReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		var err error
+		if reconnect {
+			err = p.reconnect(ctx)
+			if err == nil {
+				reconnect = false
+			}
+		}
+		if err == nil {
+			err = p.backfill(ctx)
+		}
+		if err == nil {
+			log.Infof("Recovered after %d attempt(s)", attempt)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !reconnect {
+			_, pingErr := p.rpcClient.GetSelectedTipHash()
+			reconnect = pingErr != nil
+		}
+		log.Warnf("Recovery attempt %d failed: %s -- Retrying in %s", attempt, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// reconnect replaces the RPC client with a new connection to the node, and
+// registers for notifications on it. The previous client is closed, which
+// drops its notification handlers.
+func (p *Processing) reconnect(ctx context.Context) error {
+	rpcClient, err := p.dialNodeClientContext(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "could not reconnect")
+	}
+	_, err = rpcClient.GetSelectedTipHash()
+	if err != nil {
+		_ = rpcClient.Close()
+		return errors.Wrapf(err, "node is not responding")
+	}
+
+	p.Lock()
+	p.rpcClientLock.Lock()
+	if p.stopping() {
+		// Stop already closed the previous client
+		p.rpcClientLock.Unlock()
+		p.Unlock()
+		_ = rpcClient.Close()
+		return errors.Errorf("processing is stopping")
+	}
+	previousRPCClient := p.rpcClient
+	p.rpcClient = rpcClient
+	p.rpcClientLock.Unlock()
+	p.Unlock()
+	if previousRPCClient != rpcClient {
+		err = previousRPCClient.Close()
+		if err != nil {
+			log.Debugf("Could not close the previous RPC client: %s", err)
+		}
+	}
+
+	// Registering before backfilling makes sure that no block falls in between
+	err = p.initConsensusEventsHandler()
+	if err != nil {
+		return errors.Wrapf(err, "could not register for notifications")
+	}
+	return nil
+}
+
+// dialNodeClientContext opens a new connection to the node, giving up when
+// `ctx` is done. A connection completed after that is closed.
+func (p *Processing) dialNodeClientContext(ctx context.Context) (NodeClient, error) {
+	type dialResult struct {
+		rpcClient NodeClient
+		err       error
+	}
+	results := make(chan dialResult, 1)
+	go func() {
+		rpcClient, err := p.dialNodeClient()
+		results <- dialResult{rpcClient: rpcClient, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		return result.rpcClient, result.err
+	case <-ctx.Done():
+		go func() {
+			result := <-results
+			if result.err == nil {
+				_ = result.rpcClient.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// backfill adds the blocks received by the node while the notifications were
+// not processed, walking the DAG from the highest virtual selected parent
+// chain block of the database, then resyncs the virtual selected parent chain
+func (p *Processing) backfill(ctx context.Context) error {
+	p.Lock()
+	defer p.Unlock()
+
+	log.Infof("Backfilling database")
+	defer log.Infof("Finished backfilling database")
+
+	var lowHash string
+	err := p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		highestBlock, err := p.database.HighestBlockInVirtualSelectedParentChain(databaseTransaction)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get highest block in virtual selected parent chain")
+		}
+		lowHash = highestBlock.BlockHash
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	selectedTip, err := p.rpcClient.GetSelectedTipHash()
+	if err != nil {
+		return err
+	}
+
+	addedCount := 0
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		getBlocks, err := p.rpcClient.GetBlocks(lowHash, true, p.includeTransactions())
+		if err != nil {
+			return err
+		}
+		if len(getBlocks.Blocks) != len(getBlocks.BlockHashes) {
+			return errors.Errorf("GetBlocks returned %d blocks for %d hashes", len(getBlocks.Blocks), len(getBlocks.BlockHashes))
+		}
+		blocks, err := nodeBlocksFromRPCBlocks(getBlocks.BlockHashes, getBlocks.Blocks)
+		if err != nil {
+			return err
+		}
+
+		err = p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+			for _, block := range blocks {
+				err := p.processBlockAndDependencies(databaseTransaction, block.hash, block.block, block.verboseData, nil, nil)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		addedCount += len(blocks)
+
+		if len(getBlocks.BlockHashes) == 0 || containsHash(getBlocks.BlockHashes, selectedTip.SelectedTipHash) ||
+			getBlocks.BlockHashes[len(getBlocks.BlockHashes)-1] == lowHash {
+			break
+		}
+		lowHash = getBlocks.BlockHashes[len(getBlocks.BlockHashes)-1]
+	}
+	log.Infof("Checked %d blocks from the node", addedCount)
+
+	return p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		return p.resyncVirtualSelectedParentChain(databaseTransaction, true)
+	})
+}
+
+func containsHash(hashes []string, hash string) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package processing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/fakenode"
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name string
+		// disconnect makes the node lose its connection and notification
+		// handlers before the recovery
+		disconnect bool
+		reconnect  bool
+		// dialCount includes the dials failing while the node is disconnected
+		dialCount int
+	}{
+		{name: "lost connection", disconnect: true, reconnect: true, dialCount: 2},
+		{name: "notifications failed to be processed", reconnect: false, dialCount: 0},
+		{name: "lost connection found while backfilling", disconnect: true, reconnect: false, dialCount: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := fakenode.New()
+			processing := newTestProcessing(t, node)
+			err := processing.initConsensusEventsHandler()
+			if err != nil {
+				t.Fatalf("initConsensusEventsHandler: %s", err)
+			}
+			dialCount := 0
+			processing.dialNodeClient = func() (NodeClient, error) {
+				dialCount++
+				return node.Dial()
+			}
+
+			if test.disconnect {
+				node.SetConnected(false)
+				// The node comes back while the first recovery attempt waits for its backoff
+				time.AfterFunc(10*time.Millisecond, func() { node.SetConnected(true) })
+			}
+			a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{node.Genesis()}})
+			err = node.SetSelectedTip(a)
+			if err != nil {
+				t.Fatalf("SetSelectedTip: %s", err)
+			}
+
+			processing.recover(context.Background(), test.reconnect)
+			if storedBlock(t, processing, a) == nil {
+				t.Errorf("block %s was not backfilled", a)
+			}
+			if dialCount != test.dialCount {
+				t.Errorf("dials: got %d, want %d", dialCount, test.dialCount)
+			}
+
+			// The notifications of the node reach the event queue again
+			queued := processing.eventQueue.Stats().Depth
+			b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a}})
+			err = node.NotifyBlockAdded(b)
+			if err != nil {
+				t.Fatalf("NotifyBlockAdded: %s", err)
+			}
+			if depth := processing.eventQueue.Stats().Depth; depth != queued+1 {
+				t.Errorf("event queue depth: got %d, want %d", depth, queued+1)
+			}
+		})
+	}
+}
+
+func TestReconnectCancelled(t *testing.T) {
+	node := fakenode.New()
+	processing := newTestProcessing(t, node)
+	dialing := make(chan struct{})
+	processing.dialNodeClient = func() (NodeClient, error) {
+		<-dialing
+		return node.Dial()
+	}
+	defer close(dialing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := processing.reconnect(ctx)
+	if err == nil {
+		t.Fatalf("reconnect: got no error while the dial hangs")
+	}
+	if ctx.Err() == nil {
+		t.Errorf("reconnect returned before its context was done: %s", err)
+	}
+}
+
+// blockingNodeClient is a node client whose GetBlock requests hang until the
+// client is closed
+type blockingNodeClient struct {
+	*fakenode.Node
+	requested chan struct{}
+	closed    chan struct{}
+}
+
+func (c *blockingNodeClient) GetBlock(hash string, includeTransactions bool) (*appmessage.GetBlockResponseMessage, error) {
+	c.requested <- struct{}{}
+	<-c.closed
+	return nil, errors.Errorf("the client is closed")
+}
+
+func (c *blockingNodeClient) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestStopUnblocksRequests(t *testing.T) {
+	node := fakenode.New()
+	processing := newTestProcessing(t, node)
+	rpcClient := &blockingNodeClient{
+		Node:      node,
+		requested: make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+	processing.rpcClient = rpcClient
+
+	// The chain block is not stored, so its merge set is requested from the node
+	a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{node.Genesis()}})
+	processed := make(chan error, 1)
+	go func() {
+		processed <- processing.ProcessVirtualChange(&externalapi.VirtualChangeSet{
+			VirtualSelectedParentChainChanges: &externalapi.SelectedChainPath{
+				Added:   []*externalapi.DomainHash{a},
+				Removed: []*externalapi.DomainHash{},
+			},
+		}, nil, time.Now())
+	}()
+	<-rpcClient.requested
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := processing.Stop(ctx)
+	if err != nil {
+		t.Fatalf("Stop: %s", err)
+	}
+	if err := <-processed; err == nil {
+		t.Errorf("ProcessVirtualChange: got no error from the closed client")
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	node := fakenode.New()
+	processing := newTestProcessing(t, node)
+
+	// A transaction in flight holds the processing lock until released
+	inTransaction := make(chan struct{})
+	release := make(chan struct{})
+	transactionDone := make(chan error, 1)
+	go func() {
+		processing.Lock()
+		defer processing.Unlock()
+		transactionDone <- processing.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+			close(inTransaction)
+			<-release
+			_, err := processing.database.DoesBlockExist(databaseTransaction, node.Genesis())
+			return err
+		})
+	}()
+	<-inTransaction
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := processing.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop: got %v, want the error of its context", err)
+	}
+
+	close(release)
+	if err := <-transactionDone; err == nil {
+		t.Errorf("RunInTransaction: got no error from the interrupted transaction")
+	}
+	locked := make(chan struct{})
+	go func() {
+		processing.Lock()
+		processing.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Errorf("the processing lock is still held after Stop")
+	}
+}
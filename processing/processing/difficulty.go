@@ -0,0 +1,113 @@
+package processing
+
+import (
+	"math/big"
+	"sort"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/util/difficulty"
+	"github.com/pkg/errors"
+)
+
+// blockDifficulty returns the difficulty of a block having the target `bits`,
+// relative to the highest target of the network
+func (p *Processing) blockDifficulty(bits uint32) float64 {
+	target := difficulty.CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return 0
+	}
+	result, _ := new(big.Float).Quo(new(big.Float).SetInt(p.config.NetParams().PowMax), new(big.Float).SetInt(target)).Float64()
+	return result
+}
+
+// hashesPerDifficulty returns the expected number of hashes needed to mine a
+// block of difficulty 1
+func (p *Processing) hashesPerDifficulty() float64 {
+	oneLsh256 := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 256))
+	result, _ := new(big.Float).Quo(oneLsh256, new(big.Float).SetInt(p.config.NetParams().PowMax)).Float64()
+	return result
+}
+
+// storeDifficultySamples stores a difficulty sample for the DAA scores of
+// `blocks` not sampled yet, all blocks being already stored in the database.
+// The hashrate of a sample is estimated from the samples of the DAA window
+// ending at it: the mean expected hashes per block times the DAA score rate.
+func (p *Processing) storeDifficultySamples(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	windowSize := uint64(p.config.NetParams().DifficultyAdjustmentWindowSize)
+
+	newSamples := make(map[uint64]*model.DifficultySample)
+	lowDAAScore, highDAAScore := blocks[0].block.Header.DAAScore(), blocks[0].block.Header.DAAScore()
+	for _, block := range blocks {
+		header := block.block.Header
+		if _, ok := newSamples[header.DAAScore()]; ok {
+			continue
+		}
+		blockID, err := p.database.BlockIDByHash(databaseTransaction, block.hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for block %s", block.hash)
+		}
+		newSamples[header.DAAScore()] = &model.DifficultySample{
+			DAAScore:   header.DAAScore(),
+			BlockID:    blockID,
+			Timestamp:  header.TimeInMilliseconds(),
+			Bits:       header.Bits(),
+			Difficulty: p.blockDifficulty(header.Bits()),
+		}
+		if header.DAAScore() < lowDAAScore {
+			lowDAAScore = header.DAAScore()
+		}
+		if header.DAAScore() > highDAAScore {
+			highDAAScore = header.DAAScore()
+		}
+	}
+
+	storedSamples, err := p.database.DifficultySamplesBetweenDAAScores(databaseTransaction,
+		saturatingSub(lowDAAScore, windowSize), highDAAScore)
+	if err != nil {
+		return errors.Wrapf(err, "Could not get the difficulty samples between DAA scores %d and %d",
+			saturatingSub(lowDAAScore, windowSize), highDAAScore)
+	}
+	samples := storedSamples
+	for _, stored := range storedSamples {
+		delete(newSamples, stored.DAAScore)
+	}
+	for _, sample := range newSamples {
+		samples = append(samples, sample)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].DAAScore < samples[j].DAAScore })
+
+	hashesPerDifficulty := p.hashesPerDifficulty()
+	difficultySums := make([]float64, len(samples)+1)
+	for i, sample := range samples {
+		difficultySums[i+1] = difficultySums[i] + sample.Difficulty
+	}
+	rows := make([]*model.DifficultySample, 0, len(newSamples))
+	windowStart := 0
+	for i, sample := range samples {
+		for samples[windowStart].DAAScore+windowSize < sample.DAAScore {
+			windowStart++
+		}
+		if _, ok := newSamples[sample.DAAScore]; !ok {
+			continue
+		}
+		first := samples[windowStart]
+		elapsedMilliseconds := sample.Timestamp - first.Timestamp
+		if sample.DAAScore > first.DAAScore && elapsedMilliseconds > 0 {
+			meanDifficulty := (difficultySums[i+1] - difficultySums[windowStart]) / float64(i-windowStart+1)
+			hashrate := meanDifficulty * hashesPerDifficulty *
+				float64(sample.DAAScore-first.DAAScore) / (float64(elapsedMilliseconds) / 1000)
+			sample.Hashrate = &hashrate
+		}
+		rows = append(rows, sample)
+	}
+
+	err = p.database.InsertDifficultySamples(databaseTransaction, rows)
+	if err != nil {
+		return errors.Wrapf(err, "Could not store %d difficulty samples", len(rows))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package eventqueue
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+)
+
+// Event is a node notification waiting to be processed.
+// Exactly one of Block and ChainChanges is set. AcceptedTransactionIDs are
+// the transactions accepted by the chain blocks added by ChainChanges.
+// ReceivedAt is the arrival time of the notification.
+type Event struct {
+	Block                  *externalapi.DomainBlock
+	ChainChanges           *externalapi.SelectedChainPath
+	AcceptedTransactionIDs []*appmessage.AcceptedTransactionIDs
+	ReceivedAt             time.Time
+	EnqueuedAt             time.Time
+}
+
+// Run is a sequence of consecutive events of the same kind, processed at once.
+// Blocks keep their arrival order while chain changes are merged into their
+// net chain diff, ChainChanges. NotifiedChainChanges are the merged chain
+// changes as notified, and ReceivedAts the arrival times of the events.
+type Run struct {
+	Blocks                 []*externalapi.DomainBlock
+	ReceivedAts            []time.Time
+	ChainChanges           *externalapi.SelectedChainPath
+	NotifiedChainChanges   []*externalapi.SelectedChainPath
+	AcceptedTransactionIDs []*appmessage.AcceptedTransactionIDs
+	EventCount             int
+	oldestEvent            time.Time
+}
+
+// Stats are the queue depth and the processing latency, measured from the
+// enqueuing of an event to the end of the processing of its run
+type Stats struct {
+	Depth           int
+	Capacity        int
+	ProcessedEvents uint64
+	LastLatency     time.Duration
+	AverageLatency  time.Duration
+}
+
+// Queue is a bounded queue of events with a single consumer
+type Queue struct {
+	events  chan *Event
+	pending *Event
+
+	processedEvents uint64
+	totalLatency    int64
+	lastLatency     int64
+}
+
+// New creates a Queue holding at most `capacity` events
+func New(capacity int) *Queue {
+	return &Queue{
+		events: make(chan *Event, capacity),
+	}
+}
+
+// Push enqueues `event` without blocking.
+// Returns false if the queue is full, in which case the event is dropped.
+func (q *Queue) Push(event *Event) bool {
+	event.EnqueuedAt = time.Now()
+	select {
+	case q.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// NextRun waits for the next event, then collects the events of the same
+// kind that directly follow it and are already queued, up to `maxBlocks`
+// blocks. Returns false once `ctx` is done.
+func (q *Queue) NextRun(ctx context.Context, maxBlocks int) (*Run, bool) {
+	first := q.pending
+	q.pending = nil
+	if first == nil {
+		select {
+		case first = <-q.events:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+
+	run := &Run{
+		oldestEvent: first.EnqueuedAt,
+	}
+	addToRun(run, first)
+
+	for run.Blocks == nil || len(run.Blocks) < maxBlocks {
+		var next *Event
+		select {
+		case next = <-q.events:
+		default:
+			return run, true
+		}
+		if (next.Block != nil) != (run.Blocks != nil) {
+			q.pending = next
+			return run, true
+		}
+		addToRun(run, next)
+	}
+	return run, true
+}
+
+// addToRun adds `event` to `run`, whose events are of the same kind
+func addToRun(run *Run, event *Event) {
+	if event.Block != nil {
+		run.Blocks = append(run.Blocks, event.Block)
+	} else {
+		if run.ChainChanges == nil {
+			run.ChainChanges = &externalapi.SelectedChainPath{
+				Added:   []*externalapi.DomainHash{},
+				Removed: []*externalapi.DomainHash{},
+			}
+		}
+		MergeChainChanges(run.ChainChanges, event.ChainChanges)
+		run.NotifiedChainChanges = append(run.NotifiedChainChanges, event.ChainChanges)
+		run.AcceptedTransactionIDs = append(run.AcceptedTransactionIDs, event.AcceptedTransactionIDs...)
+	}
+	run.ReceivedAts = append(run.ReceivedAts, event.ReceivedAt)
+	run.EventCount++
+}
+
+// Done records the processing latency of `run`
+func (q *Queue) Done(run *Run) {
+	latency := int64(time.Since(run.oldestEvent))
+	atomic.StoreInt64(&q.lastLatency, latency)
+	atomic.AddInt64(&q.totalLatency, latency*int64(run.EventCount))
+	atomic.AddUint64(&q.processedEvents, uint64(run.EventCount))
+}
+
+// Stats returns the current queue depth and the processing latencies
+func (q *Queue) Stats() Stats {
+	stats := Stats{
+		Depth:           len(q.events),
+		Capacity:        cap(q.events),
+		ProcessedEvents: atomic.LoadUint64(&q.processedEvents),
+		LastLatency:     time.Duration(atomic.LoadInt64(&q.lastLatency)),
+	}
+	if stats.ProcessedEvents > 0 {
+		stats.AverageLatency = time.Duration(atomic.LoadInt64(&q.totalLatency) / int64(stats.ProcessedEvents))
+	}
+	return stats
+}
+
+// MergeChainChanges applies `next` on top of `net`, so that `net` becomes the
+// chain diff of both changes. A block added then removed cancels out.
+// `Removed` is ordered from the highest to the lowest block and `Added` from
+// the lowest to the highest, like in the node notifications.
+func MergeChainChanges(net *externalapi.SelectedChainPath, next *externalapi.SelectedChainPath) {
+	for _, removed := range next.Removed {
+		if len(net.Added) > 0 && net.Added[len(net.Added)-1].Equal(removed) {
+			net.Added = net.Added[:len(net.Added)-1]
+			continue
+		}
+		net.Removed = append(net.Removed, removed)
+	}
+	net.Added = append(net.Added, next.Added...)
+}
@@ -0,0 +1,163 @@
+package eventqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+)
+
+func testHash(hashByte byte) *externalapi.DomainHash {
+	return externalapi.NewDomainHashFromByteArray(&[externalapi.DomainHashSize]byte{hashByte})
+}
+
+func testHashes(hashBytes ...byte) []*externalapi.DomainHash {
+	hashes := make([]*externalapi.DomainHash, len(hashBytes))
+	for i, hashByte := range hashBytes {
+		hashes[i] = testHash(hashByte)
+	}
+	return hashes
+}
+
+func TestNextRun(t *testing.T) {
+	block := &externalapi.DomainBlock{}
+	chainChanges := func(hashByte byte) *externalapi.SelectedChainPath {
+		return &externalapi.SelectedChainPath{Added: testHashes(hashByte), Removed: testHashes()}
+	}
+	at := func(millis int64) time.Time {
+		return time.UnixMilli(millis)
+	}
+
+	tests := []struct {
+		name   string
+		events []*Event
+		// runs are the expected event counts of the runs, negative for chain changes
+		runs []int
+	}{
+		{
+			name:   "blocks are processed at once",
+			events: []*Event{{Block: block, ReceivedAt: at(1)}, {Block: block, ReceivedAt: at(2)}},
+			runs:   []int{2},
+		},
+		{
+			name: "blocks are bounded per run",
+			events: []*Event{{Block: block, ReceivedAt: at(1)}, {Block: block, ReceivedAt: at(2)},
+				{Block: block, ReceivedAt: at(3)}, {Block: block, ReceivedAt: at(4)}},
+			runs: []int{3, 1},
+		},
+		{
+			name: "consecutive chain changes are merged",
+			events: []*Event{{ChainChanges: chainChanges(1), ReceivedAt: at(1)},
+				{ChainChanges: chainChanges(2), ReceivedAt: at(2)}},
+			runs: []int{-2},
+		},
+		{
+			name: "chain changes split the blocks",
+			events: []*Event{{Block: block, ReceivedAt: at(1)}, {ChainChanges: chainChanges(1), ReceivedAt: at(2)},
+				{Block: block, ReceivedAt: at(3)}, {Block: block, ReceivedAt: at(4)}},
+			runs: []int{1, -1, 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := New(len(test.events))
+			for _, event := range test.events {
+				if !queue.Push(event) {
+					t.Fatalf("Push: queue is full")
+				}
+			}
+
+			eventIndex := 0
+			for i, runEventCount := range test.runs {
+				run, ok := queue.NextRun(context.Background(), 3)
+				if !ok {
+					t.Fatalf("run %d: NextRun returned false", i)
+				}
+				eventCount := runEventCount
+				if runEventCount < 0 {
+					eventCount = -runEventCount
+					if run.Blocks != nil || len(run.NotifiedChainChanges) != eventCount {
+						t.Fatalf("run %d: got %d blocks and %d chain changes, want %d chain changes",
+							i, len(run.Blocks), len(run.NotifiedChainChanges), eventCount)
+					}
+					for j, notified := range run.NotifiedChainChanges {
+						if notified != test.events[eventIndex+j].ChainChanges {
+							t.Errorf("run %d: chain changes %d: got %v, want %v", i, j, notified, test.events[eventIndex+j].ChainChanges)
+						}
+					}
+				} else if len(run.Blocks) != eventCount || run.ChainChanges != nil {
+					t.Fatalf("run %d: got %d blocks and chain changes %v, want %d blocks", i, len(run.Blocks), run.ChainChanges, eventCount)
+				}
+				if run.EventCount != eventCount || len(run.ReceivedAts) != eventCount {
+					t.Fatalf("run %d: got %d events and %d arrival times, want %d",
+						i, run.EventCount, len(run.ReceivedAts), eventCount)
+				}
+				for j, receivedAt := range run.ReceivedAts {
+					if !receivedAt.Equal(test.events[eventIndex+j].ReceivedAt) {
+						t.Errorf("run %d: arrival time %d: got %s, want %s", i, j, receivedAt, test.events[eventIndex+j].ReceivedAt)
+					}
+				}
+				eventIndex += eventCount
+				queue.Done(run)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if _, ok := queue.NextRun(ctx, 3); ok {
+				t.Errorf("NextRun returned a run past the expected ones")
+			}
+		})
+	}
+}
+
+func TestMergeChainChanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		changes     []*externalapi.SelectedChainPath
+		wantAdded   []*externalapi.DomainHash
+		wantRemoved []*externalapi.DomainHash
+	}{
+		{
+			name: "extensions add up",
+			changes: []*externalapi.SelectedChainPath{
+				{Added: testHashes(1), Removed: testHashes()},
+				{Added: testHashes(2, 3), Removed: testHashes()},
+			},
+			wantAdded:   testHashes(1, 2, 3),
+			wantRemoved: testHashes(),
+		},
+		{
+			name: "a block added then removed cancels out",
+			changes: []*externalapi.SelectedChainPath{
+				{Added: testHashes(1, 2), Removed: testHashes()},
+				{Added: testHashes(3), Removed: testHashes(2)},
+			},
+			wantAdded:   testHashes(1, 3),
+			wantRemoved: testHashes(),
+		},
+		{
+			name: "a reorg below the merged blocks removes stored chain blocks",
+			changes: []*externalapi.SelectedChainPath{
+				{Added: testHashes(1), Removed: testHashes()},
+				{Added: testHashes(3, 4), Removed: testHashes(1, 2)},
+			},
+			wantAdded:   testHashes(3, 4),
+			wantRemoved: testHashes(2),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			net := &externalapi.SelectedChainPath{Added: testHashes(), Removed: testHashes()}
+			for _, change := range test.changes {
+				MergeChainChanges(net, change)
+			}
+			if !externalapi.HashesEqual(net.Added, test.wantAdded) {
+				t.Errorf("added: got %v, want %v", net.Added, test.wantAdded)
+			}
+			if !externalapi.HashesEqual(net.Removed, test.wantRemoved) {
+				t.Errorf("removed: got %v, want %v", net.Removed, test.wantRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package processing
+
+import (
+	"context"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/eventqueue"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+)
+
+// maxBlocksPerTransaction bounds the number of queued blocks processed
+// within a single transaction
+const maxBlocksPerTransaction = 100
+
+// enqueueEvent hands `event` over to the events consumer without blocking the
+// notification dispatch. An event dropped because the queue is full triggers
+// a recovery, which backfills the database from the node.
+func (p *Processing) enqueueEvent(event *eventqueue.Event) {
+	if !p.eventQueue.Push(event) {
+		log.Warnf("Event queue is full (%d events), dropping event", p.eventQueue.Stats().Capacity)
+		p.requestRecovery()
+	}
+}
+
+// consumeEvents processes the queued events until `ctx` is done.
+// Bursts of blocks are processed in a single transaction and consecutive
+// chain changes are merged into their net chain diff.
+func (p *Processing) consumeEvents(ctx context.Context) {
+	for {
+		run, ok := p.eventQueue.NextRun(ctx, maxBlocksPerTransaction)
+		if !ok {
+			return
+		}
+
+		var err error
+		if run.Blocks != nil {
+			err = p.ProcessBlocks(run.Blocks, run.ReceivedAts)
+		} else {
+			err = p.processChainChangeRun(run)
+		}
+		p.eventQueue.Done(run)
+		if err != nil {
+			log.Errorf("Failed to process %d queued consensus event(s): %s", run.EventCount, err)
+			p.requestRecovery()
+		}
+	}
+}
+
+// processChainChangeRun applies the net chain diff of the chain changes of
+// `run` in a single transaction, which records each of them in the chain
+// changes log
+func (p *Processing) processChainChangeRun(run *eventqueue.Run) error {
+	chainChangeRecords := make([]*model.ChainChange, len(run.NotifiedChainChanges))
+	for i, chainChanges := range run.NotifiedChainChanges {
+		chainChangeRecords[i] = newChainChangeRecord(chainChanges, run.ReceivedAts[i])
+	}
+	blockInsertionResult := &externalapi.VirtualChangeSet{
+		VirtualSelectedParentChainChanges: run.ChainChanges,
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	return p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		return p.processVirtualChange(databaseTransaction, blockInsertionResult, run.AcceptedTransactionIDs, chainChangeRecords, true)
+	})
+}
+
+// EventQueueStats returns the depth and the processing latency of the
+// queue of node notifications
+func (p *Processing) EventQueueStats() eventqueue.Stats {
+	return p.eventQueue.Stats()
+}
@@ -0,0 +1,532 @@
+package fakenode
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/utils/blockheader"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/utils/consensushashing"
+	"github.com/karlsen-network/karlsend/v2/infrastructure/network/rpcclient"
+	"github.com/pkg/errors"
+)
+
+const defaultPageSize = 100
+
+// BlockTemplate describes a block added to the fake DAG.
+// Zero verbose data fields get the values of a block selecting its first
+// parent and merging only this parent as blue.
+type BlockTemplate struct {
+	Parents        []*externalapi.DomainHash
+	SelectedParent *externalapi.DomainHash
+	MergeSetBlues  []*externalapi.DomainHash
+	MergeSetReds   []*externalapi.DomainHash
+	Timestamp      int64
+	DAAScore       uint64
+	BlueScore      uint64
+	IsHeaderOnly   bool
+}
+
+type block struct {
+	domainBlock    *externalapi.DomainBlock
+	selectedParent *externalapi.DomainHash
+	mergeSetBlues  []*externalapi.DomainHash
+	mergeSetReds   []*externalapi.DomainHash
+	isHeaderOnly   bool
+	isAvailable    bool
+	children       []*externalapi.DomainHash
+}
+
+// Node is an in-memory and scriptable stand-in for karlsend. It implements
+// the node client interface of the processing tier, so that the whole sync
+// engine can run without a live node.
+//
+// Blocks are served in the order they were added. Notifications are not
+// sent by the node by itself but when a script calls NotifyBlockAdded or
+// SetSelectedTip, synchronously in the calling goroutine.
+type Node struct {
+	blocks       map[externalapi.DomainHash]*block
+	order        []*externalapi.DomainHash
+	chain        []*externalapi.DomainHash
+	pruningPoint *externalapi.DomainHash
+	pageSize     int
+	nonce        uint64
+	isConnected  bool
+
+	onBlockAdded   func(notification *appmessage.BlockAddedNotificationMessage)
+	onChainChanged func(notification *appmessage.VirtualSelectedParentChainChangedNotificationMessage)
+
+	sync.Mutex
+}
+
+// New creates a Node whose DAG only contains a genesis block, which is
+// both the pruning point and the selected tip
+func New() *Node {
+	node := &Node{
+		blocks:      make(map[externalapi.DomainHash]*block),
+		order:       make([]*externalapi.DomainHash, 0),
+		pageSize:    defaultPageSize,
+		isConnected: true,
+	}
+	genesisHash := node.addBlock(&BlockTemplate{
+		Parents:   []*externalapi.DomainHash{},
+		Timestamp: 1,
+	})
+	node.pruningPoint = genesisHash
+	node.chain = []*externalapi.DomainHash{genesisHash}
+	return node
+}
+
+// Genesis returns the hash of the first block of the DAG
+func (n *Node) Genesis() *externalapi.DomainHash {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.order[0]
+}
+
+// AddBlock adds a block described by `template` to the DAG and returns its
+// hash. Parents unknown to the node are kept in the header, which simulates
+// a block whose parents were never seen.
+func (n *Node) AddBlock(template *BlockTemplate) *externalapi.DomainHash {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.addBlock(template)
+}
+
+func (n *Node) addBlock(template *BlockTemplate) *externalapi.DomainHash {
+	selectedParent := template.SelectedParent
+	if selectedParent == nil && len(template.Parents) > 0 {
+		selectedParent = template.Parents[0]
+	}
+	mergeSetBlues := template.MergeSetBlues
+	if mergeSetBlues == nil && selectedParent != nil {
+		mergeSetBlues = []*externalapi.DomainHash{selectedParent}
+	}
+	mergeSetReds := template.MergeSetReds
+	if mergeSetReds == nil {
+		mergeSetReds = []*externalapi.DomainHash{}
+	}
+
+	timestamp := template.Timestamp
+	daaScore := template.DAAScore
+	blueScore := template.BlueScore
+	for _, parentHash := range template.Parents {
+		parent, ok := n.blocks[*parentHash]
+		if !ok {
+			continue
+		}
+		if template.Timestamp == 0 && parent.domainBlock.Header.TimeInMilliseconds() >= timestamp {
+			timestamp = parent.domainBlock.Header.TimeInMilliseconds() + 1000
+		}
+		if template.DAAScore == 0 && parent.domainBlock.Header.DAAScore() >= daaScore {
+			daaScore = parent.domainBlock.Header.DAAScore() + 1
+		}
+	}
+	if template.BlueScore == 0 && selectedParent != nil {
+		if parent, ok := n.blocks[*selectedParent]; ok {
+			blueScore = parent.domainBlock.Header.BlueScore() + uint64(len(mergeSetBlues))
+		}
+	}
+
+	// The nonce makes blocks built from identical templates distinct
+	n.nonce++
+	header := blockheader.NewImmutableBlockHeader(
+		0,
+		[]externalapi.BlockLevelParents{template.Parents},
+		externalapi.NewZeroHash(),
+		externalapi.NewZeroHash(),
+		externalapi.NewZeroHash(),
+		timestamp,
+		0,
+		n.nonce,
+		daaScore,
+		blueScore,
+		big.NewInt(int64(blueScore)),
+		externalapi.NewZeroHash(),
+	)
+	domainBlock := &externalapi.DomainBlock{
+		Header:       header,
+		Transactions: []*externalapi.DomainTransaction{},
+	}
+	hash := consensushashing.BlockHash(domainBlock)
+
+	n.blocks[*hash] = &block{
+		domainBlock:    domainBlock,
+		selectedParent: selectedParent,
+		mergeSetBlues:  mergeSetBlues,
+		mergeSetReds:   mergeSetReds,
+		isHeaderOnly:   template.IsHeaderOnly,
+		isAvailable:    true,
+		children:       []*externalapi.DomainHash{},
+	}
+	n.order = append(n.order, hash)
+	for _, parentHash := range template.Parents {
+		if parent, ok := n.blocks[*parentHash]; ok {
+			parent.children = append(parent.children, hash)
+		}
+	}
+	return hash
+}
+
+// DomainBlock returns the block identified by `hash`, whether it is
+// available or not
+func (n *Node) DomainBlock(hash *externalapi.DomainHash) (*externalapi.DomainBlock, bool) {
+	n.Lock()
+	defer n.Unlock()
+
+	b, ok := n.blocks[*hash]
+	if !ok {
+		return nil, false
+	}
+	return b.domainBlock, true
+}
+
+// SetAvailable sets whether the node serves the block identified by `hash`.
+// An unavailable block is still part of the DAG but cannot be fetched,
+// which simulates a dependency out of the node scope.
+func (n *Node) SetAvailable(hash *externalapi.DomainHash, isAvailable bool) {
+	n.Lock()
+	defer n.Unlock()
+
+	if b, ok := n.blocks[*hash]; ok {
+		b.isAvailable = isAvailable
+	}
+}
+
+// SetPruningPoint moves the pruning point to the block identified by `hash`
+func (n *Node) SetPruningPoint(hash *externalapi.DomainHash) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.pruningPoint = hash
+}
+
+// SetPageSize sets the maximum number of blocks returned by GetBlocks
+func (n *Node) SetPageSize(pageSize int) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.pageSize = pageSize
+}
+
+// SetConnected simulates a lost connection to the node or its restart.
+// While disconnected, all calls fail. Disconnecting drops the notification
+// handlers, which have to be registered again once reconnected.
+func (n *Node) SetConnected(isConnected bool) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.isConnected = isConnected
+	if !isConnected {
+		n.onBlockAdded = nil
+		n.onChainChanged = nil
+	}
+}
+
+func (n *Node) checkConnected() error {
+	if !n.isConnected {
+		return errors.Errorf("not connected to the node")
+	}
+	return nil
+}
+
+// NotifyBlockAdded sends a BlockAdded notification for the block
+// identified by `hash`
+func (n *Node) NotifyBlockAdded(hash *externalapi.DomainHash) error {
+	n.Lock()
+	rpcBlock, err := n.rpcBlock(hash)
+	onBlockAdded := n.onBlockAdded
+	n.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if onBlockAdded != nil {
+		onBlockAdded(appmessage.NewBlockAddedNotificationMessage(rpcBlock))
+	}
+	return nil
+}
+
+// SetSelectedTip makes the selected parent chain of the block identified by
+// `tip` the new virtual selected parent chain, and sends the matching
+// VirtualSelectedParentChainChanged notification. A tip outside the current
+// chain results in a reorg whose depth is the number of removed blocks.
+func (n *Node) SetSelectedTip(tip *externalapi.DomainHash) error {
+	n.Lock()
+	added, forkIndex, err := n.pathToChain(tip)
+	if err != nil {
+		n.Unlock()
+		return err
+	}
+	removed := make([]*externalapi.DomainHash, 0, len(n.chain)-forkIndex-1)
+	for i := len(n.chain) - 1; i > forkIndex; i-- {
+		removed = append(removed, n.chain[i])
+	}
+	for i, j := 0, len(added)-1; i < j; i, j = i+1, j-1 {
+		added[i], added[j] = added[j], added[i]
+	}
+	n.chain = append(n.chain[:forkIndex+1:forkIndex+1], added...)
+	onChainChanged := n.onChainChanged
+	n.Unlock()
+
+	if onChainChanged != nil {
+		onChainChanged(appmessage.NewVirtualSelectedParentChainChangedNotificationMessage(
+			hashesToStrings(removed), hashesToStrings(added), nil))
+	}
+	return nil
+}
+
+// pathToChain walks the selected parents of the block identified by `hash`
+// down to the virtual selected parent chain. It returns the blocks walked
+// through outside the chain, from the highest to the lowest, and the chain
+// index of the block where the walk joined the chain
+func (n *Node) pathToChain(hash *externalapi.DomainHash) ([]*externalapi.DomainHash, int, error) {
+	chainIndexes := make(map[externalapi.DomainHash]int, len(n.chain))
+	for i, chainHash := range n.chain {
+		chainIndexes[*chainHash] = i
+	}
+
+	path := make([]*externalapi.DomainHash, 0)
+	current := hash
+	for {
+		if chainIndex, ok := chainIndexes[*current]; ok {
+			return path, chainIndex, nil
+		}
+		b, ok := n.blocks[*current]
+		if !ok || b.selectedParent == nil {
+			return nil, 0, errors.Errorf("block %s is not connected to the selected parent chain", hash)
+		}
+		path = append(path, current)
+		current = b.selectedParent
+	}
+}
+
+func (n *Node) rpcBlock(hash *externalapi.DomainHash) (*appmessage.RPCBlock, error) {
+	b, ok := n.blocks[*hash]
+	if !ok || !b.isAvailable {
+		return nil, errors.Wrapf(rpcclient.ErrRPC, "block %s not found", hash)
+	}
+
+	isChainBlock := false
+	for _, chainHash := range n.chain {
+		if chainHash.Equal(hash) {
+			isChainBlock = true
+			break
+		}
+	}
+	// Like the node, a block without selected parent reports a hash outside the DAG
+	selectedParentHash := externalapi.NewZeroHash().String()
+	if b.selectedParent != nil {
+		selectedParentHash = b.selectedParent.String()
+	}
+
+	rpcBlock := appmessage.DomainBlockToRPCBlock(b.domainBlock)
+	rpcBlock.VerboseData = &appmessage.RPCBlockVerboseData{
+		Hash:                hash.String(),
+		SelectedParentHash:  selectedParentHash,
+		TransactionIDs:      []string{},
+		IsHeaderOnly:        b.isHeaderOnly,
+		BlueScore:           b.domainBlock.Header.BlueScore(),
+		ChildrenHashes:      hashesToStrings(b.children),
+		MergeSetBluesHashes: hashesToStrings(b.mergeSetBlues),
+		MergeSetRedsHashes:  hashesToStrings(b.mergeSetReds),
+		IsChainBlock:        isChainBlock,
+	}
+	return rpcBlock, nil
+}
+
+// GetBlockDAGInfo returns the pruning point, the tips and the virtual DAA score
+func (n *Node) GetBlockDAGInfo() (*appmessage.GetBlockDAGInfoResponseMessage, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	err := n.checkConnected()
+	if err != nil {
+		return nil, err
+	}
+
+	response := appmessage.NewGetBlockDAGInfoResponseMessage()
+	response.NetworkName = "fakenode"
+	response.BlockCount = uint64(len(n.order))
+	response.HeaderCount = uint64(len(n.order))
+	response.PruningPointHash = n.pruningPoint.String()
+	response.TipHashes = []string{}
+	for _, hash := range n.order {
+		b := n.blocks[*hash]
+		if len(b.children) == 0 {
+			response.TipHashes = append(response.TipHashes, hash.String())
+		}
+		if b.domainBlock.Header.DAAScore() >= response.VirtualDAAScore {
+			response.VirtualDAAScore = b.domainBlock.Header.DAAScore() + 1
+		}
+	}
+	response.VirtualParentHashes = []string{n.chain[len(n.chain)-1].String()}
+	return response, nil
+}
+
+// GetBlock returns the block identified by `hash` with its verbose data
+func (n *Node) GetBlock(hash string, includeTransactions bool) (*appmessage.GetBlockResponseMessage, error) {
+	domainHash, err := externalapi.NewDomainHashFromString(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	err = n.checkConnected()
+	if err != nil {
+		return nil, err
+	}
+
+	rpcBlock, err := n.rpcBlock(domainHash)
+	if err != nil {
+		return nil, err
+	}
+	response := appmessage.NewGetBlockResponseMessage()
+	response.Block = rpcBlock
+	return response, nil
+}
+
+// GetBlocks returns a page of the blocks added after `lowHash`, starting
+// with `lowHash` itself
+func (n *Node) GetBlocks(lowHash string, includeBlocks bool, includeTransactions bool) (
+	*appmessage.GetBlocksResponseMessage, error) {
+
+	n.Lock()
+	defer n.Unlock()
+
+	err := n.checkConnected()
+	if err != nil {
+		return nil, err
+	}
+
+	lowIndex := -1
+	for i, hash := range n.order {
+		if hash.String() == lowHash {
+			lowIndex = i
+			break
+		}
+	}
+	if lowIndex < 0 {
+		return nil, errors.Wrapf(rpcclient.ErrRPC, "block %s not found", lowHash)
+	}
+
+	response := appmessage.NewGetBlocksResponseMessage()
+	response.BlockHashes = []string{}
+	response.Blocks = []*appmessage.RPCBlock{}
+	for i := lowIndex; i < len(n.order) && i < lowIndex+n.pageSize; i++ {
+		response.BlockHashes = append(response.BlockHashes, n.order[i].String())
+		if includeBlocks {
+			rpcBlock, err := n.rpcBlock(n.order[i])
+			if err != nil {
+				return nil, err
+			}
+			response.Blocks = append(response.Blocks, rpcBlock)
+		}
+	}
+	return response, nil
+}
+
+// GetSelectedTipHash returns the highest block of the virtual selected parent chain
+func (n *Node) GetSelectedTipHash() (*appmessage.GetSelectedTipHashResponseMessage, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	err := n.checkConnected()
+	if err != nil {
+		return nil, err
+	}
+
+	return appmessage.NewGetSelectedTipHashResponseMessage(n.chain[len(n.chain)-1].String()), nil
+}
+
+// GetVirtualSelectedParentChainFromBlock returns the chain changes between
+// the block identified by `startHash` and the current selected tip
+func (n *Node) GetVirtualSelectedParentChainFromBlock(startHash string, includeAcceptedTransactionIDs bool) (
+	*appmessage.GetVirtualSelectedParentChainFromBlockResponseMessage, error) {
+
+	startDomainHash, err := externalapi.NewDomainHashFromString(startHash)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	err = n.checkConnected()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := n.blocks[*startDomainHash]; !ok {
+		return nil, errors.Wrapf(rpcclient.ErrRPC, "block %s not found", startHash)
+	}
+	removed, forkIndex, err := n.pathToChain(startDomainHash)
+	if err != nil {
+		return nil, err
+	}
+	added := n.chain[forkIndex+1:]
+	return appmessage.NewGetVirtualSelectedParentChainFromBlockResponseMessage(
+		hashesToStrings(removed), hashesToStrings(added), nil), nil
+}
+
+// RegisterForVirtualSelectedParentChainChangedNotifications registers the
+// handler called by SetSelectedTip
+func (n *Node) RegisterForVirtualSelectedParentChainChangedNotifications(includeAcceptedTransactionIDs bool,
+	onChainChanged func(notification *appmessage.VirtualSelectedParentChainChangedNotificationMessage)) error {
+
+	n.Lock()
+	defer n.Unlock()
+
+	err := n.checkConnected()
+	if err != nil {
+		return err
+	}
+
+	n.onChainChanged = onChainChanged
+	return nil
+}
+
+// RegisterForBlockAddedNotifications registers the handler called by NotifyBlockAdded
+func (n *Node) RegisterForBlockAddedNotifications(onBlockAdded func(notification *appmessage.BlockAddedNotificationMessage)) error {
+	n.Lock()
+	defer n.Unlock()
+
+	err := n.checkConnected()
+	if err != nil {
+		return err
+	}
+
+	n.onBlockAdded = onBlockAdded
+	return nil
+}
+
+// Dial connects a client to the node, which is the node itself.
+// It fails while the node is disconnected.
+func (n *Node) Dial() (*Node, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	err := n.checkConnected()
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Close does nothing. A Node can be shared by any number of clients.
+func (n *Node) Close() error {
+	return nil
+}
+
+func hashesToStrings(hashes []*externalapi.DomainHash) []string {
+	strs := make([]string, len(hashes))
+	for i, hash := range hashes {
+		strs[i] = hash.String()
+	}
+	return strs
+}
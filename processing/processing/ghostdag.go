@@ -0,0 +1,200 @@
+package processing
+
+import (
+	"context"
+	"time"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ghostdagBackfillInterval is the interval between two GHOSTDAG data backfill batches
+	ghostdagBackfillInterval = time.Minute
+
+	// ghostdagBackfillBatchSize is the maximum number of blocks of a GHOSTDAG data backfill batch
+	ghostdagBackfillBatchSize = 1000
+)
+
+// SetGHOSTDAGDataSource sets the consensus the GHOSTDAG data of the processed
+// blocks is read from. Without it no GHOSTDAG data is stored.
+func (p *Processing) SetGHOSTDAGDataSource(source GHOSTDAGDataSource) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.ghostdagDataSource = source
+}
+
+// blockGHOSTDAGDataRow returns the GHOSTDAG data row of the block identified by `blockID`
+func (p *Processing) blockGHOSTDAGDataRow(blockID uint64, ghostdagData *externalapi.BlockGHOSTDAGData) *model.BlockGHOSTDAGData {
+	bluesAnticoneSizes := make(map[string]uint8, len(ghostdagData.BluesAnticoneSizes()))
+	for blueHash, anticoneSize := range ghostdagData.BluesAnticoneSizes() {
+		bluesAnticoneSizes[blueHash.String()] = uint8(anticoneSize)
+	}
+	selectedParentHash := ""
+	if ghostdagData.SelectedParent() != nil {
+		selectedParentHash = ghostdagData.SelectedParent().String()
+	}
+	return &model.BlockGHOSTDAGData{
+		BlockID:            blockID,
+		BlueScore:          ghostdagData.BlueScore(),
+		BlueWork:           ghostdagData.BlueWork().String(),
+		SelectedParentHash: selectedParentHash,
+		MergeSetBlues:      hashesToStrings(ghostdagData.MergeSetBlues()),
+		MergeSetReds:       hashesToStrings(ghostdagData.MergeSetReds()),
+		BluesAnticoneSizes: bluesAnticoneSizes,
+		K:                  uint8(p.config.NetParams().K),
+	}
+}
+
+// storeBlocksGHOSTDAGData stores the GHOSTDAG data of `blocks`, all already
+// stored in the database. Blocks the embedded consensus does not know yet are
+// skipped and left to backfillGHOSTDAGData.
+func (p *Processing) storeBlocksGHOSTDAGData(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock) error {
+	if p.ghostdagDataSource == nil {
+		return nil
+	}
+	rows := make([]*model.BlockGHOSTDAGData, 0, len(blocks))
+	for _, block := range blocks {
+		ghostdagData, err := p.ghostdagDataSource.BlockGHOSTDAGData(block.hash)
+		if err != nil {
+			log.Debugf("Could not get the GHOSTDAG data of block %s from the embedded node: %s", block.hash, err)
+			continue
+		}
+		blockID, err := p.database.BlockIDByHash(databaseTransaction, block.hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for block %s", block.hash)
+		}
+		rows = append(rows, p.blockGHOSTDAGDataRow(blockID, ghostdagData))
+	}
+	if len(rows) < len(blocks) {
+		log.Warnf("The embedded node does not know %d of %d blocks yet, their GHOSTDAG data will be backfilled",
+			len(blocks)-len(rows), len(blocks))
+		p.requestGHOSTDAGBackfill()
+	}
+	err := p.database.InsertBlocksGHOSTDAGData(databaseTransaction, rows)
+	if err != nil {
+		return errors.Wrapf(err, "Could not store the GHOSTDAG data of %d blocks", len(rows))
+	}
+	return nil
+}
+
+// requestGHOSTDAGBackfill wakes up the GHOSTDAG data backfill waiting for
+// blocks to be skipped
+func (p *Processing) requestGHOSTDAGBackfill() {
+	select {
+	case p.ghostdagBackfillRequests <- struct{}{}:
+	default:
+	}
+}
+
+// backfillGHOSTDAGData stores the GHOSTDAG data of the blocks skipped while
+// the embedded node was behind. It passes over the blocks without GHOSTDAG
+// data one batch per backfill interval, and once a full pass makes no
+// progress, waits for blocks to be skipped again before the next pass.
+// It returns once `ctx` is done.
+func (p *Processing) backfillGHOSTDAGData(ctx context.Context) {
+	ticker := time.NewTicker(ghostdagBackfillInterval)
+	defer ticker.Stop()
+
+	afterBlockID := uint64(0)
+	passStoredCount := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		nextAfterBlockID, storedCount, err := p.backfillGHOSTDAGDataBatch(afterBlockID)
+		if err != nil {
+			log.Errorf("Could not backfill the GHOSTDAG data: %s", err)
+			continue
+		}
+		afterBlockID = nextAfterBlockID
+		passStoredCount += storedCount
+		if afterBlockID != 0 {
+			continue
+		}
+		if passStoredCount > 0 {
+			passStoredCount = 0
+			continue
+		}
+
+		log.Debugf("The GHOSTDAG data backfill made no progress, waiting for blocks to be skipped")
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.ghostdagBackfillRequests:
+		}
+	}
+}
+
+// backfillGHOSTDAGDataBatch stores the GHOSTDAG data of the next blocks
+// without any, from the block following `afterBlockID`, and returns the block
+// id the next batch starts after, 0 at the end of the pass, along with the
+// number of blocks backfilled. Blocks below the pruning point are left out
+// since the embedded node no longer has their GHOSTDAG data.
+func (p *Processing) backfillGHOSTDAGDataBatch(afterBlockID uint64) (uint64, int, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	dagInfo, err := p.rpcClient.GetBlockDAGInfo()
+	if err != nil {
+		return afterBlockID, 0, err
+	}
+	pruningPointHash, err := externalapi.NewDomainHashFromString(dagInfo.PruningPointHash)
+	if err != nil {
+		return afterBlockID, 0, err
+	}
+
+	nextAfterBlockID := afterBlockID
+	storedCount, skippedCount := 0, 0
+	err = p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		pruningPointID, err := p.database.BlockIDByHash(databaseTransaction, pruningPointHash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for the pruning point %s", pruningPointHash)
+		}
+		pruningPoint, err := p.database.GetBlock(databaseTransaction, pruningPointID)
+		if err != nil {
+			return err
+		}
+		blocks, err := p.database.BlocksWithoutGHOSTDAGData(databaseTransaction, afterBlockID, pruningPoint.DAAScore,
+			ghostdagBackfillBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(blocks) < ghostdagBackfillBatchSize {
+			nextAfterBlockID = 0
+		} else {
+			nextAfterBlockID = blocks[len(blocks)-1].ID
+		}
+
+		rows := make([]*model.BlockGHOSTDAGData, 0, len(blocks))
+		for _, block := range blocks {
+			blockHash, err := externalapi.NewDomainHashFromString(block.BlockHash)
+			if err != nil {
+				return err
+			}
+			ghostdagData, err := p.ghostdagDataSource.BlockGHOSTDAGData(blockHash)
+			if err != nil {
+				skippedCount++
+				continue
+			}
+			rows = append(rows, p.blockGHOSTDAGDataRow(block.ID, ghostdagData))
+		}
+		storedCount = len(rows)
+		return p.database.InsertBlocksGHOSTDAGData(databaseTransaction, rows)
+	})
+	if err != nil {
+		return afterBlockID, 0, err
+	}
+	if storedCount > 0 {
+		log.Infof("Backfilled the GHOSTDAG data of %d blocks", storedCount)
+	}
+	if skippedCount > 0 {
+		log.Warnf("The embedded node does not know %d blocks without GHOSTDAG data yet", skippedCount)
+	}
+	return nextAfterBlockID, storedCount, nil
+}
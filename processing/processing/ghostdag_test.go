@@ -0,0 +1,94 @@
+package processing
+
+import (
+	"math/big"
+	"testing"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/fakenode"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// ghostdagDataSource is a GHOSTDAGDataSource knowing the GHOSTDAG data of a set of blocks
+type ghostdagDataSource map[externalapi.DomainHash]*externalapi.BlockGHOSTDAGData
+
+func (s ghostdagDataSource) BlockGHOSTDAGData(blockHash *externalapi.DomainHash) (*externalapi.BlockGHOSTDAGData, error) {
+	ghostdagData, ok := s[*blockHash]
+	if !ok {
+		return nil, errors.Errorf("block %s not found", blockHash)
+	}
+	return ghostdagData, nil
+}
+
+func (s ghostdagDataSource) add(blockHash *externalapi.DomainHash) {
+	s[*blockHash] = externalapi.NewBlockGHOSTDAGData(0, big.NewInt(0), nil,
+		[]*externalapi.DomainHash{}, []*externalapi.DomainHash{}, map[externalapi.DomainHash]externalapi.KType{})
+}
+
+func TestBackfillGHOSTDAGData(t *testing.T) {
+	node := fakenode.New()
+	genesis := node.Genesis()
+	a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+	b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a}})
+	err := node.SetSelectedTip(b)
+	if err != nil {
+		t.Fatalf("SetSelectedTip: %s", err)
+	}
+	processing := newTestProcessing(t, node)
+
+	// The embedded node does not know any block yet
+	source := ghostdagDataSource{}
+	processing.SetGHOSTDAGDataSource(source)
+	missingCount := func() int {
+		t.Helper()
+
+		count := 0
+		err := processing.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+			blocks, err := processing.database.BlocksWithoutGHOSTDAGData(databaseTransaction, 0, 0, ghostdagBackfillBatchSize)
+			count = len(blocks)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("BlocksWithoutGHOSTDAGData: %s", err)
+		}
+		return count
+	}
+
+	tests := []struct {
+		name         string
+		pruningPoint *externalapi.DomainHash
+		knownBlocks  []*externalapi.DomainHash
+		storedCount  int
+		missingCount int
+	}{
+		{name: "unknown blocks are skipped", pruningPoint: genesis, knownBlocks: nil, storedCount: 0, missingCount: 3},
+		{name: "known blocks are backfilled", pruningPoint: genesis, knownBlocks: []*externalapi.DomainHash{a},
+			storedCount: 1, missingCount: 2},
+		{name: "blocks below the pruning point are left out", pruningPoint: a,
+			knownBlocks: []*externalapi.DomainHash{genesis}, storedCount: 0, missingCount: 2},
+		{name: "skipped blocks are retried", pruningPoint: a, knownBlocks: []*externalapi.DomainHash{b},
+			storedCount: 1, missingCount: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node.SetPruningPoint(test.pruningPoint)
+			for _, hash := range test.knownBlocks {
+				source.add(hash)
+			}
+			afterBlockID, storedCount, err := processing.backfillGHOSTDAGDataBatch(0)
+			if err != nil {
+				t.Fatalf("backfillGHOSTDAGDataBatch: %s", err)
+			}
+			if afterBlockID != 0 {
+				t.Errorf("next batch after block id: got %d, want 0", afterBlockID)
+			}
+			if storedCount != test.storedCount {
+				t.Errorf("backfilled blocks: got %d, want %d", storedCount, test.storedCount)
+			}
+			if count := missingCount(); count != test.missingCount {
+				t.Errorf("blocks without GHOSTDAG data: got %d, want %d", count, test.missingCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package processing
+
+import (
+	"strconv"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// blockHeaderRow returns the header row of `block` identified by `blockID`
+func blockHeaderRow(blockID uint64, block *externalapi.DomainBlock) *model.BlockHeader {
+	header := block.Header
+	parents := make([][]string, len(header.Parents()))
+	for i, level := range header.Parents() {
+		parents[i] = make([]string, len(level))
+		for j, parent := range level {
+			parents[i][j] = parent.String()
+		}
+	}
+	return &model.BlockHeader{
+		BlockID:              blockID,
+		Version:              header.Version(),
+		Parents:              parents,
+		HashMerkleRoot:       header.HashMerkleRoot().String(),
+		AcceptedIDMerkleRoot: header.AcceptedIDMerkleRoot().String(),
+		UTXOCommitment:       header.UTXOCommitment().String(),
+		Bits:                 header.Bits(),
+		Nonce:                strconv.FormatUint(header.Nonce(), 10),
+		PruningPoint:         header.PruningPoint().String(),
+	}
+}
+
+// storeBlockHeaders stores the headers of `blocks`, all already stored in
+// the database
+func (p *Processing) storeBlockHeaders(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock) error {
+	headers := make([]*model.BlockHeader, len(blocks))
+	for i, block := range blocks {
+		blockID, err := p.database.BlockIDByHash(databaseTransaction, block.hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for block %s", block.hash)
+		}
+		headers[i] = blockHeaderRow(blockID, block.block)
+	}
+	err := p.database.InsertBlockHeaders(databaseTransaction, headers)
+	if err != nil {
+		return errors.Wrapf(err, "Could not store the headers of %d blocks", len(headers))
+	}
+	return nil
+}
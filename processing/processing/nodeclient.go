@@ -0,0 +1,31 @@
+package processing
+
+import (
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+)
+
+// NodeClient is the subset of the karlsend RPC client the processing tier
+// depends on. It is satisfied by `*rpcclient.RPCClient`.
+type NodeClient interface {
+	GetBlockDAGInfo() (*appmessage.GetBlockDAGInfoResponseMessage, error)
+	GetBlock(hash string, includeTransactions bool) (*appmessage.GetBlockResponseMessage, error)
+	GetBlocks(lowHash string, includeBlocks bool, includeTransactions bool) (*appmessage.GetBlocksResponseMessage, error)
+	GetSelectedTipHash() (*appmessage.GetSelectedTipHashResponseMessage, error)
+	GetVirtualSelectedParentChainFromBlock(startHash string, includeAcceptedTransactionIDs bool) (
+		*appmessage.GetVirtualSelectedParentChainFromBlockResponseMessage, error)
+	RegisterForVirtualSelectedParentChainChangedNotifications(includeAcceptedTransactionIDs bool,
+		onChainChanged func(notification *appmessage.VirtualSelectedParentChainChangedNotificationMessage)) error
+	RegisterForBlockAddedNotifications(onBlockAdded func(notification *appmessage.BlockAddedNotificationMessage)) error
+	Close() error
+}
+
+// GHOSTDAGDataSource reads the GHOSTDAG data of the blocks from a consensus.
+// It is satisfied by the embedded node `*karlsend.Karlsend`.
+type GHOSTDAGDataSource interface {
+	BlockGHOSTDAGData(blockHash *externalapi.DomainHash) (*externalapi.BlockGHOSTDAGData, error)
+}
+
+// NodeClientDialer opens a new connection to the node. The processing tier
+// uses it for the resync walk of the node blocks and to reconnect.
+type NodeClientDialer func() (NodeClient, error)
@@ -0,0 +1,244 @@
+package prefetch
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// Page is a page of the paged GetBlocks walk: the blocks returned for
+// `LowHash`, the first of them at index `Offset` of the whole walk. `Last`
+// is set on the page reaching the high hash of the walk.
+type Page struct {
+	LowHash string
+	Offset  int
+	Last    bool
+	Hashes  []*externalapi.DomainHash
+
+	rpcBlocks []*appmessage.RPCBlock
+}
+
+// Block is a block fetched and decoded by a Prefetcher
+type Block struct {
+	Hash        *externalapi.DomainHash
+	Block       *externalapi.DomainBlock
+	VerboseData *appmessage.RPCBlockVerboseData
+}
+
+// Result is a page fetched by a Prefetcher, its blocks following the order of
+// the page hashes
+type Result struct {
+	Page   *Page
+	Blocks []*Block
+	Err    error
+}
+
+// Client is the part of the node RPC client used by the walk
+type Client interface {
+	GetBlocks(lowHash string, includeBlocks bool, includeTransactions bool) (*appmessage.GetBlocksResponseMessage, error)
+	Close() error
+}
+
+type job struct {
+	page   *Page
+	result chan *Result
+}
+
+// Prefetcher walks the node blocks from a low hash up to a high hash ahead
+// of their consumer, requesting every page once with its blocks and the next
+// low hash taken from the previous page. The pages are decoded by a bounded
+// pool of workers and delivered in the order of the walk, and at most one
+// page per worker is held ahead of the consumer.
+type Prefetcher struct {
+	client              Client
+	lowHash             string
+	highHash            string
+	includeTransactions bool
+	workers             int
+	jobs                chan *job
+	ordered             chan chan *Result
+	quit                chan struct{}
+	stopOnce            sync.Once
+	waitGroup           sync.WaitGroup
+	fetched             uint64
+}
+
+// New creates a Prefetcher of `workers` workers walking the blocks from
+// `lowHash` to `highHash` with `client`, which it closes once stopped
+func New(client Client, workers int, lowHash string, highHash string, includeTransactions bool) (*Prefetcher, error) {
+	if workers < 1 {
+		_ = client.Close()
+		return nil, errors.Errorf("a prefetcher requires at least one worker, got %d", workers)
+	}
+	return &Prefetcher{
+		client:              client,
+		lowHash:             lowHash,
+		highHash:            highHash,
+		includeTransactions: includeTransactions,
+		workers:             workers,
+		jobs:                make(chan *job),
+		ordered:             make(chan chan *Result, workers),
+		quit:                make(chan struct{}),
+	}, nil
+}
+
+// Start launches the walk and the workers
+func (p *Prefetcher) Start() {
+	p.waitGroup.Add(1 + p.workers)
+	go p.walk()
+	for i := 0; i < p.workers; i++ {
+		go p.work()
+	}
+}
+
+// Next returns the next page in order, blocking until it is fetched.
+// Returns false once all the pages have been delivered or if the
+// Prefetcher was stopped
+func (p *Prefetcher) Next() (*Result, bool) {
+	select {
+	case resultChan, ok := <-p.ordered:
+		if !ok {
+			return nil, false
+		}
+		select {
+		case result := <-resultChan:
+			return result, true
+		case <-p.quit:
+			return nil, false
+		}
+	case <-p.quit:
+		return nil, false
+	}
+}
+
+// Fetched returns the number of blocks fetched so far
+func (p *Prefetcher) Fetched() int {
+	return int(atomic.LoadUint64(&p.fetched))
+}
+
+// Stop stops the walk and the workers and closes the connection to the node.
+// It is safe to call Stop more than once
+func (p *Prefetcher) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+		p.waitGroup.Wait()
+		_ = p.client.Close()
+	})
+}
+
+// walk requests the pages one after the other and hands them out to the
+// workers. Each job result channel is queued in `ordered` before the job
+// itself, so that the consumer receives the results in order while `ordered`
+// capacity bounds how far the walk gets ahead of the consumer. A failed
+// request is delivered as the result of its page and ends the walk.
+func (p *Prefetcher) walk() {
+	defer p.waitGroup.Done()
+	defer close(p.jobs)
+	defer close(p.ordered)
+
+	lowHash := p.lowHash
+	offset := 0
+	for {
+		page, err := p.fetchPage(lowHash, offset)
+		j := &job{
+			page:   page,
+			result: make(chan *Result, 1),
+		}
+		select {
+		case p.ordered <- j.result:
+		case <-p.quit:
+			return
+		}
+		if err != nil {
+			j.result <- &Result{Page: page, Err: err}
+			return
+		}
+		select {
+		case p.jobs <- j:
+		case <-p.quit:
+			return
+		}
+		if page.Last {
+			return
+		}
+		offset += len(page.Hashes)
+		lowHash = page.Hashes[len(page.Hashes)-1].String()
+	}
+}
+
+// fetchPage gets the page of blocks starting at `lowHash`. The response
+// starts with `lowHash` itself, which is left out of every page but the
+// first one since it ends the previous page.
+func (p *Prefetcher) fetchPage(lowHash string, offset int) (*Page, error) {
+	page := &Page{LowHash: lowHash, Offset: offset}
+	getBlocks, err := p.client.GetBlocks(lowHash, true, p.includeTransactions)
+	if err != nil {
+		return page, errors.Wrapf(err, "could not get the blocks from %s", lowHash)
+	}
+	if len(getBlocks.Blocks) != len(getBlocks.BlockHashes) {
+		return page, errors.Errorf("GetBlocks returned %d blocks for %d hashes", len(getBlocks.Blocks), len(getBlocks.BlockHashes))
+	}
+
+	hashStrings := getBlocks.BlockHashes
+	page.rpcBlocks = getBlocks.Blocks
+	if offset > 0 && len(hashStrings) > 0 && hashStrings[0] == lowHash {
+		hashStrings = hashStrings[1:]
+		page.rpcBlocks = page.rpcBlocks[1:]
+	}
+	if len(hashStrings) == 0 {
+		return page, errors.Errorf("GetBlocks returned no block after %s before reaching %s", lowHash, p.highHash)
+	}
+	page.Hashes = make([]*externalapi.DomainHash, len(hashStrings))
+	for i, hashString := range hashStrings {
+		page.Hashes[i], err = externalapi.NewDomainHashFromString(hashString)
+		if err != nil {
+			return page, errors.Wrapf(err, "could not parse block hash %s", hashString)
+		}
+		if hashString == p.highHash {
+			page.Last = true
+		}
+	}
+	return page, nil
+}
+
+func (p *Prefetcher) work() {
+	defer p.waitGroup.Done()
+
+	for {
+		select {
+		case j, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			result := decode(j.page)
+			atomic.AddUint64(&p.fetched, uint64(len(result.Blocks)))
+			j.result <- result
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// decode converts the RPC blocks of `page` to domain blocks
+func decode(page *Page) *Result {
+	result := &Result{Page: page}
+	result.Blocks = make([]*Block, len(page.Hashes))
+	for i, hash := range page.Hashes {
+		rpcBlock := page.rpcBlocks[i]
+		block, err := appmessage.RPCBlockToDomainBlock(rpcBlock)
+		if err != nil {
+			result.Err = errors.Wrapf(err, "could not decode block %s", hash)
+			return result
+		}
+		result.Blocks[i] = &Block{
+			Hash:        hash,
+			Block:       block,
+			VerboseData: rpcBlock.VerboseData,
+		}
+	}
+	page.rpcBlocks = nil
+	return result
+}
@@ -1,21 +1,24 @@
 package processing
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/karlsen-network/karlsend/v2/app/appmessage"
-	"github.com/karlsen-network/karlsend/v2/infrastructure/network/rpcclient"
-	"github.com/go-pg/pg/v10"
 	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
 	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
 	configPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/config"
 	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/logging"
 	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/tools"
 	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/batch"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/eventqueue"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/prefetch"
 	versionPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/version"
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
 	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
 	"github.com/karlsen-network/karlsend/v2/domain/consensus/utils/consensushashing"
+	"github.com/karlsen-network/karlsend/v2/util/txmass"
 	"github.com/karlsen-network/karlsend/v2/version"
 	"github.com/pkg/errors"
 )
@@ -23,16 +26,37 @@ import (
 var log = logging.Logger()
 
 type Processing struct {
-	config    *configPackage.Config
-	database  *databasePackage.Database
-	rpcClient *rpcclient.RPCClient
-	appConfig *model.AppConfig
+	config         *configPackage.Config
+	database       databasePackage.Storage
+	rpcClient      NodeClient
+	dialNodeClient NodeClientDialer
+	appConfig      *model.AppConfig
+
+	// rpcClientLock guards the replacement of rpcClient, along with the lock of
+	// Processing, so that Stop can close it while processing is in progress
+	rpcClientLock sync.Mutex
+
+	// chainChangedCount counts the received chain changed notifications
+	chainChangedCount uint64
+	recoveryRequests  chan struct{}
+	eventQueue        *eventqueue.Queue
+	txMassCalculator  *txmass.Calculator
+
+	// ghostdagDataSource is the embedded consensus, nil without embedded node
+	ghostdagDataSource GHOSTDAGDataSource
+	// ghostdagBackfillRequests wakes up the GHOSTDAG data backfill when
+	// blocks are skipped
+	ghostdagBackfillRequests chan struct{}
+
+	isStopping       uint32
+	stopBackground   context.CancelFunc
+	backgroundWaiter sync.WaitGroup
 
 	sync.Mutex
 }
 
-func NewProcessing(config *configPackage.Config,
-	database *databasePackage.Database, rpcClient *rpcclient.RPCClient) (*Processing, error) {
+func NewProcessing(config *configPackage.Config, database databasePackage.Storage,
+	rpcClient NodeClient, dialNodeClient NodeClientDialer) (*Processing, error) {
 
 	appConfig := &model.AppConfig{
 		ID:                true,
@@ -42,74 +66,161 @@ func NewProcessing(config *configPackage.Config,
 	}
 
 	processing := &Processing{
-		config:    config,
-		database:  database,
-		rpcClient: rpcClient,
-		appConfig: appConfig,
+		config:           config,
+		database:         database,
+		rpcClient:        rpcClient,
+		dialNodeClient:   dialNodeClient,
+		appConfig:        appConfig,
+		recoveryRequests: make(chan struct{}, 1),
+		eventQueue:       eventqueue.New(config.EventQueueSize),
+
+		ghostdagBackfillRequests: make(chan struct{}, 1),
+		txMassCalculator: txmass.NewCalculator(config.NetParams().MassPerTxByte,
+			config.NetParams().MassPerScriptPubKeyByte, config.NetParams().MassPerSigOp),
 	}
+	return processing, nil
+}
 
-	err := processing.RegisterAppConfig()
+// Start resyncs the database and starts processing the node notifications.
+// Cancelling `ctx` interrupts the resync after its last committed chunk and
+// stops the connection supervision.
+func (p *Processing) Start(ctx context.Context) error {
+	err := p.RegisterAppConfig()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = processing.ResyncDatabase()
+	err = p.ResyncDatabase(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Start listening to events only after resyncing is done, otherwise we get overwhelmed
-	err = processing.initConsensusEventsHandler()
+	err = p.initConsensusEventsHandler()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return processing, nil
+	backgroundContext, stopBackground := context.WithCancel(ctx)
+	p.stopBackground = stopBackground
+	p.backgroundWaiter.Add(2)
+	go func() {
+		defer p.backgroundWaiter.Done()
+		p.consumeEvents(backgroundContext)
+	}()
+	go func() {
+		defer p.backgroundWaiter.Done()
+		p.superviseConnection(backgroundContext)
+	}()
+	if p.ghostdagDataSource != nil {
+		p.backgroundWaiter.Add(1)
+		go func() {
+			defer p.backgroundWaiter.Done()
+			p.backfillGHOSTDAGData(backgroundContext)
+		}()
+	}
+	if p.config.RetentionPolicy != configPackage.RetentionPolicyAll {
+		log.Infof("Retention policy: %s", p.config.RetentionPolicy)
+		p.backgroundWaiter.Add(1)
+		go func() {
+			defer p.backgroundWaiter.Done()
+			p.enforceRetention(backgroundContext)
+		}()
+	}
+	return nil
+}
+
+// Stop stops processing the node notifications and closes the RPC client,
+// which drops the notification handlers and unblocks the requests in flight.
+// It then waits for the events transaction in flight to finish and closes the
+// database. Events still queued are dropped. When `ctx` is done first, the
+// transaction in flight is interrupted, the database is closed once it is
+// rolled back, and the error of `ctx` is returned without waiting.
+func (p *Processing) Stop(ctx context.Context) error {
+	log.Infof("Stopping processing")
+
+	// Notifications received from now on are ignored
+	atomic.StoreUint32(&p.isStopping, 1)
+	if p.stopBackground != nil {
+		p.stopBackground()
+	}
+
+	p.rpcClientLock.Lock()
+	err := p.rpcClient.Close()
+	p.rpcClientLock.Unlock()
+	if err != nil {
+		log.Warnf("Could not close RPC client: %s", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		p.backgroundWaiter.Wait()
+		// Wait for the work in flight holding the lock, such as a resync
+		p.Lock()
+		p.Unlock()
+		p.database.Close()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		// Closing the database waits for the transaction in flight
+		p.database.Interrupt()
+		return errors.Wrapf(ctx.Err(), "processing did not finish in time")
+	}
+}
+
+func (p *Processing) stopping() bool {
+	return atomic.LoadUint32(&p.isStopping) == 1
 }
 
 func (p *Processing) initConsensusEventsHandler() error {
-	err := p.rpcClient.RegisterForVirtualSelectedParentChainChangedNotifications(false, func(notification *appmessage.VirtualSelectedParentChainChangedNotificationMessage) {
+	err := p.rpcClient.RegisterForVirtualSelectedParentChainChangedNotifications(p.includeTransactions(), func(notification *appmessage.VirtualSelectedParentChainChangedNotificationMessage) {
+		receivedAt := time.Now()
+		if p.stopping() {
+			return
+		}
+		atomic.AddUint64(&p.chainChangedCount, 1)
+
 		added, err := hashesFromStrings(notification.AddedChainBlockHashes)
 		if err != nil {
 			panic(err)
 		}
 
-		removed, err := hashesFromStrings(notification.AddedChainBlockHashes)
+		removed, err := hashesFromStrings(notification.RemovedChainBlockHashes)
 		if err != nil {
 			panic(err)
 		}
 
-		event := &externalapi.VirtualChangeSet{
-			VirtualSelectedParentChainChanges: &externalapi.SelectedChainPath{
+		p.enqueueEvent(&eventqueue.Event{
+			ChainChanges: &externalapi.SelectedChainPath{
 				Added:   added,
 				Removed: removed,
 			},
-			VirtualUTXODiff:                nil,
-			VirtualParents:                 nil,
-			VirtualSelectedParentBlueScore: 0,
-			VirtualDAAScore:                0,
-		}
-
-		err = p.ProcessVirtualChange(event)
-		if err != nil {
-			logging.LogErrorAndExit("Failed to process virtual change consensus event: %s", err)
-		}
+			AcceptedTransactionIDs: notification.AcceptedTransactionIDs,
+			ReceivedAt:             receivedAt,
+		})
 	})
 	if err != nil {
 		return err
 	}
 
 	err = p.rpcClient.RegisterForBlockAddedNotifications(func(notification *appmessage.BlockAddedNotificationMessage) {
+		receivedAt := time.Now()
+		if p.stopping() {
+			return
+		}
 		block, err := appmessage.RPCBlockToDomainBlock(notification.Block)
 		if err != nil {
 			panic(err)
 		}
 
 		log.Debugf("Consensus event handler gets block %s", consensushashing.BlockHash(block))
-		err = p.ProcessBlock(block)
-		if err != nil {
-			logging.LogErrorAndExit("Failed to process block added consensus event: %s", err)
-		}
+		p.enqueueEvent(&eventqueue.Event{
+			Block:      block,
+			ReceivedAt: receivedAt,
+		})
 	})
 	if err != nil {
 		return err
@@ -119,7 +230,7 @@ func (p *Processing) initConsensusEventsHandler() error {
 }
 
 func (p *Processing) RegisterAppConfig() error {
-	return p.database.RunInTransaction(func(databaseTransaction *pg.Tx) error {
+	return p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
 		log.Infof("Registering app config")
 		defer log.Infof("Finished registering app config")
 
@@ -127,35 +238,41 @@ func (p *Processing) RegisterAppConfig() error {
 	})
 }
 
-func (p *Processing) ResyncDatabase() error {
+func (p *Processing) ResyncDatabase(ctx context.Context) error {
 	p.Lock()
 	defer p.Unlock()
 
-	return p.database.RunInTransaction(func(databaseTransaction *pg.Tx) error {
-		log.Infof("Resyncing database")
-		defer log.Infof("Finished resyncing database")
+	log.Infof("Resyncing database")
+	defer log.Infof("Finished resyncing database")
 
-		dagInfo, err := p.rpcClient.GetBlockDAGInfo()
-		if err != nil {
-			return err
-		}
+	dagInfo, err := p.rpcClient.GetBlockDAGInfo()
+	if err != nil {
+		return err
+	}
 
-		pruningPointHash, err := externalapi.NewDomainHashFromString(dagInfo.PruningPointHash)
-		if err != nil {
-			return err
-		}
+	pruningPointHash, err := externalapi.NewDomainHashFromString(dagInfo.PruningPointHash)
+	if err != nil {
+		return err
+	}
 
-		rpcPruning, err := p.rpcClient.GetBlock(dagInfo.PruningPointHash, false)
-		if err != nil {
-			return err
-		}
+	rpcPruning, err := p.rpcClient.GetBlock(dagInfo.PruningPointHash, p.includeTransactions())
+	if err != nil {
+		return err
+	}
+	pruningPointBlock, err := appmessage.RPCBlockToDomainBlock(rpcPruning.Block)
+	if err != nil {
+		return err
+	}
 
+	var keepDatabase bool
+	var checkpoint *model.ResyncCheckpoint
+	err = p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
 		hasPruningBlock, err := p.database.DoesBlockExist(databaseTransaction, pruningPointHash)
 		if err != nil {
 			return err
 		}
 
-		keepDatabase := hasPruningBlock && !p.config.ClearDB
+		keepDatabase = hasPruningBlock && !p.config.ClearDB
 		if keepDatabase {
 			// The prunning block is already in the database
 			// so we keep the database as it is and sync the new blocks
@@ -168,176 +285,570 @@ func (p *Processing) ResyncDatabase() error {
 			}
 
 			log.Infof("Loading cache")
-			p.database.LoadCache(databaseTransaction, pruningBlockHeight)
+			err = p.database.LoadCache(databaseTransaction, pruningBlockHeight)
+			if err != nil {
+				return err
+			}
 			log.Infof("Cache loaded from the database")
-		} else {
-			// The prunning block was not found in the database
-			// so we start from scratch.
-			err = p.database.Clear(databaseTransaction)
+
+			checkpoint, err = p.database.GetResyncCheckpoint(databaseTransaction)
+			return err
+		}
+
+		// The prunning block was not found in the database
+		// so we start from scratch.
+		err = p.database.Clear(databaseTransaction)
+		if err != nil {
+			return err
+		}
+		log.Infof("Database cleared")
+
+		// The pruning point is the root of the stored DAG: its parents are
+		// left out and it starts the virtual selected parent chain
+		pruningPointBulkBlock := &databasePackage.BulkBlock{
+			Hash:         pruningPointHash,
+			Timestamp:    rpcPruning.Block.Header.Timestamp,
+			BlueScore:    pruningPointBlock.Header.BlueScore(),
+			BlueWork:     pruningPointBlock.Header.BlueWork().String(),
+			IsHeaderOnly: true,
+		}
+		err = p.database.InsertBlocks(databaseTransaction, []*databasePackage.BulkBlock{pruningPointBulkBlock})
+		if err != nil {
+			return err
+		}
+		pruningPointID, err := p.database.BlockIDByHash(databaseTransaction, pruningPointHash)
+		if err != nil {
+			return err
+		}
+		err = p.database.UpdateBlockIsInVirtualSelectedParentChain(databaseTransaction, map[uint64]bool{pruningPointID: true})
+		if err != nil {
+			return err
+		}
+		pruningPointNodeBlocks := []*nodeBlock{{hash: pruningPointHash, block: pruningPointBlock}}
+		err = p.storeBlockHeaders(databaseTransaction, pruningPointNodeBlocks)
+		if err != nil {
+			return err
+		}
+		err = p.updateTips(databaseTransaction, pruningPointNodeBlocks)
+		if err != nil {
+			return err
+		}
+		err = p.storeBlocksGHOSTDAGData(databaseTransaction, pruningPointNodeBlocks)
+		if err != nil {
+			return err
+		}
+		err = p.storeDifficultySamples(databaseTransaction, pruningPointNodeBlocks)
+		if err != nil {
+			return err
+		}
+		err = p.storeBlockTransactions(databaseTransaction, pruningPointNodeBlocks)
+		if err != nil {
+			return err
+		}
+		log.Infof("Pruning point %s has been added to the database", pruningPointHash)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Load node blocks")
+	selectedTipHash, err := p.rpcClient.GetSelectedTipHash()
+	if err != nil {
+		return err
+	}
+
+	scoreUpdates := &resyncScoreUpdates{}
+	if keepDatabase {
+		err = p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+			// Special case occuring when launching a version of KGI supporting DAA scores on a
+			// database freshly migrated and introducing DAA scores.
+			pruningPointID, err := p.database.BlockIDByHash(databaseTransaction, pruningPointHash)
 			if err != nil {
 				return err
 			}
-			log.Infof("Database cleared")
-
-			pruningPointDatabaseBlock := &model.Block{
-				BlockHash:                      pruningPointHash.String(),
-				Timestamp:                      rpcPruning.Block.Header.Timestamp,
-				ParentIDs:                      []uint64{},
-				Height:                         0,
-				HeightGroupIndex:               0,
-				SelectedParentID:               nil,
-				Color:                          model.ColorGray,
-				IsInVirtualSelectedParentChain: true,
-				MergeSetRedIDs:                 []uint64{},
-				MergeSetBlueIDs:                []uint64{},
-			}
-			err = p.database.InsertBlock(databaseTransaction, pruningPointHash, pruningPointDatabaseBlock)
+			pruningPointDatabaseBlock, err := p.database.GetBlock(databaseTransaction, pruningPointID)
 			if err != nil {
 				return err
 			}
-			heightGroup := &model.HeightGroup{
-				Height: 0,
-				Size:   1,
+			noDAAScoreCount, err := p.database.BlockCountAtDAAScore(databaseTransaction, 0)
+			if err != nil {
+				return err
+			}
+			if pruningPointDatabaseBlock.DAAScore == 0 && noDAAScoreCount > uint32(p.config.NetParams().K) {
+				log.Infof("Updating DAA score of the blocks in the database")
+				scoreUpdates.daaScores = true
 			}
-			err = p.database.InsertOrUpdateHeightGroup(databaseTransaction, heightGroup)
+			// End of special case
+
+			// Same special case for the blue scores and blue works
+			noBlueWorkCount, err := p.database.BlockCountWithoutBlueWork(databaseTransaction)
 			if err != nil {
 				return err
 			}
-			log.Infof("Pruning point %s has been added to the database", pruningPointHash)
+			if pruningPointDatabaseBlock.BlueWork == "0" && noBlueWorkCount > uint32(p.config.NetParams().K) {
+				log.Infof("Updating blue score and blue work of the blocks in the database")
+				scoreUpdates.blueScoresAndWorks = true
+			}
+			// End of special case
+			return nil
+		})
+		if err != nil {
+			return err
 		}
+		log.Infof("Syncing the node blocks with the database")
+	} else {
+		log.Infof("Adding the node blocks to the database")
+	}
+
+	lastHash, blockCount, err := p.resyncBlocks(ctx, pruningPointHash, pruningPointBlock, selectedTipHash.SelectedTipHash,
+		dagInfo.VirtualDAAScore, checkpoint, keepDatabase, scoreUpdates)
+	if err != nil {
+		return err
+	}
+	log.Infof("Node blocks loaded")
 
-		log.Infof("Load node blocks")
-		selectedTipHash, err := p.rpcClient.GetSelectedTipHash()
+	return p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		err := p.resyncVirtualSelectedParentChain(databaseTransaction, false)
 		if err != nil {
 			return err
 		}
+		return p.storeResyncCheckpoint(databaseTransaction, pruningPointHash, lastHash, blockCount, model.ResyncPhaseDone)
+	})
+}
 
-		lowHash := dagInfo.PruningPointHash
-		hashesBetweenPruningPointAndHeadersSelectedTip := make([]*externalapi.DomainHash, 0)
-		count := 0
-	outer:
-		for i := 0; ; i++ {
-			log.Debugf("Requesting GetBlocks with lowHash %s", lowHash)
-			getBlocks, err := p.rpcClient.GetBlocks(lowHash, false, false)
-			if err != nil {
-				return err
+// resyncStartMargin is the number of blocks (~ 10 minutes) synced again before
+// the latest stored block, to make sure no mutation was missed
+const resyncStartMargin = 600
+
+// resyncStartIndex returns the index in the walk of the node blocks of the
+// first block to sync with the database, if it can be told from `page`.
+// An interrupted resync from the same pruning point continues right after its
+// last committed block. Otherwise the index is derived from the blocks already
+// stored in the database: the walk follows the order the blocks are stored
+// in, so the latest stored block is in the first page ending with a block
+// missing from the database.
+func (p *Processing) resyncStartIndex(databaseTransaction databasePackage.Transaction, checkpoint *model.ResyncCheckpoint,
+	pruningPointHash *externalapi.DomainHash, page *prefetch.Page) (int, bool, error) {
+
+	isResumable := checkpoint != nil && checkpoint.Phase != model.ResyncPhaseDone &&
+		checkpoint.PruningPointHash == pruningPointHash.String()
+	if isResumable {
+		if checkpoint.LastCommittedHash == "" {
+			return 0, true, nil
+		}
+		for i, blockHash := range page.Hashes {
+			if blockHash.String() == checkpoint.LastCommittedHash {
+				log.Infof("Resuming interrupted resync after block %s (%d blocks already committed)",
+					checkpoint.LastCommittedHash, page.Offset+i+1)
+				return page.Offset + i + 1, true, nil
 			}
-			count += len(getBlocks.BlockHashes)
-			if i%1000 == 0 {
-				rpcBlock, err := p.rpcClient.GetBlock(getBlocks.BlockHashes[0], false)
-				if err != nil {
-					return err
-				}
+		}
+	}
 
-				log.Infof("Time %s", time.Unix(rpcBlock.Block.Header.Timestamp/1000, 0))
+	hasLastBlock, err := p.database.DoesBlockExist(databaseTransaction, page.Hashes[len(page.Hashes)-1])
+	if err != nil {
+		return 0, false, err
+	}
+	if hasLastBlock && !page.Last {
+		return 0, false, nil
+	}
+	if isResumable {
+		log.Warnf("Last committed block %s of the interrupted resync not found in the node blocks", checkpoint.LastCommittedHash)
+	}
 
-				if dagInfo.VirtualDAAScore-rpcPruning.Block.Header.DAAScore != 0 {
-					log.Infof("Progress %d%%", (100*(rpcBlock.Block.Header.DAAScore-rpcPruning.Block.Header.DAAScore))/(dagInfo.VirtualDAAScore-rpcPruning.Block.Header.DAAScore))
-				}
-			}
+	pageIndex, err := p.database.FindLatestStoredBlockIndex(databaseTransaction, page.Hashes)
+	if err != nil {
+		return 0, false, err
+	}
+	startIndex := page.Offset + pageIndex
+	log.Infof("First %d blocks already exist in the database", startIndex)
+	return tools.Max(startIndex-resyncStartMargin, 0), true, nil
+}
 
-			hashes, err := hashesFromStrings(getBlocks.BlockHashes)
-			if err != nil {
-				return err
-			}
+// resyncScoreUpdates tells which scores of the blocks already stored are
+// missing from a database migrated from an earlier version, and have to be
+// updated from the node blocks while resyncing
+type resyncScoreUpdates struct {
+	daaScores          bool
+	blueScoresAndWorks bool
+}
 
-			hashesBetweenPruningPointAndHeadersSelectedTip = append(hashesBetweenPruningPointAndHeadersSelectedTip, hashes...)
-			for _, hash := range getBlocks.BlockHashes {
-				if hash == selectedTipHash.SelectedTipHash {
-					break outer
-				}
-			}
+func (u *resyncScoreUpdates) isNeeded() bool {
+	return u.daaScores || u.blueScoresAndWorks
+}
 
-			lowHash = getBlocks.BlockHashes[len(getBlocks.BlockHashes)-1]
+// resyncBlocks adds the node blocks from the pruning point up to
+// `selectedTipHash` to the database, and returns the last of them along with
+// their count. The blocks are walked once by a prefetcher and streamed into
+// chunks of the configured size, each chunk committed with a checkpoint so
+// that an interrupted resync can be resumed. The walked blocks preceding the
+// first block to sync are skipped, unless the stored scores are updated.
+func (p *Processing) resyncBlocks(ctx context.Context, pruningPointHash *externalapi.DomainHash, pruningPointBlock *externalapi.DomainBlock,
+	selectedTipHash string, virtualDAAScore uint64, checkpoint *model.ResyncCheckpoint, keepDatabase bool,
+	scoreUpdates *resyncScoreUpdates) (*externalapi.DomainHash, int, error) {
+
+	client, err := p.dialNodeClient()
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "could not connect the resync walk")
+	}
+	prefetcher, err := prefetch.New(client, p.config.ResyncWorkers, pruningPointHash.String(), selectedTipHash, p.includeTransactions())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer prefetcher.Stop()
+	prefetcher.Start()
+	log.Infof("Walking the node blocks with %d decoding workers", p.config.ResyncWorkers)
+
+	startIndex := 0
+	hasStartIndex := !keepDatabase || p.config.Resync
+	// The walked blocks are kept until the start index is known, since it
+	// may precede the page it is found in
+	skipped := make([]*nodeBlock, 0)
+	blockCount := 0
+	isLastPage := false
+	addedCount := 0
+	startTime := time.Now()
+	chunk := make([]*nodeBlock, 0, p.config.ResyncChunkSize)
+	chunkEnd := startIndex
+	scoreBlocks := make([]*nodeBlock, 0)
+	commit := func() error {
+		if ctx.Err() != nil {
+			log.Infof("Resync interrupted after %d blocks", addedCount)
+			return ctx.Err()
 		}
-		log.Infof("Node blocks loaded")
-
-		startIndex := int(0)
-		if keepDatabase {
-			// Special case occuring when launching a version of KGI supporting DAA scores on a
-			// database freshly migrated and introducing DAA scores.
-			pruningPointID, err := p.database.BlockIDByHash(databaseTransaction, pruningPointHash)
+		err := p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+			err := p.updateStoredScores(databaseTransaction, scoreBlocks, scoreUpdates)
 			if err != nil {
 				return err
 			}
-			pruningPointDatabaseBlock, err := p.database.GetBlock(databaseTransaction, pruningPointID)
+			if len(chunk) == 0 {
+				return nil
+			}
+			err = p.bulkProcessBlocks(databaseTransaction, chunk, pruningPointBlock)
 			if err != nil {
 				return err
 			}
-			noDAAScoreCount, err := p.database.BlockCountAtDAAScore(databaseTransaction, 0)
-			if err != nil {
+
+			phase := model.ResyncPhaseBlocks
+			if isLastPage && chunkEnd == blockCount {
+				phase = model.ResyncPhaseChain
+			}
+			return p.storeResyncCheckpoint(databaseTransaction, pruningPointHash, chunk[len(chunk)-1].hash, chunkEnd, phase)
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(chunk) > 0 {
+			addedCount = chunkEnd - startIndex
+			header := chunk[len(chunk)-1].block.Header
+			log.Infof("Added %d blocks to the database, up to %s (%d%% of the DAG, %d fetched, %.0f blocks/s)", addedCount,
+				time.UnixMilli(header.TimeInMilliseconds()), resyncProgress(pruningPointBlock, header.DAAScore(), virtualDAAScore),
+				prefetcher.Fetched(), float64(addedCount)/time.Since(startTime).Seconds())
+		}
+		chunk = chunk[:0]
+		scoreBlocks = scoreBlocks[:0]
+		return nil
+	}
+	addToChunk := func(block *nodeBlock, index int) error {
+		chunk = append(chunk, block)
+		chunkEnd = index + 1
+		if len(chunk) == p.config.ResyncChunkSize {
+			return commit()
+		}
+		return nil
+	}
+
+	var lastHash *externalapi.DomainHash
+	for {
+		result, ok := prefetcher.Next()
+		if !ok {
+			break
+		}
+		if result.Err != nil {
+			return nil, 0, result.Err
+		}
+		page := result.Page
+		blockCount = page.Offset + len(page.Hashes)
+		lastHash = page.Hashes[len(page.Hashes)-1]
+		isLastPage = page.Last
+
+		if !hasStartIndex {
+			err = p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+				var err error
+				startIndex, hasStartIndex, err = p.resyncStartIndex(databaseTransaction, checkpoint, pruningPointHash, page)
 				return err
+			})
+			if err != nil {
+				return nil, 0, err
 			}
-			if pruningPointDatabaseBlock.DAAScore == 0 && noDAAScoreCount > uint32(p.config.NetParams().K) {
-				log.Infof("Updating DAA score of %d blocks in the database", len(hashesBetweenPruningPointAndHeadersSelectedTip))
-				blockIDsToDAAScores, err := p.getBlocksDAAScores(databaseTransaction, hashesBetweenPruningPointAndHeadersSelectedTip)
-				log.Infof("DAA scores of %d blocks collected", len(blockIDsToDAAScores))
-				if err != nil {
-					return err
+			if hasStartIndex {
+				skippedOffset := page.Offset - len(skipped)
+				for i, block := range skipped {
+					if skippedOffset+i < startIndex {
+						continue
+					}
+					err = addToChunk(block, skippedOffset+i)
+					if err != nil {
+						return nil, 0, err
+					}
 				}
-				err = p.database.UpdateBlockDAAScores(databaseTransaction, blockIDsToDAAScores)
-				if err != nil {
-					return err
-				}
-				log.Infof("DAA scores of %d blocks stored in the database", len(blockIDsToDAAScores))
+				skipped = nil
 			}
-			// End of special case
+		}
 
-			log.Infof("Syncing %d blocks with the database", len(hashesBetweenPruningPointAndHeadersSelectedTip))
-			if !p.config.Resync {
-				startIndex, err = p.database.FindLatestStoredBlockIndex(databaseTransaction, hashesBetweenPruningPointAndHeadersSelectedTip)
+		for i, fetchedBlock := range result.Blocks {
+			index := page.Offset + i
+			block := &nodeBlock{
+				hash:        fetchedBlock.Hash,
+				block:       fetchedBlock.Block,
+				verboseData: fetchedBlock.VerboseData,
+			}
+			if scoreUpdates.isNeeded() {
+				scoreBlocks = append(scoreBlocks, block)
+				if len(scoreBlocks) == p.config.ResyncChunkSize {
+					err = commit()
+					if err != nil {
+						return nil, 0, err
+					}
+				}
+			}
+			if !hasStartIndex {
+				skipped = append(skipped, block)
+				continue
+			}
+			if index >= startIndex {
+				err = addToChunk(block, index)
 				if err != nil {
-					return err
+					return nil, 0, err
 				}
-				log.Infof("First %d blocks already exist in the database", startIndex)
-				// We start from an earlier point (~ 10 minutes) to make sure we didn't miss any mutation
-				startIndex = tools.Max(startIndex-600, 0)
 			}
-		} else {
-			log.Infof("Adding %d blocks to the database", len(hashesBetweenPruningPointAndHeadersSelectedTip))
 		}
+		if len(skipped) > resyncStartMargin {
+			skipped = skipped[len(skipped)-resyncStartMargin:]
+		}
+		if ctx.Err() != nil {
+			log.Infof("Resync interrupted after %d blocks", addedCount)
+			return nil, 0, ctx.Err()
+		}
+	}
+	if len(chunk) > 0 || len(scoreBlocks) > 0 {
+		err = commit()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return lastHash, blockCount, nil
+}
+
+// resyncProgress returns the percentage of the DAG above the pruning point
+// resynced up to the block of DAA score `daaScore`
+func resyncProgress(pruningPointBlock *externalapi.DomainBlock, daaScore uint64, virtualDAAScore uint64) uint64 {
+	pruningPointDAAScore := pruningPointBlock.Header.DAAScore()
+	if virtualDAAScore <= pruningPointDAAScore || daaScore < pruningPointDAAScore {
+		return 0
+	}
+	return 100 * (daaScore - pruningPointDAAScore) / (virtualDAAScore - pruningPointDAAScore)
+}
+
+// updateStoredScores updates the scores of `scoreUpdates` of the stored
+// blocks of `blocks`
+func (p *Processing) updateStoredScores(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock,
+	scoreUpdates *resyncScoreUpdates) error {
+
+	if scoreUpdates.daaScores {
+		blockIDsToDAAScores, err := p.getBlocksDAAScores(databaseTransaction, blocks)
+		if err != nil {
+			return err
+		}
+		err = p.database.UpdateBlockDAAScores(databaseTransaction, blockIDsToDAAScores)
+		if err != nil {
+			return err
+		}
+		log.Debugf("DAA scores of %d blocks stored in the database", len(blockIDsToDAAScores))
+	}
+	if scoreUpdates.blueScoresAndWorks {
+		blockIDsToBlueScoresAndWorks := p.getBlocksBlueScoresAndWorks(databaseTransaction, blocks)
+		err := p.database.UpdateBlockBlueScoresAndWorks(databaseTransaction, blockIDsToBlueScoresAndWorks)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Blue scores and blue works of %d blocks stored in the database", len(blockIDsToBlueScoresAndWorks))
+	}
+	return nil
+}
 
-		totalToAdd := len(hashesBetweenPruningPointAndHeadersSelectedTip) - startIndex
-		pruningPointBlock, err := appmessage.RPCBlockToDomainBlock(rpcPruning.Block)
+// bulkProcessBlocks adds the DAG ordered blocks of `results` with the bulk
+// loader. A block having a parent neither stored nor part of the run is
+// processed on its own, with its missing dependencies.
+func (p *Processing) bulkProcessBlocks(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock,
+	pruningBlock *externalapi.DomainBlock) error {
+
+	run := make([]*databasePackage.BulkBlock, 0, len(blocks))
+	runBlocks := make([]*nodeBlock, 0, len(blocks))
+	inRun := make(map[externalapi.DomainHash]bool)
+	flush := func() error {
+		if len(run) == 0 {
+			return nil
+		}
+		err := p.database.InsertBlocks(databaseTransaction, run)
+		if err != nil {
+			return err
+		}
+		err = p.storeBlockHeaders(databaseTransaction, runBlocks)
+		if err != nil {
+			return err
+		}
+		err = p.updateTips(databaseTransaction, runBlocks)
+		if err != nil {
+			return err
+		}
+		err = p.storeBlocksGHOSTDAGData(databaseTransaction, runBlocks)
 		if err != nil {
 			return err
 		}
+		err = p.storeDifficultySamples(databaseTransaction, runBlocks)
+		if err != nil {
+			return err
+		}
+		err = p.storeBlockTransactions(databaseTransaction, runBlocks)
+		if err != nil {
+			return err
+		}
+		run = run[:0]
+		runBlocks = runBlocks[:0]
+		inRun = make(map[externalapi.DomainHash]bool)
+		return nil
+	}
 
-		for i := startIndex; i < len(hashesBetweenPruningPointAndHeadersSelectedTip); i++ {
-			blockHash := hashesBetweenPruningPointAndHeadersSelectedTip[i]
-			rpcBlock, err := p.rpcClient.GetBlock(blockHash.String(), false)
+	for _, block := range blocks {
+		if pruningBlock != nil && block.block.Header.DAAScore() < pruningBlock.Header.DAAScore() {
+			continue
+		}
+		hasMissingParent := false
+		for _, parentHash := range block.block.Header.DirectParents() {
+			if inRun[*parentHash] {
+				continue
+			}
+			parentExists, err := p.database.DoesBlockExist(databaseTransaction, parentHash)
 			if err != nil {
-				return err
+				return errors.Wrapf(err, "Could not check if parent %s for block %s does exist in database", parentHash, block.hash)
 			}
-			block, err := appmessage.RPCBlockToDomainBlock(rpcBlock.Block)
+			if !parentExists {
+				hasMissingParent = true
+				break
+			}
+		}
+		if hasMissingParent {
+			err := flush()
 			if err != nil {
 				return err
 			}
-			err = p.processBlockAndDependencies(databaseTransaction, blockHash, block, pruningPointBlock)
+			err = p.processBlockAndDependencies(databaseTransaction, block.hash, block.block, block.verboseData, pruningBlock, nil)
 			if err != nil {
 				return err
 			}
+			continue
+		}
 
-			addedCount := i + 1 - startIndex
-			if addedCount%1000 == 0 || addedCount == totalToAdd {
-				log.Infof("Added %d/%d blocks to the database", addedCount, totalToAdd)
-			}
+		bulkBlock, err := newBulkBlock(block.hash, block.block, block.verboseData)
+		if err != nil {
+			return err
 		}
+		run = append(run, bulkBlock)
+		runBlocks = append(runBlocks, block)
+		inRun[*block.hash] = true
+	}
+	return flush()
+}
 
-		return p.resyncVirtualSelectedParentChain(databaseTransaction, false)
-	})
+func newBulkBlock(hash *externalapi.DomainHash, block *externalapi.DomainBlock,
+	verboseData *appmessage.RPCBlockVerboseData) (*databasePackage.BulkBlock, error) {
+
+	bulkBlock := &databasePackage.BulkBlock{
+		Hash:         hash,
+		ParentHashes: block.Header.DirectParents(),
+		Timestamp:    block.Header.TimeInMilliseconds(),
+		DAAScore:     block.Header.DAAScore(),
+		BlueScore:    block.Header.BlueScore(),
+		BlueWork:     block.Header.BlueWork().String(),
+		IsHeaderOnly: verboseData.IsHeaderOnly,
+	}
+	if bulkBlock.IsHeaderOnly {
+		return bulkBlock, nil
+	}
+	var err error
+	bulkBlock.SelectedParentHash, err = externalapi.NewDomainHashFromString(verboseData.SelectedParentHash)
+	if err != nil {
+		return nil, err
+	}
+	bulkBlock.MergeSetRedHashes, err = hashesFromStrings(verboseData.MergeSetRedsHashes)
+	if err != nil {
+		return nil, err
+	}
+	bulkBlock.MergeSetBlueHashes, err = hashesFromStrings(verboseData.MergeSetBluesHashes)
+	if err != nil {
+		return nil, err
+	}
+	return bulkBlock, nil
+}
+
+// storeResyncCheckpoint records that the first `committedCount` resync blocks
+// are committed to the database, `lastCommittedHash` being the last of them
+func (p *Processing) storeResyncCheckpoint(databaseTransaction databasePackage.Transaction, pruningPointHash *externalapi.DomainHash,
+	lastCommittedHash *externalapi.DomainHash, committedCount int, phase string) error {
+
+	checkpoint := &model.ResyncCheckpoint{
+		PruningPointHash:   pruningPointHash.String(),
+		LastCommittedIndex: int64(committedCount - 1),
+		LastCommittedHash:  "",
+		Phase:              phase,
+	}
+	if lastCommittedHash != nil {
+		checkpoint.LastCommittedHash = lastCommittedHash.String()
+	}
+	return p.database.StoreResyncCheckpoint(databaseTransaction, checkpoint)
+}
+
+// nodeBlock is a block fetched from the node along with its verbose data
+type nodeBlock struct {
+	hash        *externalapi.DomainHash
+	block       *externalapi.DomainBlock
+	verboseData *appmessage.RPCBlockVerboseData
+}
+
+// nodeBlocksFromRPCBlocks decodes the blocks returned by GetBlocks
+func nodeBlocksFromRPCBlocks(blockHashes []string, rpcBlocks []*appmessage.RPCBlock) ([]*nodeBlock, error) {
+	blocks := make([]*nodeBlock, len(rpcBlocks))
+	for i, rpcBlock := range rpcBlocks {
+		hash, err := externalapi.NewDomainHashFromString(blockHashes[i])
+		if err != nil {
+			return nil, err
+		}
+		block, err := appmessage.RPCBlockToDomainBlock(rpcBlock)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not decode block %s", hash)
+		}
+		blocks[i] = &nodeBlock{
+			hash:        hash,
+			block:       block,
+			verboseData: rpcBlock.VerboseData,
+		}
+	}
+	return blocks, nil
 }
 
 func (p *Processing) ResyncVirtualSelectedParentChain() error {
 	p.Lock()
 	defer p.Unlock()
 
-	return p.database.RunInTransaction(func(databaseTransaction *pg.Tx) error {
+	return p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
 		return p.resyncVirtualSelectedParentChain(databaseTransaction, false)
 	})
 }
 
-func (p *Processing) resyncVirtualSelectedParentChain(databaseTransaction *pg.Tx, withDependencies bool) error {
+func (p *Processing) resyncVirtualSelectedParentChain(databaseTransaction databasePackage.Transaction, withDependencies bool) error {
 	log.Infof("Resyncing virtual selected parent chain")
 	defer log.Infof("Finished resyncing virtual selected parent chain")
 
@@ -351,7 +862,7 @@ func (p *Processing) resyncVirtualSelectedParentChain(databaseTransaction *pg.Tx
 	}
 	log.Infof("Resyncing virtual selected parent chain from block %s", highestBlockHash)
 
-	chainFromBlock, err := p.rpcClient.GetVirtualSelectedParentChainFromBlock(highestBlockVirtualSelectedParentChain.BlockHash, false)
+	chainFromBlock, err := p.rpcClient.GetVirtualSelectedParentChainFromBlock(highestBlockVirtualSelectedParentChain.BlockHash, p.includeTransactions())
 	if err != nil {
 		// This may occur when restoring a kgi database on a system which karlsend database
 		// is older than the kgi database.
@@ -365,7 +876,7 @@ func (p *Processing) resyncVirtualSelectedParentChain(databaseTransaction *pg.Tx
 			return err
 		}
 
-		virtualSelectedParentBlockRPCBlock, err := p.rpcClient.GetBlock(chainFromBlock.AddedChainBlockHashes[len(chainFromBlock.AddedChainBlockHashes)-1], false)
+		virtualSelectedParentBlockRPCBlock, err := p.rpcClient.GetBlock(chainFromBlock.AddedChainBlockHashes[len(chainFromBlock.AddedChainBlockHashes)-1], p.includeTransactions())
 		if err != nil {
 			return err
 		}
@@ -380,7 +891,7 @@ func (p *Processing) resyncVirtualSelectedParentChain(databaseTransaction *pg.Tx
 			return err
 		}
 
-		removed, err := hashesFromStrings(chainFromBlock.AddedChainBlockHashes)
+		removed, err := hashesFromStrings(chainFromBlock.RemovedChainBlockHashes)
 		if err != nil {
 			return err
 		}
@@ -392,12 +903,17 @@ func (p *Processing) resyncVirtualSelectedParentChain(databaseTransaction *pg.Tx
 			},
 		}
 		if withDependencies {
-			err = p.processBlockAndDependencies(databaseTransaction, virtualSelectedParentHash, virtualSelectedParentBlock, nil)
+			err = p.processBlockAndDependencies(databaseTransaction, virtualSelectedParentHash, virtualSelectedParentBlock,
+				virtualSelectedParentBlockRPCBlock.Block.VerboseData, nil, nil)
 			if err != nil {
 				return err
 			}
 		}
-		err = p.processVirtualChange(databaseTransaction, blockInsertionResult, withDependencies)
+		chainChangeRecords := []*model.ChainChange{
+			newChainChangeRecord(blockInsertionResult.VirtualSelectedParentChainChanges, time.Now()),
+		}
+		err = p.processVirtualChange(databaseTransaction, blockInsertionResult, chainFromBlock.AcceptedTransactionIDs,
+			chainChangeRecords, withDependencies)
 		if err != nil {
 			return err
 		}
@@ -406,33 +922,54 @@ func (p *Processing) resyncVirtualSelectedParentChain(databaseTransaction *pg.Tx
 	return nil
 }
 
-func (p *Processing) ProcessBlock(block *externalapi.DomainBlock) error {
+func (p *Processing) ProcessBlock(block *externalapi.DomainBlock, receivedAt time.Time) error {
+	return p.ProcessBlocks([]*externalapi.DomainBlock{block}, []time.Time{receivedAt})
+}
+
+// ProcessBlocks processes `blocks` in order within a single transaction.
+// `receivedAts` are the arrival times of the notifications of `blocks`.
+func (p *Processing) ProcessBlocks(blocks []*externalapi.DomainBlock, receivedAts []time.Time) error {
 	p.Lock()
 	defer p.Unlock()
 
-	return p.database.RunInTransaction(func(databaseTransaction *pg.Tx) error {
-		return p.processBlockAndDependencies(databaseTransaction, consensushashing.BlockHash(block), block, nil)
+	return p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		for i, block := range blocks {
+			err := p.processBlockAndDependencies(databaseTransaction, consensushashing.BlockHash(block), block, nil, nil,
+				&receivedAts[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 }
 
-// processBlockAndDependencies processes `block` and all its missing dependencies
-func (p *Processing) processBlockAndDependencies(databaseTransaction *pg.Tx, hash *externalapi.DomainHash,
-	block, pruningBlock *externalapi.DomainBlock) error {
+// processBlockAndDependencies processes `block` and all its missing dependencies.
+// `verboseData` may be nil, in which case it is requested from the node.
+// `receivedAt` is the arrival time of the notification of `block`, nil if
+// `block` was not notified. The dependencies have no arrival time.
+func (p *Processing) processBlockAndDependencies(databaseTransaction databasePackage.Transaction, hash *externalapi.DomainHash,
+	block *externalapi.DomainBlock, verboseData *appmessage.RPCBlockVerboseData, pruningBlock *externalapi.DomainBlock,
+	receivedAt *time.Time) error {
 
-	batch := batch.New(p.database, p.rpcClient, pruningBlock)
-	err := batch.CollectBlockAndDependencies(databaseTransaction, hash, block)
+	batch := batch.New(p.database, p.rpcClient, pruningBlock, p.includeTransactions())
+	err := batch.CollectBlockAndDependencies(databaseTransaction, hash, block, verboseData)
 	if err != nil {
 		return err
 	}
 	for {
-		_, block, ok := batch.Pop()
+		poppedHash, block, verboseData, ok := batch.Pop()
 		if !ok {
 			break
 		}
 		if !batch.Empty() {
 			log.Warnf("Handling missing dependency block %s", consensushashing.BlockHash(block))
 		}
-		err = p.processBlock(databaseTransaction, block)
+		var blockReceivedAt *time.Time
+		if poppedHash.Equal(hash) {
+			blockReceivedAt = receivedAt
+		}
+		err = p.processBlock(databaseTransaction, block, verboseData, blockReceivedAt)
 		if err != nil {
 			return err
 		}
@@ -440,184 +977,54 @@ func (p *Processing) processBlockAndDependencies(databaseTransaction *pg.Tx, has
 	return nil
 }
 
-func (p *Processing) processBlock(databaseTransaction *pg.Tx, block *externalapi.DomainBlock) error {
+func (p *Processing) processBlock(databaseTransaction databasePackage.Transaction, block *externalapi.DomainBlock,
+	verboseData *appmessage.RPCBlockVerboseData, receivedAt *time.Time) error {
 
 	blockHash := consensushashing.BlockHash(block)
 	log.Debugf("Processing block %s", blockHash)
 	defer log.Debugf("Finished processing block %s", blockHash)
 
-	isIncompleteBlock := false
-	blockExists, err := p.database.DoesBlockExist(databaseTransaction, blockHash)
-	if err != nil {
-		// enhanced error description
-		return errors.Wrapf(err, "Could not check if block %s does exist in database", blockHash)
-	}
-	if !blockExists {
-		parentHashes := block.Header.DirectParents()
-		existingParentHashes := make([]*externalapi.DomainHash, 0, len(parentHashes))
-		for _, parentHash := range parentHashes {
-			parentExists, err := p.database.DoesBlockExist(databaseTransaction, parentHash)
-			if err != nil {
-				// enhanced error description
-				return errors.Wrapf(err, "Could not check if parent %s for block %s does exist in database", parentHash, blockHash)
-			}
-			if !parentExists {
-				log.Warnf("Parent %s for block %s does not exist in the database", parentHash, blockHash)
-				isIncompleteBlock = true
-				continue
-			}
-			existingParentHashes = append(existingParentHashes, parentHash)
-		}
-
-		parentIDs, parentHeights, err := p.database.BlockIDsAndHeightsByHashes(databaseTransaction, existingParentHashes)
-		if err != nil {
-			return errors.Errorf("Could not resolve "+
-				"parent IDs for block %s: %s", blockHash, err)
-		}
-
-		blockHeight := uint64(0)
-		for _, height := range parentHeights {
-			blockHeight = tools.Max(blockHeight, height+1)
-		}
-
-		heightGroupSize, err := p.database.HeightGroupSize(databaseTransaction, blockHeight)
+	if verboseData == nil {
+		rpcBlock, err := p.rpcClient.GetBlock(blockHash.String(), false)
 		if err != nil {
-			// enhanced error description
-			return errors.Wrapf(err, "Could not resolve group size for highest parent height %d for block %s", blockHeight, blockHash)
-		}
-		blockHeightGroupIndex := heightGroupSize
-
-		databaseBlock := &model.Block{
-			BlockHash:                      blockHash.String(),
-			Timestamp:                      block.Header.TimeInMilliseconds(),
-			ParentIDs:                      parentIDs,
-			Height:                         blockHeight,
-			HeightGroupIndex:               blockHeightGroupIndex,
-			SelectedParentID:               nil,
-			Color:                          model.ColorGray,
-			IsInVirtualSelectedParentChain: false,
-			MergeSetRedIDs:                 []uint64{},
-			MergeSetBlueIDs:                []uint64{},
-			DAAScore:                       block.Header.DAAScore(),
-		}
-		err = p.database.InsertBlock(databaseTransaction, blockHash, databaseBlock)
-		if err != nil {
-			return errors.Wrapf(err, "Could not insert block %s", blockHash)
-		}
-
-		blockID, err := p.database.BlockIDByHash(databaseTransaction, blockHash)
-		if err != nil {
-			// enhanced error description
-			return errors.Wrapf(err, "Could not get id for block %s", blockHash)
-		}
-		heightGroup := &model.HeightGroup{
-			Height: blockHeight,
-			Size:   blockHeightGroupIndex + 1,
-		}
-		err = p.database.InsertOrUpdateHeightGroup(databaseTransaction, heightGroup)
-		if err != nil {
-			// enhanced error description
-			return errors.Wrapf(err, "Could not insert or update height group %d for block %s", blockHeight, blockHash)
-		}
-
-		for _, parentID := range parentIDs {
-			parentHeight, err := p.database.BlockHeight(databaseTransaction, parentID)
-			if err != nil {
-				// enhanced error description
-				return errors.Wrapf(err, "Could not get block height of parent id %d for block %s", parentID, blockHash)
-			}
-			parentHeightGroupIndex, err := p.database.BlockHeightGroupIndex(databaseTransaction, parentID)
-			if err != nil {
-				// enhanced error description
-				return errors.Wrapf(err, "Could not get height group index of parent id %d for block %s", parentID, blockHash)
-			}
-			edge := &model.Edge{
-				FromBlockID:          blockID,
-				ToBlockID:            parentID,
-				FromHeight:           blockHeight,
-				ToHeight:             parentHeight,
-				FromHeightGroupIndex: blockHeightGroupIndex,
-				ToHeightGroupIndex:   parentHeightGroupIndex,
-			}
-			err = p.database.InsertEdge(databaseTransaction, edge)
-			if err != nil {
-				// enhanced error description
-				return errors.Wrapf(err, "Could not insert edge from block %s to parent id %d", blockHash, parentID)
-			}
+			return err
 		}
-	} else {
-		log.Debugf("Block %s already exists in database; not processed", blockHash)
+		verboseData = rpcBlock.Block.VerboseData
 	}
-
-	rpcBlock, err := p.rpcClient.GetBlock(blockHash.String(), false)
+	bulkBlock, err := newBulkBlock(blockHash, block, verboseData)
 	if err != nil {
 		return err
 	}
-
-	if rpcBlock.Block.VerboseData.IsHeaderOnly || isIncompleteBlock {
-		return nil
-	}
-
-	selectedParent, err := externalapi.NewDomainHashFromString(rpcBlock.Block.VerboseData.SelectedParentHash)
-	if err != nil {
-		return err
+	if receivedAt != nil {
+		receivedAtMilliseconds := receivedAt.UnixMilli()
+		bulkBlock.ReceivedAt = &receivedAtMilliseconds
 	}
-
-	blockID, err := p.database.BlockIDByHash(databaseTransaction, blockHash)
+	err = p.database.InsertBlocks(databaseTransaction, []*databasePackage.BulkBlock{bulkBlock})
 	if err != nil {
-		// enhanced error description
-		return errors.Wrapf(err, "Could not get id for block %s", blockHash)
+		return errors.Wrapf(err, "Could not insert block %s", blockHash)
 	}
 
-	selectedParentID, err := p.database.BlockIDByHash(databaseTransaction, selectedParent)
-	if err == nil {
-		err = p.database.UpdateBlockSelectedParent(databaseTransaction, blockID, selectedParentID)
-		if err != nil {
-			// enhanced error description
-			return errors.Wrapf(err, "Could not update selected parent for block %s", blockHash)
-		}
-	}
-
-	mergeSetReds, err := hashesFromStrings(rpcBlock.Block.VerboseData.MergeSetRedsHashes)
+	processedBlocks := []*nodeBlock{{hash: blockHash, block: block}}
+	err = p.storeBlockHeaders(databaseTransaction, processedBlocks)
 	if err != nil {
 		return err
 	}
-
-	mergeSetRedIDs, err := p.database.BlockIDsByHashes(databaseTransaction, mergeSetReds)
+	err = p.updateTips(databaseTransaction, processedBlocks)
 	if err != nil {
-		// enhanced error description
-		// return errors.Wrapf(err, "Could not get ids of merge set reds for block %s", blockHash)
-
-		// Let's ignore this error temporarily and just report it in the log
-		// This occures sometimes when the app was fresly started, at the end or just after ResyncDatabase
-		// The actual conditions and the way to solve this has to be determined yet.
-		// Update 2022-04-22: processBlockAndDependencies should solve the issue
-		log.Errorf("Could not get ids of merge set reds for block %s: %s", blockHash, mergeSetReds)
+		return err
 	}
-
-	mergeSetBlues, err := hashesFromStrings(rpcBlock.Block.VerboseData.MergeSetBluesHashes)
+	err = p.storeBlocksGHOSTDAGData(databaseTransaction, processedBlocks)
 	if err != nil {
 		return err
 	}
-
-	mergeSetBlueIDs, err := p.database.BlockIDsByHashes(databaseTransaction, mergeSetBlues)
+	err = p.storeDifficultySamples(databaseTransaction, processedBlocks)
 	if err != nil {
-		// enhanced error description
-		// return errors.Wrapf(err, "Could not get ids of merge set blues for block %s", blockHash)
-
-		// Let's ignore this error temporarily and just report it in the log
-		// This occures sometimes when the app was fresly started, at the end or just after ResyncDatabase
-		// The actual conditions and the way to solve this has to be determined yet.
-		// Update 2022-04-22: processBlockAndDependencies should solve the issue
-		log.Errorf("Could not get ids of merge set blues for block %s: %s", blockHash, mergeSetBlues)
+		return err
 	}
-	err = p.database.UpdateBlockMergeSet(databaseTransaction, blockID, mergeSetRedIDs, mergeSetBlueIDs)
-	if err != nil {
-		// enhanced error description
-		return errors.Wrapf(err, "Could not update merge sets colors for block %s", blockHash)
+	if verboseData.IsHeaderOnly {
+		return nil
 	}
-
-	return nil
+	return p.storeBlockTransactions(databaseTransaction, processedBlocks)
 }
 
 func hashesFromStrings(strs []string) ([]*externalapi.DomainHash, error) {
@@ -632,22 +1039,61 @@ func hashesFromStrings(strs []string) ([]*externalapi.DomainHash, error) {
 	return hashes, nil
 }
 
-func (p *Processing) ProcessVirtualChange(blockInsertionResult *externalapi.VirtualChangeSet) error {
+func hashesToStrings(hashes []*externalapi.DomainHash) []string {
+	strs := make([]string, len(hashes))
+	for i, hash := range hashes {
+		strs[i] = hash.String()
+	}
+	return strs
+}
+
+// ProcessVirtualChange applies the chain changes of `blockInsertionResult`,
+// notified by the node at `receivedAt` along with the transactions
+// `acceptedTransactionIDs` accepted by the added chain blocks
+func (p *Processing) ProcessVirtualChange(blockInsertionResult *externalapi.VirtualChangeSet,
+	acceptedTransactionIDs []*appmessage.AcceptedTransactionIDs, receivedAt time.Time) error {
+
+	if blockInsertionResult == nil || blockInsertionResult.VirtualSelectedParentChainChanges == nil {
+		return nil
+	}
+	chainChangeRecords := []*model.ChainChange{
+		newChainChangeRecord(blockInsertionResult.VirtualSelectedParentChainChanges, receivedAt),
+	}
+
 	p.Lock()
 	defer p.Unlock()
 
-	return p.database.RunInTransaction(func(databaseTransaction *pg.Tx) error {
-		return p.processVirtualChange(databaseTransaction, blockInsertionResult, true)
+	return p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		return p.processVirtualChange(databaseTransaction, blockInsertionResult, acceptedTransactionIDs, chainChangeRecords, true)
 	})
 }
 
-func (p *Processing) processVirtualChange(databaseTransaction *pg.Tx, blockInsertionResult *externalapi.VirtualChangeSet, withDependencies bool) error {
+// newChainChangeRecord returns the chain changes log record of the chain
+// changes `chainChanges` notified at `receivedAt`
+func newChainChangeRecord(chainChanges *externalapi.SelectedChainPath, receivedAt time.Time) *model.ChainChange {
+	return &model.ChainChange{
+		Timestamp:          receivedAt.UnixMilli(),
+		AddedBlockHashes:   hashesToStrings(chainChanges.Added),
+		RemovedBlockHashes: hashesToStrings(chainChanges.Removed),
+		ReorgDepth:         len(chainChanges.Removed),
+		ColorChanges:       []*model.ColorChange{},
+	}
+}
+
+// processVirtualChange applies the chain changes of `blockInsertionResult`
+// and records `chainChangeRecords`, the notifications they are the net chain
+// diff of, in the chain changes log. The color changes of the net chain diff
+// are recorded with the last notification.
+func (p *Processing) processVirtualChange(databaseTransaction databasePackage.Transaction, blockInsertionResult *externalapi.VirtualChangeSet,
+	acceptedTransactionIDs []*appmessage.AcceptedTransactionIDs, chainChangeRecords []*model.ChainChange, withDependencies bool) error {
+
 	if blockInsertionResult == nil || blockInsertionResult.VirtualSelectedParentChainChanges == nil {
 		return nil
 	}
 
 	blockColors := make(map[uint64]string)
 	blockIsInVirtualSelectedParentChain := make(map[uint64]bool)
+	var removedBlockIDs []uint64
 	removedBlockHashes := blockInsertionResult.VirtualSelectedParentChainChanges.Removed
 	if len(removedBlockHashes) > 0 {
 		for _, removedBlockHash := range removedBlockHashes {
@@ -655,6 +1101,21 @@ func (p *Processing) processVirtualChange(databaseTransaction *pg.Tx, blockInser
 			if err == nil {
 				blockColors[removedBlockID] = model.ColorGray
 				blockIsInVirtualSelectedParentChain[removedBlockID] = false
+				removedBlockIDs = append(removedBlockIDs, removedBlockID)
+
+				// The blocks merged by a removed chain block lose the color it gave them.
+				// The ones still in the past of the new chain get their color back below
+				// from the merge set of the added chain block merging them.
+				mergeSetRedIDs, mergeSetBlueIDs, err := p.database.GetBlockMergeSet(databaseTransaction, removedBlockID)
+				if err != nil {
+					return errors.Wrapf(err, "Could not get the merge set of removed block %s", removedBlockHash)
+				}
+				for _, mergedBlockID := range mergeSetBlueIDs {
+					blockColors[mergedBlockID] = model.ColorGray
+				}
+				for _, mergedBlockID := range mergeSetRedIDs {
+					blockColors[mergedBlockID] = model.ColorGray
+				}
 			} else if withDependencies {
 				log.Errorf("Could not get id of removed block %s", removedBlockHash)
 			}
@@ -675,10 +1136,29 @@ func (p *Processing) processVirtualChange(databaseTransaction *pg.Tx, blockInser
 	err := p.database.UpdateBlockIsInVirtualSelectedParentChain(databaseTransaction, blockIsInVirtualSelectedParentChain)
 	if err != nil {
 		// enhanced error description
-		return errors.Wrapf(err, "Could not update blocks in virtual selected parent chain for block %s", nil)
+		return errors.Wrapf(err, "Could not update blocks in virtual selected parent chain")
 	}
 
 	for _, addedBlockHash := range addedBlockHashes {
+		// The merge sets stored with the block spare a request to the node.
+		// A chain block always has a blue merge set, the selected parent at least.
+		addedBlockID, err := p.database.BlockIDByHash(databaseTransaction, addedBlockHash)
+		if err == nil {
+			mergeSetRedIDs, mergeSetBlueIDs, err := p.database.GetBlockMergeSet(databaseTransaction, addedBlockID)
+			if err != nil {
+				return err
+			}
+			if len(mergeSetBlueIDs) > 0 {
+				for _, blueBlockID := range mergeSetBlueIDs {
+					blockColors[blueBlockID] = model.ColorBlue
+				}
+				for _, redBlockID := range mergeSetRedIDs {
+					blockColors[redBlockID] = model.ColorRed
+				}
+				continue
+			}
+		}
+
 		rpcBlock, err := p.rpcClient.GetBlock(addedBlockHash.String(), false)
 		if err != nil {
 			return err
@@ -716,25 +1196,57 @@ func (p *Processing) processVirtualChange(databaseTransaction *pg.Tx, blockInser
 			}
 		}
 	}
+
+	err = p.updateTransactionAcceptances(databaseTransaction, removedBlockIDs, addedBlockHashes, acceptedTransactionIDs)
+	if err != nil {
+		return errors.Wrapf(err, "Could not update the transaction acceptances")
+	}
+
+	colorChanges, err := p.database.ColorChanges(databaseTransaction, blockColors)
+	if err != nil {
+		return errors.Wrapf(err, "Could not resolve the color changes")
+	}
+	chainChangeRecords[len(chainChangeRecords)-1].ColorChanges = colorChanges
+	for _, chainChangeRecord := range chainChangeRecords {
+		err = p.database.InsertChainChange(databaseTransaction, chainChangeRecord)
+		if err != nil {
+			return err
+		}
+	}
+
 	return p.database.UpdateBlockColors(databaseTransaction, blockColors)
 }
 
 // Get a map of DAA Scores associated to database block ids.
-// The blocks are retrieved from the DAG by hash.
-// Their DAG DAA score is then associated to their id in the database.
+// The DAG DAA score of the blocks fetched from the node is associated to their id in the database.
 // Only matching DAG and database blocks are added to the returned map.
-func (p *Processing) getBlocksDAAScores(databaseTransaction *pg.Tx, blockHashes []*externalapi.DomainHash) (map[uint64]uint64, error) {
+func (p *Processing) getBlocksDAAScores(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock) (map[uint64]uint64, error) {
 	results := make(map[uint64]uint64)
-	for _, blockHash := range blockHashes {
-		block, err := p.rpcClient.GetBlock(blockHash.String(), false)
-		if err != nil {
-			return nil, err
-		}
-		blockID, err := p.database.BlockIDByHash(databaseTransaction, blockHash)
+	for _, block := range blocks {
+		blockID, err := p.database.BlockIDByHash(databaseTransaction, block.hash)
 		// We ignore non-existing blocks in the database
 		if err == nil {
-			results[blockID] = block.Block.Header.DAAScore
+			results[blockID] = block.block.Header.DAAScore()
 		}
 	}
 	return results, nil
 }
+
+// Get a map of blue scores and blue works associated to database block ids.
+// Only matching DAG and database blocks are added to the returned map.
+func (p *Processing) getBlocksBlueScoresAndWorks(databaseTransaction databasePackage.Transaction,
+	blocks []*nodeBlock) map[uint64]*databasePackage.BlueScoreAndWork {
+
+	results := make(map[uint64]*databasePackage.BlueScoreAndWork)
+	for _, block := range blocks {
+		blockID, err := p.database.BlockIDByHash(databaseTransaction, block.hash)
+		// We ignore non-existing blocks in the database
+		if err == nil {
+			results[blockID] = &databasePackage.BlueScoreAndWork{
+				BlueScore: block.block.Header.BlueScore(),
+				BlueWork:  block.block.Header.BlueWork().String(),
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,490 @@
+package processing
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/embedded"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	configPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/config"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/eventqueue"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/fakenode"
+	"github.com/karlsen-network/karlsend/v2/app/appmessage"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/karlsen-network/karlsend/v2/domain/dagconfig"
+	karlsenConfigPackage "github.com/karlsen-network/karlsend/v2/infrastructure/config"
+	"github.com/pkg/errors"
+)
+
+// newTestProcessing returns a Processing syncing `node` into an embedded
+// storage, with the database resynced from the node
+func newTestProcessing(t *testing.T, node *fakenode.Node) *Processing {
+	t.Helper()
+
+	storage, err := embedded.Open(filepath.Join(t.TempDir(), "processing.db"))
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	t.Cleanup(storage.Close)
+
+	config := &configPackage.Config{
+		Flags: &configPackage.Flags{
+			NoTransactions:  true,
+			ResyncWorkers:   2,
+			ResyncChunkSize: 3,
+			EventQueueSize:  10,
+			NetworkFlags:    karlsenConfigPackage.NetworkFlags{ActiveNetParams: &dagconfig.SimnetParams},
+		},
+	}
+	dialNodeClient := func() (NodeClient, error) {
+		return node.Dial()
+	}
+	processing, err := NewProcessing(config, storage, node, dialNodeClient)
+	if err != nil {
+		t.Fatalf("NewProcessing: %s", err)
+	}
+	err = processing.RegisterAppConfig()
+	if err != nil {
+		t.Fatalf("RegisterAppConfig: %s", err)
+	}
+	err = processing.ResyncDatabase(context.Background())
+	if err != nil {
+		t.Fatalf("ResyncDatabase: %s", err)
+	}
+	return processing
+}
+
+// storedBlock returns the stored block identified by `hash`, or nil if it is not stored
+func storedBlock(t *testing.T, processing *Processing, hash *externalapi.DomainHash) *model.Block {
+	t.Helper()
+
+	var block *model.Block
+	err := processing.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		blockExists, err := processing.database.DoesBlockExist(databaseTransaction, hash)
+		if err != nil || !blockExists {
+			return err
+		}
+		blockID, err := processing.database.BlockIDByHash(databaseTransaction, hash)
+		if err != nil {
+			return err
+		}
+		block, err = processing.database.GetBlock(databaseTransaction, blockID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("storedBlock: %s", err)
+	}
+	return block
+}
+
+func storedBlockID(t *testing.T, processing *Processing, hash *externalapi.DomainHash) uint64 {
+	t.Helper()
+
+	block := storedBlock(t, processing, hash)
+	if block == nil {
+		t.Fatalf("block %s is not stored", hash)
+	}
+	return block.ID
+}
+
+func TestResyncDatabase(t *testing.T) {
+	node := fakenode.New()
+	node.SetPageSize(2)
+	genesis := node.Genesis()
+	a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+	b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+	header := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{b}, IsHeaderOnly: true})
+	c := node.AddBlock(&fakenode.BlockTemplate{
+		Parents:       []*externalapi.DomainHash{a, b},
+		MergeSetBlues: []*externalapi.DomainHash{a},
+		// A merge set block below the pruning point is not stored and is left out
+		MergeSetReds: []*externalapi.DomainHash{b, externalapi.NewDomainHashFromByteArray(&[externalapi.DomainHashSize]byte{1})},
+	})
+	err := node.SetSelectedTip(c)
+	if err != nil {
+		t.Fatalf("SetSelectedTip: %s", err)
+	}
+
+	processing := newTestProcessing(t, node)
+
+	tests := []struct {
+		name             string
+		hash             *externalapi.DomainHash
+		height           uint64
+		selectedParent   *externalapi.DomainHash
+		color            string
+		isInChain        bool
+		heightGroupIndex uint32
+	}{
+		{name: "pruning point", hash: genesis, height: 0, color: model.ColorBlue, isInChain: true},
+		{name: "first child", hash: a, height: 1, selectedParent: genesis, color: model.ColorBlue, isInChain: true},
+		{name: "second child", hash: b, height: 1, selectedParent: genesis, color: model.ColorRed, heightGroupIndex: 1},
+		{name: "merging block", hash: c, height: 2, selectedParent: a, color: model.ColorGray, isInChain: true, heightGroupIndex: 1},
+		{name: "header-only block", hash: header, height: 2, color: model.ColorGray},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := storedBlock(t, processing, test.hash)
+			if block == nil {
+				t.Fatalf("block %s is not stored", test.hash)
+			}
+			if block.Height != test.height {
+				t.Errorf("height: got %d, want %d", block.Height, test.height)
+			}
+			if block.HeightGroupIndex != test.heightGroupIndex {
+				t.Errorf("height group index: got %d, want %d", block.HeightGroupIndex, test.heightGroupIndex)
+			}
+			if block.Color != test.color {
+				t.Errorf("color: got %s, want %s", block.Color, test.color)
+			}
+			if block.IsInVirtualSelectedParentChain != test.isInChain {
+				t.Errorf("in virtual selected parent chain: got %t, want %t", block.IsInVirtualSelectedParentChain, test.isInChain)
+			}
+			checkSelectedParent(t, processing, block, test.selectedParent)
+		})
+	}
+}
+
+// countingNodeClient is a node client counting the block requests sent to the node
+type countingNodeClient struct {
+	*fakenode.Node
+	getBlockCount  int
+	getBlocksCount int
+}
+
+func (c *countingNodeClient) GetBlock(hash string, includeTransactions bool) (*appmessage.GetBlockResponseMessage, error) {
+	c.getBlockCount++
+	return c.Node.GetBlock(hash, includeTransactions)
+}
+
+func (c *countingNodeClient) GetBlocks(lowHash string, includeBlocks bool, includeTransactions bool) (
+	*appmessage.GetBlocksResponseMessage, error) {
+
+	c.getBlocksCount++
+	if !includeBlocks {
+		return nil, errors.Errorf("the blocks of %s were requested without their data", lowHash)
+	}
+	return c.Node.GetBlocks(lowHash, includeBlocks, includeTransactions)
+}
+
+func TestResyncDatabaseWalksPagesOnce(t *testing.T) {
+	node := fakenode.New()
+	node.SetPageSize(2)
+	genesis := node.Genesis()
+	a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+	err := node.SetSelectedTip(a)
+	if err != nil {
+		t.Fatalf("SetSelectedTip: %s", err)
+	}
+	processing := newTestProcessing(t, node)
+
+	b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a}})
+	c := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{b}})
+	err = node.SetSelectedTip(c)
+	if err != nil {
+		t.Fatalf("SetSelectedTip: %s", err)
+	}
+	client := &countingNodeClient{Node: node}
+	processing.rpcClient = client
+	processing.dialNodeClient = func() (NodeClient, error) {
+		return client, nil
+	}
+
+	err = processing.ResyncDatabase(context.Background())
+	if err != nil {
+		t.Fatalf("ResyncDatabase: %s", err)
+	}
+	for _, hash := range []*externalapi.DomainHash{b, c} {
+		if storedBlock(t, processing, hash) == nil {
+			t.Errorf("block %s was not resynced", hash)
+		}
+	}
+	// The pages start with the pruning point, a and b
+	if client.getBlocksCount != 3 {
+		t.Errorf("GetBlocks requests: got %d, want one per page", client.getBlocksCount)
+	}
+	// Only the pruning point and the virtual selected parent of the chain
+	// resync are requested on their own
+	if client.getBlockCount != 2 {
+		t.Errorf("GetBlock requests: got %d, want 2", client.getBlockCount)
+	}
+}
+
+func checkSelectedParent(t *testing.T, processing *Processing, block *model.Block, selectedParent *externalapi.DomainHash) {
+	t.Helper()
+
+	if selectedParent == nil {
+		if block.SelectedParentID != nil {
+			t.Errorf("selected parent: got id %d, want none", *block.SelectedParentID)
+		}
+		return
+	}
+	wantID := storedBlockID(t, processing, selectedParent)
+	if block.SelectedParentID == nil || *block.SelectedParentID != wantID {
+		t.Errorf("selected parent: got %v, want id %d", block.SelectedParentID, wantID)
+	}
+}
+
+func TestProcessBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		// build adds the blocks of the test to `node` after the resync and
+		// returns the notified block and the blocks expected to be stored
+		build           func(node *fakenode.Node, genesis *externalapi.DomainHash) (*externalapi.DomainHash, []*externalapi.DomainHash)
+		height          uint64
+		hasParentInNode bool
+	}{
+		{
+			name: "block with stored parent",
+			build: func(node *fakenode.Node, genesis *externalapi.DomainHash) (*externalapi.DomainHash, []*externalapi.DomainHash) {
+				a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				return a, []*externalapi.DomainHash{a}
+			},
+			height:          1,
+			hasParentInNode: true,
+		},
+		{
+			name: "missing parents collected from the node",
+			build: func(node *fakenode.Node, genesis *externalapi.DomainHash) (*externalapi.DomainHash, []*externalapi.DomainHash) {
+				a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a}})
+				c := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{b}})
+				return c, []*externalapi.DomainHash{a, b, c}
+			},
+			height:          3,
+			hasParentInNode: true,
+		},
+		{
+			name: "missing parent unknown to the node",
+			build: func(node *fakenode.Node, genesis *externalapi.DomainHash) (*externalapi.DomainHash, []*externalapi.DomainHash) {
+				a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				node.SetAvailable(a, false)
+				b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a, genesis}})
+				return b, []*externalapi.DomainHash{b}
+			},
+			height: 1,
+		},
+		{
+			name: "header-only block",
+			build: func(node *fakenode.Node, genesis *externalapi.DomainHash) (*externalapi.DomainHash, []*externalapi.DomainHash) {
+				a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}, IsHeaderOnly: true})
+				return a, []*externalapi.DomainHash{a}
+			},
+			height: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := fakenode.New()
+			processing := newTestProcessing(t, node)
+
+			notified, expected := test.build(node, node.Genesis())
+			block, ok := node.DomainBlock(notified)
+			if !ok {
+				t.Fatalf("block %s is not in the node", notified)
+			}
+			receivedAt := time.UnixMilli(1234)
+			err := processing.ProcessBlock(block, receivedAt)
+			if err != nil {
+				t.Fatalf("ProcessBlock: %s", err)
+			}
+
+			for _, hash := range expected {
+				if storedBlock(t, processing, hash) == nil {
+					t.Errorf("block %s is not stored", hash)
+				}
+			}
+			stored := storedBlock(t, processing, notified)
+			if stored == nil {
+				t.Fatalf("notified block %s is not stored", notified)
+			}
+			if stored.Height != test.height {
+				t.Errorf("height: got %d, want %d", stored.Height, test.height)
+			}
+			if stored.ReceivedAt == nil || *stored.ReceivedAt != receivedAt.UnixMilli() {
+				t.Errorf("received at: got %v, want %d", stored.ReceivedAt, receivedAt.UnixMilli())
+			}
+			if test.hasParentInNode {
+				checkSelectedParent(t, processing, stored, block.Header.DirectParents()[0])
+			} else {
+				checkSelectedParent(t, processing, stored, nil)
+			}
+		})
+	}
+}
+
+func TestProcessVirtualChange(t *testing.T) {
+	tests := []struct {
+		name string
+		// build adds the blocks of the test to `node` and returns the
+		// successive selected tips, and the expected chain and colors
+		build func(node *fakenode.Node, genesis *externalapi.DomainHash) (
+			tips []*externalapi.DomainHash, chain []*externalapi.DomainHash, colors map[*externalapi.DomainHash]string)
+	}{
+		{
+			name: "chain extension",
+			build: func(node *fakenode.Node, genesis *externalapi.DomainHash) (
+				[]*externalapi.DomainHash, []*externalapi.DomainHash, map[*externalapi.DomainHash]string) {
+
+				a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a}})
+				return []*externalapi.DomainHash{a, b}, []*externalapi.DomainHash{genesis, a, b},
+					map[*externalapi.DomainHash]string{a: model.ColorBlue, b: model.ColorGray}
+			},
+		},
+		{
+			name: "reorg to a sibling branch",
+			build: func(node *fakenode.Node, genesis *externalapi.DomainHash) (
+				[]*externalapi.DomainHash, []*externalapi.DomainHash, map[*externalapi.DomainHash]string) {
+
+				a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a}})
+				c := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				d := node.AddBlock(&fakenode.BlockTemplate{
+					Parents:       []*externalapi.DomainHash{c, b},
+					MergeSetBlues: []*externalapi.DomainHash{c},
+					MergeSetReds:  []*externalapi.DomainHash{a, b},
+				})
+				return []*externalapi.DomainHash{b, d}, []*externalapi.DomainHash{genesis, c, d},
+					map[*externalapi.DomainHash]string{a: model.ColorRed, b: model.ColorRed, c: model.ColorBlue, d: model.ColorGray}
+			},
+		},
+		{
+			name: "reorg back to a removed branch",
+			build: func(node *fakenode.Node, genesis *externalapi.DomainHash) (
+				[]*externalapi.DomainHash, []*externalapi.DomainHash, map[*externalapi.DomainHash]string) {
+
+				a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{genesis}})
+				return []*externalapi.DomainHash{a, b, a}, []*externalapi.DomainHash{genesis, a},
+					map[*externalapi.DomainHash]string{a: model.ColorGray, b: model.ColorGray}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := fakenode.New()
+			processing := newTestProcessing(t, node)
+			genesis := node.Genesis()
+			tips, chain, colors := test.build(node, genesis)
+
+			var notifications []*appmessage.VirtualSelectedParentChainChangedNotificationMessage
+			err := node.RegisterForVirtualSelectedParentChainChangedNotifications(false,
+				func(notification *appmessage.VirtualSelectedParentChainChangedNotificationMessage) {
+					notifications = append(notifications, notification)
+				})
+			if err != nil {
+				t.Fatalf("RegisterForVirtualSelectedParentChainChangedNotifications: %s", err)
+			}
+			for _, tip := range tips {
+				block, _ := node.DomainBlock(tip)
+				err = processing.ProcessBlock(block, time.Now())
+				if err != nil {
+					t.Fatalf("ProcessBlock: %s", err)
+				}
+				err = node.SetSelectedTip(tip)
+				if err != nil {
+					t.Fatalf("SetSelectedTip: %s", err)
+				}
+			}
+			for _, notification := range notifications {
+				added, err := hashesFromStrings(notification.AddedChainBlockHashes)
+				if err != nil {
+					t.Fatal(err)
+				}
+				removed, err := hashesFromStrings(notification.RemovedChainBlockHashes)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = processing.ProcessVirtualChange(&externalapi.VirtualChangeSet{
+					VirtualSelectedParentChainChanges: &externalapi.SelectedChainPath{Added: added, Removed: removed},
+				}, notification.AcceptedTransactionIDs, time.Now())
+				if err != nil {
+					t.Fatalf("ProcessVirtualChange: %s", err)
+				}
+			}
+
+			isInChain := make(map[externalapi.DomainHash]bool)
+			for _, hash := range chain {
+				isInChain[*hash] = true
+			}
+			for hash, color := range colors {
+				block := storedBlock(t, processing, hash)
+				if block == nil {
+					t.Fatalf("block %s is not stored", hash)
+				}
+				if block.Color != color {
+					t.Errorf("color of %s: got %s, want %s", hash, block.Color, color)
+				}
+				if block.IsInVirtualSelectedParentChain != isInChain[*hash] {
+					t.Errorf("%s in virtual selected parent chain: got %t, want %t",
+						hash, block.IsInVirtualSelectedParentChain, isInChain[*hash])
+				}
+			}
+		})
+	}
+}
+
+// chainChangeRecordingStorage is a storage keeping the chain changes
+// inserted into it
+type chainChangeRecordingStorage struct {
+	databasePackage.Storage
+	chainChanges []*model.ChainChange
+}
+
+func (s *chainChangeRecordingStorage) InsertChainChange(databaseTransaction databasePackage.Transaction, chainChange *model.ChainChange) error {
+	s.chainChanges = append(s.chainChanges, chainChange)
+	return s.Storage.InsertChainChange(databaseTransaction, chainChange)
+}
+
+func TestProcessChainChangeRun(t *testing.T) {
+	node := fakenode.New()
+	processing := newTestProcessing(t, node)
+	storage := &chainChangeRecordingStorage{Storage: processing.database}
+	processing.database = storage
+
+	a := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{node.Genesis()}})
+	b := node.AddBlock(&fakenode.BlockTemplate{Parents: []*externalapi.DomainHash{a}})
+	queue := eventqueue.New(2)
+	for i, tip := range []*externalapi.DomainHash{a, b} {
+		block, _ := node.DomainBlock(tip)
+		err := processing.ProcessBlock(block, time.Now())
+		if err != nil {
+			t.Fatalf("ProcessBlock: %s", err)
+		}
+		queue.Push(&eventqueue.Event{
+			ChainChanges: &externalapi.SelectedChainPath{Added: []*externalapi.DomainHash{tip}, Removed: []*externalapi.DomainHash{}},
+			ReceivedAt:   time.UnixMilli(int64(i + 1)),
+		})
+	}
+	run, ok := queue.NextRun(context.Background(), maxBlocksPerTransaction)
+	if !ok || run.EventCount != 2 {
+		t.Fatalf("NextRun: the chain changes were not merged into one run")
+	}
+
+	err := processing.processChainChangeRun(run)
+	if err != nil {
+		t.Fatalf("processChainChangeRun: %s", err)
+	}
+	if len(storage.chainChanges) != 2 {
+		t.Fatalf("chain changes: got %d records, want one per notification", len(storage.chainChanges))
+	}
+	for i, tip := range []*externalapi.DomainHash{a, b} {
+		chainChange := storage.chainChanges[i]
+		if chainChange.Timestamp != int64(i+1) {
+			t.Errorf("chain change %d: got timestamp %d, want %d", i, chainChange.Timestamp, i+1)
+		}
+		if len(chainChange.AddedBlockHashes) != 1 || chainChange.AddedBlockHashes[0] != tip.String() {
+			t.Errorf("chain change %d: got added blocks %v, want %s", i, chainChange.AddedBlockHashes, tip)
+		}
+	}
+	if len(storage.chainChanges[0].ColorChanges) != 0 || len(storage.chainChanges[1].ColorChanges) == 0 {
+		t.Errorf("the color changes of the run are not recorded with its last notification")
+	}
+	if color := storedBlock(t, processing, a).Color; color != model.ColorBlue {
+		t.Errorf("color of %s: got %s, want %s", a, color, model.ColorBlue)
+	}
+}
@@ -0,0 +1,169 @@
+package processing
+
+import (
+	"context"
+	"time"
+
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	configPackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/config"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/infrastructure/tools"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/pkg/errors"
+)
+
+// retentionStepHeights is the number of heights deleted per transaction
+const retentionStepHeights = 1000
+
+// enforceRetention applies the retention policy at every retention interval.
+// It returns once `ctx` is done.
+func (p *Processing) enforceRetention(ctx context.Context) {
+	ticker := time.NewTicker(p.config.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := p.applyRetention(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Errorf("Could not apply the retention policy: %s", err)
+			}
+		}
+	}
+}
+
+// applyRetention deletes the blocks the retention policy no longer keeps.
+// Blocks at or above the node pruning point and blocks within the head
+// heights served by the API are never deleted.
+func (p *Processing) applyRetention(ctx context.Context) error {
+	lowestHeight, cutoffHeight, err := p.retentionRange()
+	if err != nil {
+		return err
+	}
+	if cutoffHeight <= lowestHeight {
+		log.Debugf("Retention: no block below height %d to delete", cutoffHeight)
+		return nil
+	}
+
+	droppedBelow, err := p.dropHeightPartitionsBelow(cutoffHeight)
+	if err != nil {
+		return err
+	}
+	if droppedBelow > lowestHeight {
+		log.Infof("Retention: dropped the partitions below height %d", droppedBelow)
+		lowestHeight = droppedBelow
+	}
+
+	log.Infof("Retention: deleting the blocks from height %d to %d", lowestHeight, cutoffHeight-1)
+	deletedCount := 0
+	for height := lowestHeight; height < cutoffHeight; {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		height = tools.Min(height+retentionStepHeights, cutoffHeight)
+		count, err := p.deleteBlocksBelowHeight(height)
+		if err != nil {
+			return err
+		}
+		deletedCount += count
+	}
+	log.Infof("Retention: deleted %d blocks below height %d", deletedCount, cutoffHeight)
+	return nil
+}
+
+// retentionRange returns the lowest stored height and the height below which
+// blocks are deleted
+func (p *Processing) retentionRange() (uint64, uint64, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	dagInfo, err := p.rpcClient.GetBlockDAGInfo()
+	if err != nil {
+		return 0, 0, err
+	}
+	pruningPointHash, err := externalapi.NewDomainHashFromString(dagInfo.PruningPointHash)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var lowestHeight, cutoffHeight uint64
+	err = p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		pruningPointHeight, err := p.database.BlockHeightByHash(databaseTransaction, pruningPointHash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get the height of the pruning point")
+		}
+		maxHeight, err := p.database.MaxBlockHeight(databaseTransaction)
+		if err != nil {
+			return err
+		}
+		lowestHeight, _, err = p.database.LowestBlockHeightSince(databaseTransaction, 0)
+		if err != nil {
+			return err
+		}
+
+		switch p.config.RetentionPolicy {
+		case configPackage.RetentionPolicyHeights:
+			cutoffHeight = saturatingSub(pruningPointHeight, p.config.RetentionHeights)
+		case configPackage.RetentionPolicyDays:
+			since := time.Now().Add(-time.Duration(p.config.RetentionDays) * 24 * time.Hour)
+			height, found, err := p.database.LowestBlockHeightSince(databaseTransaction, since.UnixMilli())
+			if err != nil {
+				return err
+			}
+			cutoffHeight = pruningPointHeight
+			if found {
+				cutoffHeight = height
+			}
+		default:
+			cutoffHeight = 0
+		}
+
+		cutoffHeight = tools.Min(cutoffHeight, pruningPointHeight)
+		cutoffHeight = tools.Min(cutoffHeight, saturatingSub(maxHeight, p.config.RetentionHeadHeights))
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return lowestHeight, cutoffHeight, nil
+}
+
+func (p *Processing) dropHeightPartitionsBelow(height uint64) (uint64, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	var droppedBelow uint64
+	err := p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		var err error
+		droppedBelow, err = p.database.DropHeightPartitionsBelow(databaseTransaction, height)
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not drop the partitions below height %d", height)
+	}
+	return droppedBelow, nil
+}
+
+func (p *Processing) deleteBlocksBelowHeight(height uint64) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	var count int
+	err := p.database.RunInTransaction(func(databaseTransaction databasePackage.Transaction) error {
+		var err error
+		count, err = p.database.DeleteBlocksBelowHeight(databaseTransaction, height)
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "Could not delete the blocks below height %d", height)
+	}
+	return count, nil
+}
+
+func saturatingSub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
@@ -0,0 +1,24 @@
+package processing
+
+import (
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/pkg/errors"
+)
+
+// updateTips updates the tips with `blocks`, all already stored in the
+// database along with their headers
+func (p *Processing) updateTips(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock) error {
+	blockIDs := make([]uint64, len(blocks))
+	for i, block := range blocks {
+		blockID, err := p.database.BlockIDByHash(databaseTransaction, block.hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for block %s", block.hash)
+		}
+		blockIDs[i] = blockID
+	}
+	err := p.database.UpdateTips(databaseTransaction, blockIDs)
+	if err != nil {
+		return errors.Wrapf(err, "Could not update the tips with %d blocks", len(blockIDs))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package processing
+
+import (
+	databasePackage "github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/database/model"
+	"github.com/karlsen-network/karlsen-graph-inspector/v2/processing/processing/coinbase"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/model/externalapi"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/utils/consensushashing"
+	"github.com/karlsen-network/karlsend/v2/domain/consensus/utils/transactionhelper"
+	"github.com/pkg/errors"
+)
+
+// includeTransactions returns true if the block transactions are stored,
+// in which case blocks are requested from the node with their transactions
+func (p *Processing) includeTransactions() bool {
+	return !p.config.NoTransactions
+}
+
+// blockTransactionRows returns the transaction summary and the transaction
+// ids rows of `block` identified by `blockID`
+func (p *Processing) blockTransactionRows(blockID uint64, block *externalapi.DomainBlock) (
+	*model.BlockTransactionSummary, []*model.BlockTransactionID) {
+
+	summary := &model.BlockTransactionSummary{
+		BlockID:          blockID,
+		TransactionCount: uint32(len(block.Transactions)),
+	}
+	transactionIDs := make([]*model.BlockTransactionID, len(block.Transactions))
+	for i, transaction := range block.Transactions {
+		transactionIDs[i] = &model.BlockTransactionID{
+			BlockID:          blockID,
+			TransactionIndex: uint32(i),
+			TransactionID:    consensushashing.TransactionID(transaction).String(),
+		}
+
+		outputAmount := uint64(0)
+		for _, output := range transaction.Outputs {
+			outputAmount += output.Value
+		}
+		if transactionhelper.IsCoinBase(transaction) {
+			summary.CoinbaseValue += outputAmount
+			continue
+		}
+		summary.TotalOutputAmount += outputAmount
+		summary.TotalMass += p.txMassCalculator.CalculateTransactionMass(transaction)
+	}
+	return summary, transactionIDs
+}
+
+// blockMinerRow returns the miner row of `block` identified by `blockID`.
+// Returns nil if the coinbase transaction cannot be parsed.
+func (p *Processing) blockMinerRow(blockID uint64, blockHash *externalapi.DomainHash, block *externalapi.DomainBlock) *model.BlockMiner {
+	coinbaseTransaction := block.Transactions[transactionhelper.CoinbaseTransactionIndex]
+	miner, err := coinbase.Parse(coinbaseTransaction, p.config.NetParams())
+	if err != nil {
+		log.Warnf("Could not parse the coinbase of block %s: %s", blockHash, err)
+		return nil
+	}
+	return &model.BlockMiner{
+		BlockID:         blockID,
+		ScriptPublicKey: miner.ScriptPublicKey,
+		Address:         miner.Address,
+		Tag:             miner.Tag,
+	}
+}
+
+// storeBlockTransactions stores the transactions and the miner of `blocks`,
+// all already stored in the database. Header-only blocks and blocks fetched
+// without their transactions are skipped. The miner is parsed from the
+// coinbase transaction, so --no-transactions disables miner attribution too.
+func (p *Processing) storeBlockTransactions(databaseTransaction databasePackage.Transaction, blocks []*nodeBlock) error {
+	if !p.includeTransactions() {
+		return nil
+	}
+
+	summaries := make([]*model.BlockTransactionSummary, 0, len(blocks))
+	transactionIDs := make([]*model.BlockTransactionID, 0, len(blocks))
+	miners := make([]*model.BlockMiner, 0, len(blocks))
+	for _, block := range blocks {
+		if len(block.block.Transactions) == 0 {
+			continue
+		}
+		blockID, err := p.database.BlockIDByHash(databaseTransaction, block.hash)
+		if err != nil {
+			return errors.Wrapf(err, "Could not get id for block %s", block.hash)
+		}
+		summary, blockTransactionIDs := p.blockTransactionRows(blockID, block.block)
+		summaries = append(summaries, summary)
+		transactionIDs = append(transactionIDs, blockTransactionIDs...)
+		miner := p.blockMinerRow(blockID, block.hash, block.block)
+		if miner != nil {
+			miners = append(miners, miner)
+		}
+	}
+	err := p.database.InsertBlockTransactions(databaseTransaction, summaries, transactionIDs, miners)
+	if err != nil {
+		return errors.Wrapf(err, "Could not store the transactions of %d blocks", len(summaries))
+	}
+	return nil
+}